@@ -1,42 +1,146 @@
 package main
 
 import (
+  "errors"
   "os"
   "fmt"
   "strings"
-  "bufio"
+  "flag"
+  "encoding/json"
+  "path/filepath"
 
   "github.com/cheesyhypocrisy/harsh/internal/executor"
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
 	"github.com/cheesyhypocrisy/harsh/internal/shell"
 )
 
 func main() {
-  path := os.Getenv("PATH")
-  executor.PathDirs = append(executor.PathDirs, strings.Split(path, ":")...)
+  login := flag.Bool("l", false, "act as a login shell")
+  flag.BoolVar(login, "login", false, "act as a login shell")
+  norc := flag.Bool("norc", false, "do not read ~/.harshrc")
+  noprofile := flag.Bool("noprofile", false, "do not read /etc/profile or ~/.profile")
+  noexec := flag.Bool("n", false, "check the script for syntax errors without running it")
+  jsonDiagnostics := flag.Bool("json", false, "with -n, print diagnostics as JSON")
+  flag.Parse()
 
-  histfile, exists := os.LookupEnv("HISTFILE")
-  // Only enable history persistence if HISTFILE is set
-  if exists {
-    file, err := os.Open(histfile)
-    if err != nil {
-      fmt.Fprintf(os.Stderr, "Unable to read history from file %s with err: %#v\n", histfile, err.Error())
-      return
+  // A leading '-' in argv[0] is how login(1) and friends ask for a login shell
+  if strings.HasPrefix(os.Args[0], "-") {
+    *login = true
+  }
+
+  // Trust an inherited PWD only if it really is where we are
+  if dir, err := executor.WorkingDir(); err == nil {
+    os.Setenv("PWD", dir)
+  }
+
+  // Going through SetVar splits PATH the way later assignments to it will
+  if path, exists := os.LookupEnv("PATH"); exists {
+    executor.SetVar("PATH", path)
+  }
+  // Scripts without a #! line are run by another harsh
+  if self, err := os.Executable(); err == nil {
+    executor.ShellPath = self
+  }
+
+  if *noexec {
+    if flag.NArg() == 0 {
+      fmt.Fprintln(os.Stderr, "harsh: -n requires a script")
+      os.Exit(2)
     }
-    defer file.Close()
+    os.Exit(checkScript(flag.Arg(0), *jsonDiagnostics))
+  }
 
-    scanner := bufio.NewScanner(file)
-    for scanner.Scan() {
-      executor.Hist = append(executor.Hist, scanner.Text())
+  // `harsh script.sh args...` runs the script non-interactively, where a
+  // syntax error is fatal
+  if flag.NArg() > 0 {
+    executor.PositionalArgs = flag.Args()[1:]
+    status, err := executor.RunScript(flag.Arg(0))
+    if err != nil {
+      fmt.Fprintf(os.Stderr, "harsh: %s\n", err.Error())
+      if errors.Is(err, os.ErrNotExist) {
+        status = 127
+      }
     }
+    os.Exit(status)
+  }
 
-    if err := scanner.Err(); err != nil {
+  runStartupFiles(*login, *norc, *noprofile)
+
+  // Only enable history persistence if HISTFILE is set. This comes after
+  // the startup files, which are where HISTFILE and HISTSIZE get set.
+  if histfile, exists := os.LookupEnv("HISTFILE"); exists {
+    if err := executor.LoadHistory(histfile); err != nil {
       fmt.Fprintf(os.Stderr, "Unable to read history from file %s with err: %#v\n", histfile, err.Error())
     }
   }
 
-
   if err := shell.Shell(); err != nil {
-    fmt.Fprint(os.Stderr, err)
+    fmt.Fprintln(os.Stderr, err)
   }
+  os.Exit(executor.LastStatus)
 }
 
+// runStartupFiles sources the profile files for login shells, then $ENV and
+// ~/.harshrc for interactive ones, those reading commands from a terminal.
+// Missing files are silently skipped.
+func runStartupFiles(login, norc, noprofile bool) {
+  home := os.Getenv("HOME")
+
+  if login && !noprofile {
+    sourceIfExists("/etc/profile")
+    if home != "" {
+      sourceIfExists(filepath.Join(home, ".profile"))
+    }
+  }
+
+  // Commands piped in, as in `cmd | harsh`, don't make an interactive shell
+  if !executor.IsTerminal(os.Stdin) {
+    return
+  }
+
+  // POSIX: $ENV is subject to parameter expansion and names the file to
+  // read for interactive shells. A leading ~ is expanded too.
+  if env := os.Getenv("ENV"); env != "" {
+    sourceIfExists(executor.ExpandFilename(env))
+  }
+
+  if !norc && home != "" {
+    sourceIfExists(filepath.Join(home, ".harshrc"))
+  }
+}
+
+// checkScript reports every syntax error in filename, either for humans
+// (file:line:col, the line and a caret) or as a JSON array for editors, and
+// returns 2 if there were any
+func checkScript(filename string, asJSON bool) int {
+  diagnostics, err := executor.CheckFile(filename)
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "harsh: %s\n", err.Error())
+    return 2
+  }
+
+  if asJSON {
+    encoder := json.NewEncoder(os.Stdout)
+    encoder.SetIndent("", "  ")
+    encoder.Encode(diagnostics)
+  } else {
+    for _, d := range diagnostics {
+      fmt.Fprintf(os.Stderr, "%s:%d:%d: %s\n", d.File, d.Span.Start.Line, d.Span.Start.Col, d.Message)
+      caret := &lexer.SyntaxError{Span: lexer.Span{Start: lexer.Position{Offset: d.Span.Start.Col - 1}}}
+      fmt.Fprintln(os.Stderr, caret.Caret(d.Source))
+    }
+  }
+
+  if len(diagnostics) > 0 {
+    return 2
+  }
+  return 0
+}
+
+// sourceIfExists runs a startup file, where a syntax error is reported and
+// the rest of the file still runs
+func sourceIfExists(filename string) {
+  if _, err := executor.SourceFile(filename, os.Stderr, false); err != nil && !os.IsNotExist(err) {
+    fmt.Fprintf(os.Stderr, "harsh: %s: %s\n", filename, err.Error())
+  }
+}
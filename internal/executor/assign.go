@@ -0,0 +1,93 @@
+package executor
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "strings"
+
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// assignment is a NAME=value prefix with its value expanded
+type assignment struct {
+  name, value string
+}
+
+// assignVars performs the assignments of a command that has no name. Each
+// value is expanded after the previous one is assigned, so b=$a can use an
+// a set just before it.
+func assignVars(assigns []parser.Assignment, stderr io.Writer) {
+  for _, assign := range assigns {
+    if err := SetVar(assign.Name, expandUnsplit(assign.Value)); err != nil {
+      fmt.Fprintf(stderr, "harsh: %s\n", err.Error())
+    }
+  }
+}
+
+// expandAssignments expands the values of assignments that go before a
+// command name, which only apply to that command
+func expandAssignments(assigns []parser.Assignment) []assignment {
+  expanded := make([]assignment, 0, len(assigns))
+  for _, assign := range assigns {
+    expanded = append(expanded, assignment{name: assign.Name, value: expandUnsplit(assign.Value)})
+  }
+  return expanded
+}
+
+// withAssignments puts assigns in the environment while runnable starts and
+// restores it afterwards. That is all an external command needs to inherit
+// them, and builtins have done their work by the time Start returns.
+func withAssignments(runnable Runnable, assigns []assignment) Runnable {
+  if len(assigns) == 0 {
+    return runnable
+  }
+  start := runnable.Start
+  runnable.Start = func(stdin io.Reader, stdout, stderr io.Writer) {
+    type saved struct {
+      value string
+      set bool
+    }
+    previous := make(map[string]saved, len(assigns))
+    for _, assign := range assigns {
+      if _, done := previous[assign.name]; !done {
+        value, set := os.LookupEnv(assign.name)
+        previous[assign.name] = saved{value, set}
+      }
+      os.Setenv(assign.name, assign.value)
+    }
+    defer func() {
+      for name, old := range previous {
+        if old.set {
+          os.Setenv(name, old.value)
+        } else {
+          os.Unsetenv(name)
+        }
+      }
+    }()
+    start(stdin, stdout, stderr)
+  }
+  return runnable
+}
+
+// commandPath finds the file to run for name and counts a hit for it. A
+// PATH among the command's own assignments is searched instead of the
+// shell's, bypassing the hash table.
+func commandPath(name string, assigns []assignment) (string, error) {
+  for i := len(assigns) - 1; i >= 0; i-- {
+    if assigns[i].name != "PATH" || strings.Contains(name, "/") {
+      continue
+    }
+    paths := searchPath(name, strings.Split(assigns[i].value, ":"))
+    if len(paths) == 0 {
+      return "", fmt.Errorf("%w: %s", errCommandNotFound, name)
+    }
+    return paths[0], nil
+  }
+
+  path, err := findExecutable(name)
+  if err == nil {
+    hashHit(name)
+  }
+  return path, err
+}
@@ -0,0 +1,70 @@
+package executor
+
+import (
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func TestAssignVars(t *testing.T) {
+  t.Setenv("harshA", "")
+  t.Setenv("harshB", "")
+
+  if status, err := Run(`harshA=1 harshB="$harshA two"`); err != nil || status != 0 {
+    t.Fatalf("Run failed: %d, %v", status, err)
+  }
+  if a, b := os.Getenv("harshA"), os.Getenv("harshB"); a != "1" || b != "1 two" {
+    t.Errorf("Expected harshA=1 harshB='1 two', got %q %q", a, b)
+  }
+}
+
+func TestTemporaryAssignments(t *testing.T) {
+  saved := PathDirs
+  PathDirs = []string{"/bin", "/usr/bin"}
+  defer func() { PathDirs = saved }()
+  t.Setenv("harshT", "outer")
+  os.Unsetenv("harshU")
+
+  if got := CommandOutput(`harshT=inner harshU=new sh -c 'echo $harshT $harshU'`); got != "inner new" {
+    t.Errorf("Expected the command to see inner new, got %q", got)
+  }
+  if got := CommandOutput(`sh -c 'echo $harshT'`); got != "outer" {
+    t.Errorf("Expected harshT to be outer again, got %q", got)
+  }
+  if _, set := os.LookupEnv("harshU"); set {
+    t.Errorf("Expected harshU to be unset again")
+  }
+}
+
+func TestTemporaryAssignmentForBuiltin(t *testing.T) {
+  input := filepath.Join(t.TempDir(), "input")
+  os.WriteFile(input, []byte("x:y\n"), 0644)
+  t.Setenv("harshX", "")
+  t.Setenv("harshY", "")
+  os.Unsetenv("IFS")
+
+  if status, err := Run("IFS=: read harshX harshY < " + input); err != nil || status != 0 {
+    t.Fatalf("read failed: %d, %v", status, err)
+  }
+  if x, y := os.Getenv("harshX"), os.Getenv("harshY"); x != "x" || y != "y" {
+    t.Errorf("Expected x and y split on :, got %q %q", x, y)
+  }
+  if _, set := os.LookupEnv("IFS"); set {
+    t.Errorf("Expected IFS to be unset again")
+  }
+}
+
+func TestTemporaryPath(t *testing.T) {
+  hashFixture(t)
+  path := os.Getenv("PATH")
+
+  if status, _ := Run("PATH=/nonexistent tool"); status != 127 {
+    t.Errorf("Expected tool not to be found on a temporary PATH, got status %d", status)
+  }
+  if os.Getenv("PATH") != path {
+    t.Errorf("Expected PATH to be restored")
+  }
+  if _, ok := hashTable["tool"]; ok {
+    t.Errorf("Expected tool not to be hashed")
+  }
+}
@@ -0,0 +1,217 @@
+package executor
+
+import (
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// WorkingDir is the logical working directory: $PWD if it is an absolute
+// path to the current directory, which keeps the symlinks the user went
+// through, otherwise the physical path
+func WorkingDir() (string, error) {
+  if pwd := os.Getenv("PWD"); filepath.IsAbs(pwd) {
+    pwdInfo, err := os.Stat(pwd)
+    dotInfo, dotErr := os.Stat(".")
+    if err == nil && dotErr == nil && os.SameFile(pwdInfo, dotInfo) {
+      return filepath.Clean(pwd), nil
+    }
+  }
+  return physicalDir(".")
+}
+
+// physicalDir resolves dir to an absolute path free of symlinks
+func physicalDir(dir string) (string, error) {
+  abs, err := filepath.Abs(dir)
+  if err != nil {
+    return "", err
+  }
+  return filepath.EvalSymlinks(abs)
+}
+
+// parseDirFlags takes the -L and -P options shared by cd and pwd off args,
+// reporting whether the last one asked for physical paths
+func parseDirFlags(name string, args []string) (bool, []string, error) {
+  physical := false
+  for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+    if args[0] == "--" {
+      return physical, args[1:], nil
+    }
+    for _, flag := range args[0][1:] {
+      switch flag {
+      case 'L':
+        physical = false
+      case 'P':
+        physical = true
+      case 'e':
+        // Only matters with -P, where a failure to resolve the new $PWD is
+        // reported as an error anyway
+      default:
+        return false, nil, fmt.Errorf("-%c: invalid option\n%s: usage: %s [-L|-P]", flag, name, name)
+      }
+    }
+    args = args[1:]
+  }
+  return physical, args, nil
+}
+
+func runPwd(args []string, stdout, stderr io.Writer) int {
+  physical, args, err := parseDirFlags("pwd", args)
+  if err != nil {
+    fmt.Fprintf(stderr, "pwd: %s\n", err.Error())
+    return 2
+  }
+
+  dir, err := WorkingDir()
+  if err == nil && physical {
+    dir, err = physicalDir(dir)
+  }
+  if err != nil {
+    fmt.Fprintf(stderr, "pwd: %s\n", errorText(err))
+    return 1
+  }
+  fmt.Fprintln(stdout, dir)
+  return 0
+}
+
+// runCd implements cd. By default (-L) .. is resolved lexically against
+// $PWD so it backs out of symlinked directories the way it came in; -P
+// resolves symlinks first. Relative names are looked up in $CDPATH, and
+// PWD and OLDPWD are kept up to date.
+func runCd(args []string, stdout, stderr io.Writer) int {
+  physical, args, err := parseDirFlags("cd", args)
+  if err != nil {
+    fmt.Fprintf(stderr, "cd: %s\n", err.Error())
+    return 2
+  }
+  if len(args) > 1 {
+    fmt.Fprintln(stderr, "cd: too many arguments")
+    return 1
+  }
+
+  // operand is what the user asked for, used in error messages, while
+  // target may have come from $CDPATH
+  operand := ""
+  printDir := false
+  if len(args) == 0 || args[0] == "~" {
+    homeDir, exists := os.LookupEnv("HOME")
+    if !exists {
+      username := os.Getenv("USER")
+      homeDir = fmt.Sprintf("/home/%s", username)
+    }
+    operand = homeDir
+  } else if args[0] == "-" {
+    oldPwd, exists := os.LookupEnv("OLDPWD")
+    if !exists || oldPwd == "" {
+      fmt.Fprintln(stderr, "cd: OLDPWD not set")
+      return 1
+    }
+    operand = oldPwd
+    printDir = true
+  } else {
+    operand = args[0]
+  }
+
+  target, found := searchCdPath(operand)
+  printDir = printDir || found
+
+  newPwd, err := setWorkingDir(target, physical)
+  if err != nil {
+    fmt.Fprintf(stderr, "cd: %s: %s\n", operand, errorText(err))
+    return 1
+  }
+  if printDir {
+    fmt.Fprintln(stdout, newPwd)
+  }
+  return 0
+}
+
+// setWorkingDir changes to target, keeping PWD and OLDPWD up to date, and
+// returns the new PWD
+func setWorkingDir(target string, physical bool) (string, error) {
+  oldPwd, _ := WorkingDir()
+  newPwd, err := changeDir(oldPwd, target, physical)
+  if err != nil {
+    return "", err
+  }
+  os.Setenv("OLDPWD", oldPwd)
+  os.Setenv("PWD", newPwd)
+  return newPwd, nil
+}
+
+// changeDir moves to target from the logical directory cwd and returns the
+// new $PWD
+func changeDir(cwd, target string, physical bool) (string, error) {
+  if physical {
+    if err := os.Chdir(target); err != nil {
+      return "", err
+    }
+    return physicalDir(".")
+  }
+
+  dir := target
+  if !filepath.IsAbs(dir) {
+    dir = filepath.Join(cwd, dir)
+  }
+  dir = filepath.Clean(dir)
+  err := os.Chdir(dir)
+  if err == nil {
+    return dir, nil
+  }
+
+  // The lexical path can be wrong where the physical one works, e.g. .. out
+  // of a directory that was since moved; fall back to it like bash does
+  if !filepath.IsAbs(target) && os.Chdir(target) == nil {
+    return physicalDir(".")
+  }
+  return "", err
+}
+
+// searchCdPath looks a relative directory up in $CDPATH. Names starting with
+// / . or .. are taken as they are. found is only set when a non-empty entry
+// matched, which is when cd prints where it went.
+func searchCdPath(dir string) (string, bool) {
+  cdPath := os.Getenv("CDPATH")
+  if cdPath == "" || filepath.IsAbs(dir) || dir == "." || dir == ".." || strings.HasPrefix(dir, "./") || strings.HasPrefix(dir, "../") {
+    return dir, false
+  }
+
+  for _, entry := range strings.Split(cdPath, ":") {
+    candidate := filepath.Join(entry, dir)
+    if entry == "" {
+      candidate = dir
+    }
+    if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+      return candidate, entry != ""
+    }
+  }
+  return dir, false
+}
+
+// errorText is the system's description of what went wrong, without the
+// operation and path that *os.PathError adds, capitalized like the shell
+// prints it: "No such file or directory", "Permission denied"...
+func errorText(err error) string {
+  var pathErr *os.PathError
+  if errors.As(err, &pathErr) {
+    err = pathErr.Err
+  }
+  text := err.Error()
+  if text == "" {
+    return text
+  }
+  return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// pathErrorText is errorText prefixed with the path the error is about, if
+// there is one: "log: Permission denied"
+func pathErrorText(err error) string {
+  var pathErr *os.PathError
+  if errors.As(err, &pathErr) {
+    return pathErr.Path + ": " + errorText(err)
+  }
+  return errorText(err)
+}
@@ -0,0 +1,146 @@
+package executor
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+// cdFixture builds real/sub, a symlink link -> real, cdpath/proj and a plain
+// file inside a temp dir and starts the test in it with a matching $PWD
+func cdFixture(t *testing.T) string {
+  dir, err := filepath.EvalSymlinks(t.TempDir())
+  if err != nil {
+    t.Fatal(err)
+  }
+  os.MkdirAll(filepath.Join(dir, "real", "sub"), 0755)
+  os.MkdirAll(filepath.Join(dir, "cdpath", "proj"), 0755)
+  os.WriteFile(filepath.Join(dir, "file"), []byte{}, 0644)
+  if err := os.Symlink(filepath.Join(dir, "real"), filepath.Join(dir, "link")); err != nil {
+    t.Fatal(err)
+  }
+
+  t.Chdir(dir)
+  t.Setenv("PWD", dir)
+  t.Setenv("OLDPWD", "")
+  t.Setenv("CDPATH", "")
+  return dir
+}
+
+func TestCd(t *testing.T) {
+  tests := []struct {
+    name   string
+    steps  [][]string
+    cdPath string
+    pwd    string
+    output string
+    errOut string
+    status int
+  }{
+    {"Relative", [][]string{{"real"}}, "", "real", "", "", 0},
+    {"Logical through symlink", [][]string{{"link/sub"}}, "", "link/sub", "", "", 0},
+    {"Logical dot dot", [][]string{{"link/sub"}, {".."}}, "", "link", "", "", 0},
+    {"Physical", [][]string{{"-P", "link/sub"}}, "", "real/sub", "", "", 0},
+    {"Physical dot dot", [][]string{{"link/sub"}, {"-P", ".."}}, "", "real", "", "", 0},
+    {"Dash", [][]string{{"real"}, {"/"}, {"-"}}, "", "real", "real\n", "", 0},
+    {"CDPATH", [][]string{{"proj"}}, "cdpath", "cdpath/proj", "cdpath/proj\n", "", 0},
+    {"CDPATH skipped for ./", [][]string{{"./proj"}}, "cdpath", "", "", "cd: ./proj: No such file or directory\n", 1},
+    {"Missing", [][]string{{"nope"}}, "", "", "", "cd: nope: No such file or directory\n", 1},
+    {"Not a directory", [][]string{{"file"}}, "", "", "", "cd: file: Not a directory\n", 1},
+    {"Too many arguments", [][]string{{"a", "b"}}, "", "", "", "cd: too many arguments\n", 1},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      dir := cdFixture(t)
+      if test.cdPath != "" {
+        t.Setenv("CDPATH", filepath.Join(dir, test.cdPath))
+      }
+
+      var out, errOut bytes.Buffer
+      status := 0
+      for _, step := range test.steps {
+        out.Reset()
+        status = runCd(step, &out, &errOut)
+      }
+
+      expectedPwd := filepath.Join(dir, test.pwd)
+      if pwd := os.Getenv("PWD"); pwd != expectedPwd {
+        t.Errorf("PWD = %q, expected %q", pwd, expectedPwd)
+      }
+      if cwd, _ := os.Getwd(); !sameDir(cwd, expectedPwd) {
+        t.Errorf("Working directory is %q, expected %q", cwd, expectedPwd)
+      }
+      if output := strings.ReplaceAll(out.String(), dir+"/", ""); output != test.output {
+        t.Errorf("Output = %q, expected %q", output, test.output)
+      }
+      if errOut.String() != test.errOut {
+        t.Errorf("Error output = %q, expected %q", errOut.String(), test.errOut)
+      }
+      if status != test.status {
+        t.Errorf("Status = %d, expected %d", status, test.status)
+      }
+    })
+  }
+}
+
+func TestCdOldPwd(t *testing.T) {
+  dir := cdFixture(t)
+  var out, errOut bytes.Buffer
+
+  if status := runCd([]string{"-"}, &out, &errOut); status != 1 || errOut.String() != "cd: OLDPWD not set\n" {
+    t.Errorf("cd - without OLDPWD returned %d with %q", status, errOut.String())
+  }
+
+  runCd([]string{"link"}, &out, &errOut)
+  if oldPwd := os.Getenv("OLDPWD"); oldPwd != dir {
+    t.Errorf("OLDPWD = %q, expected %q", oldPwd, dir)
+  }
+}
+
+func TestPwd(t *testing.T) {
+  dir := cdFixture(t)
+  var out, errOut bytes.Buffer
+  runCd([]string{"link/sub"}, &out, &errOut)
+
+  tests := []struct {
+    name     string
+    args     []string
+    expected string
+    status   int
+  }{
+    {"Logical by default", []string{}, filepath.Join(dir, "link", "sub") + "\n", 0},
+    {"Logical", []string{"-L"}, filepath.Join(dir, "link", "sub") + "\n", 0},
+    {"Physical", []string{"-P"}, filepath.Join(dir, "real", "sub") + "\n", 0},
+    {"Last option wins", []string{"-P", "-L"}, filepath.Join(dir, "link", "sub") + "\n", 0},
+    {"Invalid option", []string{"-x"}, "", 2},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var out, errOut bytes.Buffer
+      status := runPwd(test.args, &out, &errOut)
+      if out.String() != test.expected || status != test.status {
+        t.Errorf("pwd %q = %q (%d), expected %q (%d)", test.args, out.String(), status, test.expected, test.status)
+      }
+    })
+  }
+}
+
+func TestWorkingDirIgnoresStalePwd(t *testing.T) {
+  dir := cdFixture(t)
+  t.Setenv("PWD", filepath.Join(dir, "real"))
+
+  result, err := WorkingDir()
+  if err != nil || result != dir {
+    t.Errorf("WorkingDir() = %q, %v, expected %q", result, err, dir)
+  }
+}
+
+func sameDir(a, b string) bool {
+  aInfo, aErr := os.Stat(a)
+  bInfo, bErr := os.Stat(b)
+  return aErr == nil && bErr == nil && os.SameFile(aInfo, bInfo)
+}
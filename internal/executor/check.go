@@ -0,0 +1,99 @@
+package executor
+
+import (
+  "bufio"
+  "os"
+  "strings"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// Diagnostic is a problem found in a script without running it. Spans are
+// relative to the whole file.
+type Diagnostic struct {
+  File     string     `json:"file"`
+  Severity string     `json:"severity"`
+  Message  string     `json:"message"`
+  Span     lexer.Span `json:"span"`
+  // Source is the offending line, for rendering a caret under the error
+  Source   string     `json:"-"`
+}
+
+// CheckFile reads filename the way SourceFile would but only lexes and
+// parses it, as `harsh -n` does, collecting every syntax error on the way
+func CheckFile(filename string) ([]Diagnostic, error) {
+  file, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  diagnostics := make([]Diagnostic, 0)
+  // lines are those of the command being read, which started at line
+  // startLine, offset commandStart
+  var lines []string
+  startLine, commandStart := 0, 0
+  check := func() {
+    errs := make([]*lexer.SyntaxError, 0)
+    command := strings.Join(lines, "\n")
+    tokens, err := lexer.NewLexer(command).Lex()
+    if unsupported, ok := parser.ScanContinuation(command).Err().(*lexer.SyntaxError); ok {
+      errs = append(errs, unsupported)
+    } else if err != nil {
+      if syntaxErr, ok := err.(*lexer.SyntaxError); ok {
+        errs = append(errs, syntaxErr)
+      }
+    } else {
+      errs = parser.CheckTokens(tokens)
+    }
+
+    for _, syntaxErr := range errs {
+      diagnostics = append(diagnostics, Diagnostic{
+        File:     filename,
+        Severity: "error",
+        Message:  syntaxErr.Msg,
+        Span: lexer.Span{
+          Start: toFilePosition(syntaxErr.Span.Start, startLine, commandStart),
+          End:   toFilePosition(syntaxErr.Span.End, startLine, commandStart),
+        },
+        Source: lines[min(max(syntaxErr.Span.Start.Line, 1), len(lines))-1],
+      })
+    }
+    lines = nil
+  }
+
+  offset := 0
+  lineNo := 0
+  scanner := bufio.NewScanner(file)
+  for scanner.Scan() {
+    line := scanner.Text()
+    lineNo++
+    lineStart := offset
+    offset += len(line) + 1
+
+    if len(lines) == 0 {
+      trimmed := strings.TrimSpace(line)
+      if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+        continue
+      }
+      startLine, commandStart = lineNo, lineStart
+    }
+    lines = append(lines, line)
+    if !parser.ScanContinuation(strings.Join(lines, "\n")).Incomplete() {
+      check()
+    }
+  }
+  // A command still open at the end is lexed as it is, for the error
+  if len(lines) > 0 {
+    check()
+  }
+
+  return diagnostics, scanner.Err()
+}
+
+// toFilePosition moves a position within a command that starts at line
+// startLine, offset commandStart, to file coordinates
+func toFilePosition(pos lexer.Position, startLine, commandStart int) lexer.Position {
+  return lexer.Position{Offset: commandStart + pos.Offset, Line: startLine + max(pos.Line, 1) - 1, Col: pos.Col}
+}
@@ -0,0 +1,62 @@
+package executor
+
+import (
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func TestCheckFile(t *testing.T) {
+  script := filepath.Join(t.TempDir(), "script.sh")
+  content := "echo fine\n# | comment\nls | | wc\nif true\necho 'open\n"
+  if err := os.WriteFile(script, []byte(content), 0600); err != nil {
+    t.Fatal(err)
+  }
+
+  diagnostics, err := CheckFile(script)
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  expected := []struct {
+    line   int
+    col    int
+    offset int
+  }{
+    {3, 6, 27},
+    {4, 1, 32},
+    {5, 6, 45},
+  }
+  if len(diagnostics) != len(expected) {
+    t.Fatalf("Expected %d diagnostics, got %+v", len(expected), diagnostics)
+  }
+  for i, d := range diagnostics {
+    start := d.Span.Start
+    if start.Line != expected[i].line || start.Col != expected[i].col || start.Offset != expected[i].offset {
+      t.Errorf("Diagnostic %d - Expected %d:%d (offset %d), got %+v", i, expected[i].line, expected[i].col, expected[i].offset, start)
+    }
+    if d.File != script || d.Severity != "error" {
+      t.Errorf("Diagnostic %d - Unexpected metadata %+v", i, d)
+    }
+  }
+}
+
+func TestCheckFileMultiLine(t *testing.T) {
+  script := filepath.Join(t.TempDir(), "script.sh")
+  content := "echo 'a\nb' |\n  wc\nls |\n| wc\n"
+  if err := os.WriteFile(script, []byte(content), 0600); err != nil {
+    t.Fatal(err)
+  }
+
+  diagnostics, err := CheckFile(script)
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if len(diagnostics) != 1 {
+    t.Fatalf("Expected 1 diagnostic, got %+v", diagnostics)
+  }
+  d := diagnostics[0]
+  if start := d.Span.Start; start.Line != 5 || start.Col != 1 || start.Offset != 23 || d.Source != "| wc" {
+    t.Errorf("Expected 5:1 (offset 23) in %q, got %+v in %q", "| wc", start, d.Source)
+  }
+}
@@ -0,0 +1,447 @@
+package executor
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "regexp"
+  "strconv"
+  "strings"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// runTest implements test and [. Like POSIX test, what the arguments mean
+// depends first on how many there are; beyond four they are parsed as an
+// expression with !, -a, -o and parentheses.
+func runTest(name string, args []string, stderr io.Writer) int {
+  if name == "[" {
+    if len(args) == 0 || args[len(args)-1] != "]" {
+      fmt.Fprintln(stderr, "[: missing ']'")
+      return 2
+    }
+    args = args[:len(args)-1]
+  }
+
+  result, err := evalTestArgs(args)
+  if err != nil {
+    fmt.Fprintf(stderr, "%s: %s\n", name, err.Error())
+    return 2
+  }
+  return testStatus(result)
+}
+
+func testStatus(result bool) int {
+  if result {
+    return 0
+  }
+  return 1
+}
+
+func evalTestArgs(args []string) (bool, error) {
+  switch len(args) {
+  case 0:
+    return false, nil
+  case 1:
+    return args[0] != "", nil
+  case 2:
+    if args[0] == "!" {
+      result, err := evalTestArgs(args[1:])
+      return !result, err
+    }
+    if parser.UnaryCondOps[args[0]] {
+      return unaryTest(args[0], args[1])
+    }
+    return false, fmt.Errorf("%s: unary operator expected", args[0])
+  case 3:
+    if isTestBinaryOp(args[1]) {
+      return binaryTest(args[1], args[0], args[2])
+    }
+    if args[1] == "-a" || args[1] == "-o" {
+      left, right := args[0] != "", args[2] != ""
+      if args[1] == "-a" {
+        return left && right, nil
+      }
+      return left || right, nil
+    }
+    if args[0] == "!" {
+      result, err := evalTestArgs(args[1:])
+      return !result, err
+    }
+    if args[0] == "(" && args[2] == ")" {
+      return evalTestArgs(args[1:2])
+    }
+    return false, fmt.Errorf("%s: binary operator expected", args[1])
+  case 4:
+    if args[0] == "!" {
+      result, err := evalTestArgs(args[1:])
+      return !result, err
+    }
+    if args[0] == "(" && args[3] == ")" {
+      return evalTestArgs(args[1:3])
+    }
+  }
+
+  p := &testParser{args: args}
+  result, err := p.or()
+  if err == nil && p.pos < len(args) {
+    err = fmt.Errorf("%s: too many arguments", args[p.pos])
+  }
+  return result, err
+}
+
+// isTestBinaryOp is a binary operator test understands; =~ is only for [[
+func isTestBinaryOp(op string) bool {
+  return parser.BinaryCondOps[op] && op != "=~"
+}
+
+type testParser struct {
+  args []string
+  pos  int
+}
+
+func (p *testParser) peek(offset int) string {
+  if p.pos+offset < len(p.args) {
+    return p.args[p.pos+offset]
+  }
+  return ""
+}
+
+func (p *testParser) or() (bool, error) {
+  result, err := p.and()
+  for err == nil && p.peek(0) == "-o" {
+    p.pos++
+    var right bool
+    right, err = p.and()
+    result = result || right
+  }
+  return result, err
+}
+
+func (p *testParser) and() (bool, error) {
+  result, err := p.not()
+  for err == nil && p.peek(0) == "-a" {
+    p.pos++
+    var right bool
+    right, err = p.not()
+    result = result && right
+  }
+  return result, err
+}
+
+func (p *testParser) not() (bool, error) {
+  if p.peek(0) == "!" && p.pos+1 < len(p.args) {
+    p.pos++
+    result, err := p.not()
+    return !result, err
+  }
+  return p.primary()
+}
+
+func (p *testParser) primary() (bool, error) {
+  if p.pos >= len(p.args) {
+    return false, fmt.Errorf("argument expected")
+  }
+
+  arg := p.peek(0)
+  if arg == "(" && !isTestBinaryOp(p.peek(1)) {
+    p.pos++
+    result, err := p.or()
+    if err != nil {
+      return false, err
+    }
+    if p.peek(0) != ")" {
+      return false, fmt.Errorf("')' expected")
+    }
+    p.pos++
+    return result, nil
+  }
+
+  if isTestBinaryOp(p.peek(1)) && p.pos+2 < len(p.args) {
+    p.pos += 3
+    return binaryTest(p.args[p.pos-2], arg, p.args[p.pos-1])
+  }
+  if parser.UnaryCondOps[arg] && p.pos+1 < len(p.args) {
+    p.pos += 2
+    return unaryTest(arg, p.args[p.pos-1])
+  }
+  p.pos++
+  return arg != "", nil
+}
+
+// unaryTest evaluates a one-operand test such as -f file or -z string
+func unaryTest(op, operand string) (bool, error) {
+  switch op {
+  case "-z":
+    return operand == "", nil
+  case "-n":
+    return operand != "", nil
+  case "-v":
+    _, ok := lookupBraced(operand)
+    return ok, nil
+  case "-o", "-R":
+    // No shell options or namerefs to speak of yet
+    return false, nil
+  case "-t":
+    fd, err := strconv.Atoi(operand)
+    if err != nil {
+      return false, fmt.Errorf("%s: integer expression expected", operand)
+    }
+    if fd < 0 || (fd > 2 && !validFd(fd)) {
+      return false, nil
+    }
+    file, err := fdFile(fd)
+    return err == nil && IsTerminal(file), nil
+  case "-r":
+    return fileAccess(operand, 4), nil
+  case "-w":
+    return fileAccess(operand, 2), nil
+  case "-x":
+    return fileAccess(operand, 1), nil
+  }
+
+  stat := os.Stat
+  if op == "-h" || op == "-L" {
+    stat = os.Lstat
+  }
+  info, err := stat(operand)
+  if err != nil {
+    return false, nil
+  }
+
+  mode := info.Mode()
+  switch op {
+  case "-a", "-e":
+    return true, nil
+  case "-b":
+    return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0, nil
+  case "-c":
+    return mode&os.ModeCharDevice != 0, nil
+  case "-d":
+    return mode.IsDir(), nil
+  case "-f":
+    return mode.IsRegular(), nil
+  case "-g":
+    return mode&os.ModeSetgid != 0, nil
+  case "-h", "-L":
+    return mode&os.ModeSymlink != 0, nil
+  case "-k":
+    return mode&os.ModeSticky != 0, nil
+  case "-p":
+    return mode&os.ModeNamedPipe != 0, nil
+  case "-s":
+    return info.Size() > 0, nil
+  case "-S":
+    return mode&os.ModeSocket != 0, nil
+  case "-u":
+    return mode&os.ModeSetuid != 0, nil
+  case "-O":
+    return ownedBy(info, false), nil
+  case "-G":
+    return ownedBy(info, true), nil
+  case "-N":
+    return modifiedSinceRead(info), nil
+  }
+  return false, fmt.Errorf("%s: unary operator expected", op)
+}
+
+// binaryTest evaluates a two-operand test on plain strings
+func binaryTest(op, left, right string) (bool, error) {
+  switch op {
+  case "=", "==":
+    return left == right, nil
+  case "!=":
+    return left != right, nil
+  case "<":
+    return left < right, nil
+  case ">":
+    return left > right, nil
+  case "-eq", "-ne", "-lt", "-le", "-gt", "-ge":
+    l, err := testInteger(left)
+    if err != nil {
+      return false, err
+    }
+    r, err := testInteger(right)
+    if err != nil {
+      return false, err
+    }
+    switch op {
+    case "-eq":
+      return l == r, nil
+    case "-ne":
+      return l != r, nil
+    case "-lt":
+      return l < r, nil
+    case "-le":
+      return l <= r, nil
+    case "-gt":
+      return l > r, nil
+    default:
+      return l >= r, nil
+    }
+  case "-nt", "-ot", "-ef":
+    l, lerr := os.Stat(left)
+    r, rerr := os.Stat(right)
+    switch op {
+    case "-nt":
+      return lerr == nil && (rerr != nil || l.ModTime().After(r.ModTime())), nil
+    case "-ot":
+      return rerr == nil && (lerr != nil || l.ModTime().Before(r.ModTime())), nil
+    default:
+      return lerr == nil && rerr == nil && os.SameFile(l, r), nil
+    }
+  }
+  return false, fmt.Errorf("%s: binary operator expected", op)
+}
+
+func testInteger(s string) (int64, error) {
+  n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+  if err != nil {
+    return 0, fmt.Errorf("%s: integer expression expected", s)
+  }
+  return n, nil
+}
+
+// WrapConditional makes a [[ ... ]] command runnable. It runs in the shell
+// like a builtin, its status being that of the expression.
+func WrapConditional(command *parser.Command) Runnable {
+  status := 0
+  return Runnable {
+    isBuiltin: true,
+    Start: func(stdin io.Reader, stdout, stderr io.Writer) {
+      result, err := evalCond(command.Cond)
+      if err != nil {
+        fmt.Fprintf(stderr, "[[: %s\n", err.Error())
+        status = 2
+        return
+      }
+      status = testStatus(result)
+    },
+    Wait: func() int {
+      return status
+    },
+  }
+}
+
+// evalCond evaluates a [[ ]] expression. Operands are expanded but neither
+// split nor globbed; the right side of == and != is a glob pattern and that
+// of =~ an extended regex, quoted parts of either matching literally.
+func evalCond(expr *parser.CondExpr) (bool, error) {
+  switch expr.Op {
+  case "&&", "||":
+    left, err := evalCond(expr.Left)
+    if err != nil || left == (expr.Op == "||") {
+      return left, err
+    }
+    return evalCond(expr.Right)
+  case "!":
+    result, err := evalCond(expr.Left)
+    return !result, err
+  case "":
+    return expandUnsplit(expr.Args[0]) != "", nil
+  case "=", "==", "!=":
+    re, err := regexp.Compile("(?s)^" + condPattern(expr.Args[1], false) + "$")
+    if err != nil {
+      return false, err
+    }
+    matched := re.MatchString(expandUnsplit(expr.Args[0]))
+    return matched == (expr.Op != "!="), nil
+  case "=~":
+    re, err := regexp.Compile(condPattern(expr.Args[1], true))
+    if err != nil {
+      return false, fmt.Errorf("%s: invalid regular expression", expandUnsplit(expr.Args[1]))
+    }
+    match := re.FindStringSubmatch(expandUnsplit(expr.Args[0]))
+    if match == nil {
+      SetArray("BASH_REMATCH", []string{})
+      return false, nil
+    }
+    SetArray("BASH_REMATCH", match)
+    return true, nil
+  }
+
+  if len(expr.Args) == 1 {
+    return unaryTest(expr.Op, expandUnsplit(expr.Args[0]))
+  }
+  return binaryTest(expr.Op, expandUnsplit(expr.Args[0]), expandUnsplit(expr.Args[1]))
+}
+
+// expandUnsplit expands a word into a single string, as happens inside
+// [[ ]] and for assignments: no field splitting, "$@" joined with spaces
+func expandUnsplit(parts []lexer.WordPart) string {
+  var out strings.Builder
+  for _, part := range expandTildePrefix(parts) {
+    if part.Kind == lexer.ExpansionPart {
+      out.WriteString(Expand(part.Text))
+    } else {
+      out.WriteString(part.Text)
+    }
+  }
+  return out.String()
+}
+
+// condPattern builds a regexp from a [[ ]] pattern word. Unquoted text and
+// expansions are pattern syntax, a glob or with regex the regexp itself;
+// quoted text always matches literally.
+func condPattern(parts []lexer.WordPart, regex bool) string {
+  var out strings.Builder
+  for _, part := range parts {
+    text := part.Text
+    if part.Kind == lexer.ExpansionPart {
+      text = Expand(text)
+    }
+    quoted := part.Kind == lexer.SingleQuotedPart || part.Kind == lexer.DoubleQuotedPart || part.Quoted
+    switch {
+    case quoted:
+      out.WriteString(regexp.QuoteMeta(text))
+    case regex:
+      out.WriteString(text)
+    default:
+      out.WriteString(globToRegexp(text))
+    }
+  }
+  return out.String()
+}
+
+// globToRegexp translates the glob wildcards * ? and [...] to regexp syntax.
+// As in [[ ]] matching, * also matches slashes.
+func globToRegexp(glob string) string {
+  var out strings.Builder
+  for i := 0; i < len(glob); i++ {
+    switch c := glob[i]; c {
+    case '*':
+      out.WriteString(".*")
+    case '?':
+      out.WriteString(".")
+    case '[':
+      end := i + 1
+      if end < len(glob) && (glob[end] == '!' || glob[end] == '^') {
+        end++
+      }
+      if end < len(glob) && glob[end] == ']' {
+        end++
+      }
+      for end < len(glob) && glob[end] != ']' {
+        end++
+      }
+      if end >= len(glob) {
+        out.WriteString(`\[`)
+        continue
+      }
+
+      class := glob[i+1 : end]
+      out.WriteByte('[')
+      if class[0] == '!' || class[0] == '^' {
+        out.WriteByte('^')
+        class = class[1:]
+      }
+      out.WriteString(strings.ReplaceAll(class, `\`, `\\`))
+      out.WriteByte(']')
+      i = end
+    default:
+      out.WriteString(regexp.QuoteMeta(string(c)))
+    }
+  }
+  return out.String()
+}
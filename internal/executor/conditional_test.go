@@ -0,0 +1,144 @@
+package executor
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "reflect"
+  "testing"
+  "time"
+)
+
+func TestTestBuiltin(t *testing.T) {
+  dir := t.TempDir()
+  file := filepath.Join(dir, "file")
+  older := filepath.Join(dir, "older")
+  empty := filepath.Join(dir, "empty")
+  os.WriteFile(file, []byte("data"), 0644)
+  os.WriteFile(older, []byte("data"), 0644)
+  os.WriteFile(empty, []byte{}, 0600)
+  past := time.Now().Add(-time.Hour)
+  os.Chtimes(older, past, past)
+  os.Symlink(file, filepath.Join(dir, "link"))
+
+  tests := []struct {
+    name     string
+    command  string
+    args     []string
+    expected int
+  }{
+    {"No arguments", "test", []string{}, 1},
+    {"Non-empty string", "test", []string{"x"}, 0},
+    {"Empty string", "test", []string{""}, 1},
+    {"Lone operator is a string", "test", []string{"-f"}, 0},
+    {"Zero length", "test", []string{"-z", ""}, 0},
+    {"Non-zero length", "test", []string{"-n", ""}, 1},
+    {"Negation", "test", []string{"!", "-z", "x"}, 0},
+    {"Directory", "test", []string{"-d", dir}, 0},
+    {"Regular file", "test", []string{"-f", file}, 0},
+    {"Directory isn't a file", "test", []string{"-f", dir}, 1},
+    {"Missing file", "test", []string{"-e", filepath.Join(dir, "missing")}, 1},
+    {"Non-empty file", "test", []string{"-s", file}, 0},
+    {"Empty file", "test", []string{"-s", empty}, 1},
+    {"Symlink", "test", []string{"-L", filepath.Join(dir, "link")}, 0},
+    {"Not a symlink", "test", []string{"-h", file}, 1},
+    {"Readable", "test", []string{"-r", file}, 0},
+    {"Not executable", "test", []string{"-x", file}, 1},
+    {"String equality", "test", []string{"a", "=", "a"}, 0},
+    {"String inequality", "test", []string{"a", "!=", "a"}, 1},
+    {"String ordering", "test", []string{"a", "<", "b"}, 0},
+    {"Integer comparison", "test", []string{"10", "-gt", "9"}, 0},
+    {"Integer equality", "test", []string{" 3", "-eq", "3"}, 0},
+    {"Bad integer", "test", []string{"a", "-eq", "1"}, 2},
+    {"Newer file", "test", []string{file, "-nt", older}, 0},
+    {"Older file", "test", []string{file, "-ot", older}, 1},
+    {"Same file", "test", []string{file, "-ef", filepath.Join(dir, "link")}, 0},
+    {"Binary and", "test", []string{"a", "-a", ""}, 1},
+    {"Binary or", "test", []string{"a", "-o", ""}, 0},
+    {"Parenthesized", "test", []string{"(", "x", ")"}, 0},
+    {"Negated comparison", "test", []string{"!", "a", "=", "b"}, 0},
+    {"Long expression", "test", []string{"-n", "a", "-a", "1", "-eq", "2", "-o", "-d", dir}, 0},
+    {"And binds tighter", "test", []string{"x", "-o", "x", "-a", ""}, 0},
+    {"Grouping", "test", []string{"(", "x", "-o", "x", ")", "-a", ""}, 1},
+    {"Unbalanced parenthesis", "test", []string{"(", "a", "-a", "b", "-a", "c"}, 2},
+    {"Unknown operator", "test", []string{"a", "-zz", "b"}, 2},
+    {"Bracket", "[", []string{"a", "=", "a", "]"}, 0},
+    {"Bracket missing close", "[", []string{"a", "=", "a"}, 2},
+    {"Empty bracket", "[", []string{"]"}, 1},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var errOut bytes.Buffer
+      status := runTest(test.command, test.args, &errOut)
+      if status != test.expected {
+        t.Errorf("%s %q returned %d, expected %d (%s)", test.command, test.args, status, test.expected, errOut.String())
+      }
+    })
+  }
+}
+
+func TestConditional(t *testing.T) {
+  t.Setenv("HARSH_TEST_VAR", "hello world")
+  defer delete(Arrays, "BASH_REMATCH")
+
+  tests := []struct {
+    name     string
+    line     string
+    expected int
+  }{
+    {"Unsplit variable", "[[ $HARSH_TEST_VAR ]]", 0},
+    {"Unset variable", "[[ $HARSH_TEST_UNSET ]]", 1},
+    {"No splitting in comparison", "[[ $HARSH_TEST_VAR == 'hello world' ]]", 0},
+    {"Glob match", "[[ $HARSH_TEST_VAR == hello* ]]", 0},
+    {"Glob crosses slashes", "[[ a/b/c == a*c ]]", 0},
+    {"Quoted pattern is literal", "[[ $HARSH_TEST_VAR == \"hello*\" ]]", 1},
+    {"Escaped star is literal", "[[ abc == \\* ]]", 1},
+    {"Escaped star matches a star", "[[ * == \\* ]]", 0},
+    {"Escaped parenthesis is a word", "[[ '(' == \\( ]]", 0},
+    {"Glob mismatch", "[[ abc != a?c ]]", 1},
+    {"Bracket class", "[[ b == [a-c] ]]", 0},
+    {"Negated class", "[[ b == [!a-c] ]]", 1},
+    {"String ordering", "[[ apple < banana ]]", 0},
+    {"And", "[[ -n a && -z '' ]]", 0},
+    {"Or", "[[ -z a || -n a ]]", 0},
+    {"Not", "[[ ! -z a ]]", 0},
+    {"Parentheses", "[[ ! ( a == b || c == c ) ]]", 1},
+    {"Unspaced parentheses", "[[ (a == a) ]]", 0},
+    {"Regex group next to a word", "[[ ab =~ a(b|c)$ ]]", 0},
+    {"Integer comparison", "[[ 2 -lt 10 ]]", 0},
+    {"File test", "[[ -d / ]]", 0},
+    {"Regex", "[[ abc123 =~ ^[a-z]+[0-9]+$ ]]", 0},
+    {"Regex alternation", "[[ xb =~ a|b ]]", 0},
+    {"Quoted regex is literal", "[[ a.c =~ 'a.c' && abc =~ 'a.c' ]]", 1},
+    {"Invalid regex", "[[ a =~ ( ]]", 2},
+    {"Bad integer", "[[ a -eq 1 ]]", 2},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      status, err := Run(test.line)
+      if err != nil {
+        t.Fatalf("Run(%q) failed: %v", test.line, err)
+      }
+      if status != test.expected {
+        t.Errorf("Run(%q) = %d, expected %d", test.line, status, test.expected)
+      }
+    })
+  }
+}
+
+func TestConditionalRematch(t *testing.T) {
+  defer delete(Arrays, "BASH_REMATCH")
+
+  Run("[[ key=value =~ ^([a-z]+)=(.*)$ ]]")
+  expected := []string{"key=value", "key", "value"}
+  if !reflect.DeepEqual(Arrays["BASH_REMATCH"], expected) {
+    t.Errorf("BASH_REMATCH = %q, expected %q", Arrays["BASH_REMATCH"], expected)
+  }
+
+  Run("[[ nothing =~ ^[0-9]+$ ]]")
+  if len(Arrays["BASH_REMATCH"]) != 0 {
+    t.Errorf("BASH_REMATCH = %q after a failed match, expected it empty", Arrays["BASH_REMATCH"])
+  }
+}
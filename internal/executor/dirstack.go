@@ -0,0 +1,248 @@
+package executor
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "strconv"
+  "strings"
+)
+
+// DirStack holds the directories saved by pushd, most recent first. The
+// current directory is the implicit top, so entry N of the stack as dirs
+// shows it is DirStack[N-1].
+var DirStack []string
+
+// dirStackEntries is the full stack as dirs and $DIRSTACK see it, the
+// current directory first
+func dirStackEntries() []string {
+  cwd, err := WorkingDir()
+  if err != nil {
+    cwd = os.Getenv("PWD")
+  }
+  return append([]string{cwd}, DirStack...)
+}
+
+// stackIndex converts a +N or -N argument, counting from the left or right
+// of the dirs listing, to an index into the full stack
+func stackIndex(arg string, size int) (int, bool, error) {
+  if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+    return 0, false, nil
+  }
+  n, err := strconv.Atoi(arg[1:])
+  if err != nil || n < 0 {
+    return 0, false, nil
+  }
+  if n >= size {
+    return 0, true, fmt.Errorf("%s: directory stack index out of range", arg)
+  }
+  if arg[0] == '-' {
+    n = size - 1 - n
+  }
+  return n, true, nil
+}
+
+// tildePath abbreviates the home directory to ~ for display
+func tildePath(dir string) string {
+  home := os.Getenv("HOME")
+  if home == "" || home == "/" {
+    return dir
+  }
+  if dir == home {
+    return "~"
+  }
+  if strings.HasPrefix(dir, home+"/") {
+    return "~" + dir[len(home):]
+  }
+  return dir
+}
+
+func printDirStack(stdout io.Writer) {
+  entries := dirStackEntries()
+  for i, dir := range entries {
+    entries[i] = tildePath(dir)
+  }
+  fmt.Fprintln(stdout, strings.Join(entries, " "))
+}
+
+// runPushd implements pushd: with a directory, save the current one and
+// change to it; with +N or -N, rotate the stack to bring that entry to the
+// top; with nothing, swap the top two. -n only updates the stack.
+func runPushd(args []string, stdout, stderr io.Writer) int {
+  noChdir := false
+  if len(args) > 0 && args[0] == "-n" {
+    noChdir = true
+    args = args[1:]
+  }
+  if len(args) > 0 && args[0] == "--" {
+    args = args[1:]
+  }
+  if len(args) > 1 {
+    fmt.Fprintln(stderr, "pushd: too many arguments")
+    return 1
+  }
+
+  entries := dirStackEntries()
+  if len(args) == 0 {
+    if len(DirStack) == 0 {
+      fmt.Fprintln(stderr, "pushd: no other directory")
+      return 1
+    }
+    if !noChdir {
+      if _, err := setWorkingDir(DirStack[0], false); err != nil {
+        fmt.Fprintf(stderr, "pushd: %s: %s\n", DirStack[0], errorText(err))
+        return 1
+      }
+      DirStack[0] = entries[0]
+    }
+    printDirStack(stdout)
+    return 0
+  }
+
+  n, isIndex, err := stackIndex(args[0], len(entries))
+  if err != nil {
+    fmt.Fprintf(stderr, "pushd: %s\n", err.Error())
+    return 1
+  }
+
+  if isIndex {
+    if noChdir {
+      // Rotate only what's below the current directory
+      rest := entries[1:]
+      if n > 0 {
+        DirStack = append(append([]string{}, rest[n-1:]...), rest[:n-1]...)
+      }
+    } else {
+      rotated := append(append([]string{}, entries[n:]...), entries[:n]...)
+      if _, err := setWorkingDir(rotated[0], false); err != nil {
+        fmt.Fprintf(stderr, "pushd: %s: %s\n", rotated[0], errorText(err))
+        return 1
+      }
+      DirStack = rotated[1:]
+    }
+    printDirStack(stdout)
+    return 0
+  }
+
+  dir := args[0]
+  if noChdir {
+    DirStack = append([]string{dir}, DirStack...)
+  } else {
+    if _, err := setWorkingDir(dir, false); err != nil {
+      fmt.Fprintf(stderr, "pushd: %s: %s\n", dir, errorText(err))
+      return 1
+    }
+    DirStack = append([]string{entries[0]}, DirStack...)
+  }
+  printDirStack(stdout)
+  return 0
+}
+
+// runPopd implements popd: drop the top of the stack and change to the new
+// top, or with +N or -N drop that entry instead. -n only updates the stack.
+func runPopd(args []string, stdout, stderr io.Writer) int {
+  noChdir := false
+  if len(args) > 0 && args[0] == "-n" {
+    noChdir = true
+    args = args[1:]
+  }
+  if len(DirStack) == 0 {
+    fmt.Fprintln(stderr, "popd: directory stack empty")
+    return 1
+  }
+
+  n := 0
+  if len(args) > 0 {
+    var isIndex bool
+    var err error
+    n, isIndex, err = stackIndex(args[0], len(DirStack)+1)
+    if err != nil {
+      fmt.Fprintf(stderr, "popd: %s\n", err.Error())
+      return 1
+    }
+    if !isIndex {
+      fmt.Fprintf(stderr, "popd: %s: invalid argument\npopd: usage: popd [-n] [+N | -N]\n", args[0])
+      return 2
+    }
+  }
+
+  switch {
+  case n > 0:
+    DirStack = append(DirStack[:n-1:n-1], DirStack[n:]...)
+  case noChdir:
+    DirStack = DirStack[1:]
+  default:
+    if _, err := setWorkingDir(DirStack[0], false); err != nil {
+      fmt.Fprintf(stderr, "popd: %s: %s\n", DirStack[0], errorText(err))
+      return 1
+    }
+    DirStack = DirStack[1:]
+  }
+  printDirStack(stdout)
+  return 0
+}
+
+// runDirs implements dirs. -c clears the stack, -l shows full paths instead
+// of ~, -p puts one entry per line and -v numbers them; +N or -N shows just
+// that entry.
+func runDirs(args []string, stdout, stderr io.Writer) int {
+  long, perLine, numbered := false, false, false
+  selected := -1
+  for _, arg := range args {
+    if n, isIndex, err := stackIndex(arg, len(DirStack)+1); isIndex {
+      if err != nil {
+        fmt.Fprintf(stderr, "dirs: %s\n", err.Error())
+        return 1
+      }
+      selected = n
+      continue
+    }
+    if len(arg) < 2 || arg[0] != '-' {
+      fmt.Fprintf(stderr, "dirs: %s: invalid argument\ndirs: usage: dirs [-clpv] [+N] [-N]\n", arg)
+      return 2
+    }
+    for _, flag := range arg[1:] {
+      switch flag {
+      case 'c':
+        DirStack = nil
+      case 'l':
+        long = true
+      case 'p':
+        perLine = true
+      case 'v':
+        perLine, numbered = true, true
+      default:
+        fmt.Fprintf(stderr, "dirs: -%c: invalid option\ndirs: usage: dirs [-clpv] [+N] [-N]\n", flag)
+        return 2
+      }
+    }
+  }
+
+  entries := dirStackEntries()
+  if !long {
+    for i, dir := range entries {
+      entries[i] = tildePath(dir)
+    }
+  }
+  if selected >= 0 {
+    if selected >= len(entries) {
+      fmt.Fprintln(stderr, "dirs: directory stack index out of range")
+      return 1
+    }
+    fmt.Fprintln(stdout, entries[selected])
+    return 0
+  }
+
+  if !perLine {
+    fmt.Fprintln(stdout, strings.Join(entries, " "))
+    return 0
+  }
+  for i, dir := range entries {
+    if numbered {
+      fmt.Fprintf(stdout, "%2d  %s\n", i, dir)
+    } else {
+      fmt.Fprintln(stdout, dir)
+    }
+  }
+  return 0
+}
@@ -0,0 +1,154 @@
+package executor
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+)
+
+// dirStackFixture makes directories a, b and c under a temp HOME, starts the
+// test there with an empty stack and returns HOME
+func dirStackFixture(t *testing.T) string {
+  home, err := filepath.EvalSymlinks(t.TempDir())
+  if err != nil {
+    t.Fatal(err)
+  }
+  for _, dir := range []string{"a", "b", "c"} {
+    os.Mkdir(filepath.Join(home, dir), 0755)
+  }
+  t.Setenv("HOME", home)
+  t.Setenv("OLDPWD", "")
+  t.Chdir(home)
+  t.Setenv("PWD", home)
+
+  saved := DirStack
+  DirStack = nil
+  t.Cleanup(func() { DirStack = saved })
+  return home
+}
+
+func TestDirStack(t *testing.T) {
+  tests := []struct {
+    name     string
+    steps    [][]string
+    expected string
+    status   int
+  }{
+    {"Push", [][]string{{"pushd", "a"}}, "~/a ~\n", 0},
+    {"Push several", [][]string{{"pushd", "a"}, {"pushd", "../b"}, {"pushd", "../c"}}, "~/c ~/b ~/a ~\n", 0},
+    {"Swap", [][]string{{"pushd", "a"}, {"pushd", "../b"}, {"pushd"}}, "~/a ~/b ~\n", 0},
+    {"Rotate left", [][]string{{"pushd", "a"}, {"pushd", "../b"}, {"pushd", "../c"}, {"pushd", "+2"}}, "~/a ~ ~/c ~/b\n", 0},
+    {"Rotate right", [][]string{{"pushd", "a"}, {"pushd", "../b"}, {"pushd", "../c"}, {"pushd", "-0"}}, "~ ~/c ~/b ~/a\n", 0},
+    {"Push without cd", [][]string{{"pushd", "a"}, {"pushd", "-n", "/tmp"}}, "~/a /tmp ~\n", 0},
+    {"Pop", [][]string{{"pushd", "a"}, {"pushd", "../b"}, {"popd"}}, "~/a ~\n", 0},
+    {"Pop entry", [][]string{{"pushd", "a"}, {"pushd", "../b"}, {"popd", "+1"}}, "~/b ~\n", 0},
+    {"Pop from the right", [][]string{{"pushd", "a"}, {"pushd", "../b"}, {"popd", "-0"}}, "~/b ~/a\n", 0},
+    {"Pop without cd", [][]string{{"pushd", "a"}, {"pushd", "../b"}, {"popd", "-n"}}, "~/b ~\n", 0},
+    {"Pop empty", [][]string{{"popd"}}, "", 1},
+    {"Swap empty", [][]string{{"pushd"}}, "", 1},
+    {"Index out of range", [][]string{{"pushd", "a"}, {"pushd", "+5"}}, "", 1},
+    {"Missing directory", [][]string{{"pushd", "nope"}}, "", 1},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      dirStackFixture(t)
+      var out, errOut bytes.Buffer
+      status := 0
+      for _, step := range test.steps {
+        out.Reset()
+        if step[0] == "pushd" {
+          status = runPushd(step[1:], &out, &errOut)
+        } else {
+          status = runPopd(step[1:], &out, &errOut)
+        }
+      }
+
+      if out.String() != test.expected || status != test.status {
+        t.Errorf("Got %q (%d), expected %q (%d); errors: %s", out.String(), status, test.expected, test.status, errOut.String())
+      }
+      // The top of the stack is always where we are
+      if top := dirStackEntries()[0]; top != os.Getenv("PWD") {
+        t.Errorf("Stack top %q isn't PWD %q", top, os.Getenv("PWD"))
+      }
+    })
+  }
+}
+
+func TestDirs(t *testing.T) {
+  home := dirStackFixture(t)
+  var out, errOut bytes.Buffer
+  runPushd([]string{"a"}, &out, &errOut)
+  runPushd([]string{"../b"}, &out, &errOut)
+
+  tests := []struct {
+    name     string
+    args     []string
+    expected string
+  }{
+    {"Default", []string{}, "~/b ~/a ~\n"},
+    {"Long", []string{"-l"}, home + "/b " + home + "/a " + home + "\n"},
+    {"Per line", []string{"-p"}, "~/b\n~/a\n~\n"},
+    {"Numbered", []string{"-v"}, " 0  ~/b\n 1  ~/a\n 2  ~\n"},
+    {"Entry", []string{"+1"}, "~/a\n"},
+    {"Entry from the right", []string{"-0"}, "~\n"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var out, errOut bytes.Buffer
+      runDirs(test.args, &out, &errOut)
+      if out.String() != test.expected {
+        t.Errorf("dirs %q = %q, expected %q", test.args, out.String(), test.expected)
+      }
+    })
+  }
+
+  runDirs([]string{"-c"}, &out, &errOut)
+  if len(DirStack) != 0 {
+    t.Errorf("dirs -c left %q on the stack", DirStack)
+  }
+}
+
+func TestTildeExpansion(t *testing.T) {
+  home := dirStackFixture(t)
+  var out, errOut bytes.Buffer
+  runPushd([]string{"a"}, &out, &errOut)
+  runPushd([]string{"../b"}, &out, &errOut)
+
+  tests := []struct {
+    name     string
+    word     string
+    expected string
+  }{
+    {"Home", "~", home},
+    {"Home prefix", "~/x", home + "/x"},
+    {"PWD", "~+", home + "/b"},
+    {"OLDPWD", "~-", home + "/a"},
+    {"Stack entry", "~1", home + "/a"},
+    {"Stack entry with plus", "~+2/x", home + "/x"},
+    {"Stack entry from the right", "~-0", home},
+    {"Out of range", "~9", "~9"},
+    {"Unknown user", "~harsh-no-such-user", "~harsh-no-such-user"},
+    {"Quoted", "'~'", "~"},
+    {"Not at the start", "a~", "a~"},
+    {"DIRSTACK", "${DIRSTACK[2]}", home},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      tokens, err := lexer.NewLexer(test.word).Lex()
+      if err != nil {
+        t.Fatalf("Unexpected lexer error: %v", err)
+      }
+      result := strings.Join(ExpandWord(tokens[0].Parts), " ")
+      if result != test.expected {
+        t.Errorf("ExpandWord(%s) = %q, expected %q", test.word, result, test.expected)
+      }
+    })
+  }
+}
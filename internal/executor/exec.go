@@ -0,0 +1,126 @@
+package executor
+
+import (
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "strings"
+
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// program is a file to execute and its argv
+type program struct {
+  path string
+  argv []string
+}
+
+const execUsage = "exec: usage: exec [-cl] [-a name] [command [argument ...]] [redirection ...]"
+
+// runExec implements exec. With a command the shell is replaced by it,
+// keeping the shell's descriptors and environment; -c empties the
+// environment, -a sets argv[0] and -l prefixes it with a dash like a login
+// shell. With only redirections they apply to the shell itself.
+func runExec(command *parser.Command, stdin io.Reader, stdout, stderr io.Writer) int {
+  args := command.Args
+  clearEnv, login, argv0 := false, false, ""
+  for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+    arg := args[0]
+    args = args[1:]
+    if arg == "--" {
+      break
+    }
+    for i := 1; i < len(arg); i++ {
+      switch arg[i] {
+      case 'c':
+        clearEnv = true
+      case 'l':
+        login = true
+      case 'a':
+        if i+1 < len(arg) {
+          argv0 = arg[i+1:]
+        } else if len(args) > 0 {
+          argv0, args = args[0], args[1:]
+        } else {
+          fmt.Fprintf(stderr, "exec: -a: option requires an argument\n%s\n", execUsage)
+          return 2
+        }
+        i = len(arg)
+      default:
+        fmt.Fprintf(stderr, "exec: -%c: invalid option\n%s\n", arg[i], execUsage)
+        return 2
+      }
+    }
+  }
+
+  if len(args) == 0 {
+    if err := redirectShell(command.Redirs); err != nil {
+      fmt.Fprintf(stderr, "harsh: %s\n", pathErrorText(err))
+      return 1
+    }
+    return 0
+  }
+
+  name := args[0]
+  path, err := findExecutable(name)
+  if errors.Is(err, errCommandNotFound) {
+    fmt.Fprintf(stderr, "exec: %s: not found\n", name)
+    return 127
+  } else if err != nil {
+    return cannotRun(stderr, name, err)
+  }
+
+  // Only a shell whose output goes to files can be replaced; when it's
+  // being captured, as in $(exec cmd), bash would be in a subshell, so run
+  // the command and carry on
+  files := map[int]*os.File{}
+  for fd, stream := range []any{stdin, stdout, stderr} {
+    file, ok := stream.(*os.File)
+    if !ok {
+      runnable := WrapExternal(&parser.Command{Name: name, Args: args[1:]}, path)
+      runnable.Start(stdin, stdout, stderr)
+      return runnable.Wait()
+    }
+    files[fd] = file
+  }
+  for fd, file := range fdFiles {
+    if fd > 2 {
+      files[fd] = file
+    }
+  }
+
+  argv := append([]string{name}, args[1:]...)
+  if argv0 != "" {
+    argv[0] = argv0
+  }
+  if login {
+    argv[0] = "-" + argv[0]
+  }
+  env := os.Environ()
+  if clearEnv {
+    env = []string{}
+  }
+
+  programs := []program{{path: path, argv: argv}}
+  if script, err := scriptCommand(path, args[1:]); err == nil {
+    programs = append(programs, program{path: script.Path, argv: script.Args})
+  }
+  err = execProcess(programs, env, files)
+  fmt.Fprintf(stderr, "harsh: exec: %s: %s\n", path, errorText(err))
+  return 126
+}
+
+// redirectsShell reports whether command is an exec whose redirections are
+// for the shell rather than a command
+func redirectsShell(command *parser.Command) bool {
+  return command.Name == "exec" && len(command.Args) == 0
+}
+
+// unwrapExec turns exec in a pipeline into the command it names. bash runs
+// each part of a pipeline in a subshell, so that's all exec would replace.
+func unwrapExec(command *parser.Command) {
+  if command.Name == "exec" && len(command.Args) > 0 && !strings.HasPrefix(command.Args[0], "-") {
+    command.Name, command.Args = command.Args[0], command.Args[1:]
+  }
+}
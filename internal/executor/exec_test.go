@@ -0,0 +1,35 @@
+package executor
+
+import (
+  "testing"
+)
+
+func TestExec(t *testing.T) {
+  fdFixture(t)
+
+  tests := []struct {
+    name   string
+    line   string
+    output string
+    errOut string
+    status int
+  }{
+    {"Captured output runs the command", `exec sh -c 'echo replaced'`, "replaced\n", "", 0},
+    {"Status of the command", `exec sh -c 'exit 3'`, "", "", 3},
+    {"In a pipeline", "exec echo piped | cat", "piped\n", "", 0},
+    {"Not found", "exec nope", "", "exec: nope: not found\n", 127},
+    {"Not executable", "exec /dev/null", "", "harsh: /dev/null: Permission denied\n", 126},
+    {"Invalid option", "exec -x sh", "", "exec: -x: invalid option\n" + execUsage + "\n", 2},
+    {"Missing name", "exec -a", "", "exec: -a: option requires an argument\n" + execUsage + "\n", 2},
+    {"Nothing to do", "exec", "", "", 0},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      output, errOut, status := evalLine(t, test.line)
+      if output != test.output || errOut != test.errOut || status != test.status {
+        t.Errorf("%s = %q, %q (%d), expected %q, %q (%d)", test.line, output, errOut, status, test.output, test.errOut, test.status)
+      }
+    })
+  }
+}
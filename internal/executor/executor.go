@@ -1,19 +1,26 @@
 package executor
 
 import (
+  "bytes"
+  "errors"
   "fmt"
   "os"
   "os/exec"
   "strconv"
   "strings"
+  "syscall"
   "io"
-  "bufio"
 
   "github.com/cheesyhypocrisy/harsh/internal/parser"
 )
 
 var PathDirs []string
-var Hist []string
+// Hist is the command history, oldest first
+var Hist []HistEntry
+// LastStatus is the exit status of the most recent pipeline, i.e. $?
+var LastStatus int
+// PositionalArgs holds $1, $2, ... for the script or sourced file being run
+var PositionalArgs []string
 
 type builtin int
 
@@ -25,6 +32,20 @@ const (
   pwd
   cd
   history
+  dot
+  source
+  eval
+  printf
+  read
+  _test
+  bracket
+  pushd
+  popd
+  dirs
+  _command
+  _builtin
+  hash
+  _exec
 )
 
 func lookupBuiltin(command string) builtin {
@@ -41,228 +62,379 @@ func lookupBuiltin(command string) builtin {
     return cd
   case "history":
     return history
+  case ".":
+    return dot
+  case "source":
+    return source
+  case "eval":
+    return eval
+  case "printf":
+    return printf
+  case "read":
+    return read
+  case "test":
+    return _test
+  case "[":
+    return bracket
+  case "pushd":
+    return pushd
+  case "popd":
+    return popd
+  case "dirs":
+    return dirs
+  case "command":
+    return _command
+  case "builtin":
+    return _builtin
+  case "hash":
+    return hash
+  case "exec":
+    return _exec
   default:
     return unknownBuiltin
   }
 }
 
+// errCommandNotFound is what findExecutable returns when no directory on
+// PATH has the command
+var errCommandNotFound = errors.New("Executable not found in PATH")
+
+// findExecutable resolves a command name to the file to run. Names with a
+// slash are used as they are; others are looked up in the hash table, then
+// PATH. Only executable regular files will do, but if PATH only has a file
+// that can't be run, that is what's reported.
 func findExecutable(command string) (string, error) {
-  path := ""
-  for _, dir:= range PathDirs {
-    path = strings.TrimRight(dir, "/") + "/" + command
-    _, err := os.Stat(path)
-    if err == nil {
-      return path, nil
-    } else {
-      continue
+  if strings.Contains(command, "/") {
+    return command, checkExecutable(command)
+  }
+
+  if path, ok := hashLookup(command); ok {
+    return path, nil
+  }
+  path, ok := hashPath(command)
+  if ok {
+    return path, nil
+  }
+  for _, dir := range PathDirs {
+    candidate := pathCandidate(dir, command)
+    if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+      return "", checkExecutable(candidate)
     }
   }
+  return "", fmt.Errorf("%w: %s", errCommandNotFound, command)
+}
+
+// checkExecutable reports why path can't be run, if it can't
+func checkExecutable(path string) error {
+  info, err := os.Stat(path)
+  if err != nil {
+    return err
+  }
+  if info.IsDir() {
+    return &os.PathError{Op: "exec", Path: path, Err: syscall.EISDIR}
+  }
+  if !info.Mode().IsRegular() || !fileAccess(path, 1) {
+    return &os.PathError{Op: "exec", Path: path, Err: syscall.EACCES}
+  }
+  return nil
+}
 
-  return "", fmt.Errorf("Executable not found in PATH: %s", command)
+// searchPath returns every executable called command in dirs, in order
+func searchPath(command string, dirs []string) []string {
+  paths := make([]string, 0)
+  for _, dir := range dirs {
+    path := pathCandidate(dir, command)
+    if checkExecutable(path) == nil {
+      paths = append(paths, path)
+    }
+  }
+  return paths
+}
+
+// pathCandidate is where command would be in the PATH entry dir, an empty
+// entry meaning the current directory
+func pathCandidate(dir, command string) string {
+  if dir == "" {
+    dir = "."
+  }
+  return strings.TrimRight(dir, "/") + "/" + command
+}
+
+// cannotRun reports a command findExecutable failed on and returns the
+// exit status for it: 127 if there's no such command, 126 if there is but
+// it can't be executed
+func cannotRun(stderr io.Writer, name string, err error) int {
+  if errors.Is(err, errCommandNotFound) {
+    fmt.Fprintf(stderr, "%s: command not found\n", name)
+    return 127
+  }
+
+  path := name
+  var pathErr *os.PathError
+  if errors.As(err, &pathErr) {
+    path = pathErr.Path
+  }
+  fmt.Fprintf(stderr, "harsh: %s: %s\n", path, errorText(err))
+  if errors.Is(err, os.ErrNotExist) {
+    return 127
+  }
+  return 126
 }
 
 type Runnable struct {
   isBuiltin bool
   Start func(stdin io.Reader, stdout, stderr io.Writer)
-  Wait func()
+  Wait func() int
 }
 
 func WrapBuiltin(command *parser.Command) Runnable {
+  status := 0
   return Runnable {
     isBuiltin: true,
     Start: func(stdin io.Reader, stdout, stderr io.Writer) {
-      switch lookupBuiltin(command.Name) {
-      case exit:
-        // Write history to $HISTFILE if set
-        histfile, exists := os.LookupEnv("HISTFILE")
-        if exists {
-          file, err := os.OpenFile(histfile, os.O_WRONLY|os.O_CREATE, 0600)
-          if err != nil {
-            fmt.Fprintf(stderr, "Unable to write history to file %s with err: %#v\n", histfile, err.Error())
-            return
-          }
-          defer file.Close()
-
-          for i := 0; i < len(Hist); i++ {
-            fmt.Fprintf(file, "%s\n", Hist[i])
-          }
-        }
+      status = runBuiltin(command, stdin, stdout, stderr)
+    },
+    Wait: func() int {
+      return status
+    },
+  }
+}
 
-        code := 0
-        err := error(nil)
-        if len(command.Args) >= 0 {
-          code, err = strconv.Atoi(command.Args[0])
-          if err != nil {
-            fmt.Fprintln(stderr, err)
-            return
-          }
-        }
+// runBuiltin executes command in the shell process and returns its exit status
+func runBuiltin(command *parser.Command, stdin io.Reader, stdout, stderr io.Writer) int {
+  switch lookupBuiltin(command.Name) {
+  case exit:
+    // Add what's new in the history to $HISTFILE if set, leaving what other
+    // sessions wrote there. A subshell's exit leaves that to the shell.
+    if histfile := os.Getenv("HISTFILE"); histfile != "" && subshellDepth == 0 {
+      if err := historyFileOp('a', histfile); err != nil {
+        fmt.Fprintf(stderr, "Unable to write history to file %s with err: %#v\n", histfile, err.Error())
+        return 1
+      }
+    }
 
-        os.Exit(code)
-      case echo:
-        output := strings.Join(command.Args, "")
-        fmt.Fprintln(stdout, output)
-      case _type:
-        if len(command.Args) == 0 {
-          fmt.Fprintln(stderr, "Missing argument for type command")
-          return
-        }
-        if lookupBuiltin(command.Args[0]) == unknownBuiltin {
-          path, err := findExecutable(command.Args[0])
-          if err != nil {
-            fmt.Fprintf(stderr, "%s: not found\n", command.Args[0])
-          } else {
-            fmt.Fprintf(stdout, "%s is %s\n", command.Args[0], path)
-          }
-        } else {
-          fmt.Fprintf(stdout, "%s is a shell builtin\n", command.Args[0])
-        }
-      case pwd:
-        dir, err := os.Getwd()
-        if err != nil {
-          fmt.Fprintln(stderr, err)
-          return
-        }
-        fmt.Fprintln(stdout, dir)
-      case cd:
-        if len(command.Args) == 0 || command.Args[0] == "~" {
-          homeDir, exists := os.LookupEnv("HOME")
-          if !exists {
-            username := os.Getenv("USER")
-            homeDir = fmt.Sprintf("/home/%s", username)
-          }
-
-          if err := os.Chdir(homeDir); err != nil {
-            fmt.Fprintf(stderr, "cd: %s: No such file or directory\n", homeDir)
-          }
-
-          return
-        }
-        if err := os.Chdir(command.Args[0]); err != nil {
-          fmt.Fprintf(stderr, "cd: %s: No such file or directory\n", command.Args[0]) 
-        }
-      case history:
-        limit := len(Hist)
-        err := error(nil)
-        if len(command.Args) != 0 {
-          if command.Args[0] == "-r" {
-            if len(command.Args) < 2 {
-              fmt.Fprintf(stderr, "Missing history file to read from\n")
-              // TODO: This should actually read from $HISTFILE
-              return
-            }
-            filename := command.Args[1]
-            file, err := os.Open(filename)
-            if err != nil {
-              fmt.Fprintf(stderr, "Unable to read history from file %s with err: %#v\n", filename, err.Error())
-              return
-            }
-            defer file.Close()
-
-            scanner := bufio.NewScanner(file)
-            for scanner.Scan() {
-              Hist = append(Hist, scanner.Text())
-            }
-
-            if err := scanner.Err(); err != nil {
-              fmt.Fprintf(stderr, "Unable to read history from file %s with err: %#v\n", filename, err.Error())
-            }
-            return
-          } else if command.Args[0] == "-w" {
-            if len(command.Args) < 2 {
-              fmt.Fprintf(stderr, "Missing history file to write to\n")
-              // TODO: This should actually write to $HISTFILE if nothing is provided
-              return
-            }
-            filename := command.Args[1]
-            file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0600)
-            if err != nil {
-              fmt.Fprintf(stderr, "Unable to write history to file %s with err: %#v\n", filename, err.Error())
-              return
-            }
-            defer file.Close()
-
-            for i := 0; i < len(Hist); i++ {
-              fmt.Fprintf(file, "%s\n", Hist[i])
-            }
-
-            return
-          } else if command.Args[0] == "-a" {
-            if len(command.Args) < 2 {
-              fmt.Fprintf(stderr, "Missing history file to append to\n")
-              // TODO: This should actually append to $HISTFILE if nothing is provided
-              return
-            }
-            filename := command.Args[1]
-            file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-            if err != nil {
-              fmt.Fprintf(stderr, "Unable to write history to file %s with err: %#v\n", filename, err.Error())
-              return
-            }
-            defer file.Close()
-
-            start := 0
-            for i := 0; i < len(Hist)-1; i++ {
-              if strings.HasPrefix(strings.Trim(Hist[i], " "), "history -a") {
-                start = i+1
-              }
-            }
-
-            for i := start; i < len(Hist); i++ {
-              fmt.Fprintf(file, "%s\n", Hist[i])
-            }
-
-            return
-          } else {
-            limit, err = strconv.Atoi(command.Args[0])
-            if err != nil {
-              fmt.Fprintf(stderr, "%s", err.Error())
-              return
-            }
-          }
-        }
-        for i := max(0, len(Hist)-limit) ; i < len(Hist); i++ {
-          fmt.Fprintf(stdout, "%d %s\n", i+1, Hist[i])
-        }
+    // A bare exit reports the status of the last command, as POSIX asks
+    code := LastStatus
+    err := error(nil)
+    if len(command.Args) > 0 {
+      code, err = strconv.Atoi(command.Args[0])
+      if err != nil {
+        fmt.Fprintln(stderr, err)
+        return 2
       }
-    },
-    Wait: func() {
-      return
-    },
+    }
+
+    if subshellDepth > 0 {
+      panic(subshellExit{code})
+    }
+    os.Exit(code)
+  case echo:
+    return runEcho(command.Args, stdout)
+  case printf:
+    return runPrintf(command.Args, stdout, stderr)
+  case read:
+    return runRead(command.Args, stdin, stderr)
+  case _test, bracket:
+    return runTest(command.Name, command.Args, stderr)
+  case pushd:
+    return runPushd(command.Args, stdout, stderr)
+  case popd:
+    return runPopd(command.Args, stdout, stderr)
+  case dirs:
+    return runDirs(command.Args, stdout, stderr)
+  case _command:
+    return runCommand(command.Args, stdin, stdout, stderr)
+  case _builtin:
+    return runBuiltinBuiltin(command.Args, stdin, stdout, stderr)
+  case hash:
+    return runHash(command.Args, stdout, stderr)
+  case _exec:
+    return runExec(command, stdin, stdout, stderr)
+  case _type:
+    return runType(command.Args, stdout, stderr)
+  case pwd:
+    return runPwd(command.Args, stdout, stderr)
+  case cd:
+    return runCd(command.Args, stdout, stderr)
+  case history:
+    return runHistory(command.Args, stdout, stderr)
+  case dot, source:
+    if len(command.Args) == 0 {
+      fmt.Fprintf(stderr, "%s: filename argument required\n", command.Name)
+      return 2
+    }
+    filename, err := findSourceFile(command.Args[0])
+    if err != nil {
+      fmt.Fprintf(stderr, "%s: %s: file not found\n", command.Name, command.Args[0])
+      return 1
+    }
+
+    // Extra arguments become the positional parameters for the duration
+    // of the file, otherwise the caller's ones stay visible
+    if len(command.Args) > 1 {
+      saved := PositionalArgs
+      PositionalArgs = command.Args[1:]
+      defer func() { PositionalArgs = saved }()
+    }
+
+    // Interactively, a syntax error in the file is reported and the rest
+    // of it still runs; from a script it stops the file
+    status, err := SourceFile(filename, stderr, inScript)
+    if err != nil {
+      fmt.Fprintf(stderr, "harsh: %s\n", err.Error())
+      return max(status, 1)
+    }
+    return status
+  case eval:
+    line := strings.TrimSpace(strings.Join(command.Args, " "))
+    if line == "" {
+      return 0
+    }
+    status, err := Run(line)
+    if err != nil {
+      fmt.Fprintf(stderr, "eval: %s\n", err.Error())
+      return 2
+    }
+    return status
   }
+  return 0
 }
 
-func WrapExternal(command *parser.Command) Runnable {
+// WrapExternal runs command from the file at path, which findExecutable
+// found for it
+func WrapExternal(command *parser.Command, path string) Runnable {
   var cmd *exec.Cmd
+  status := 0
   return Runnable {
     Start: func(stdin io.Reader, stdout, stderr io.Writer) {
-      cmd = exec.Command(command.Name, command.Args...)
-      cmd.Stdin = stdin
-      cmd.Stdout = stdout
-      cmd.Stderr = stderr
+      cmd = exec.Command(path, command.Args...)
+      cmd.Args[0] = command.Name
+      err := startExternal(cmd, stdin, stdout, stderr)
+
+      // The kernel doesn't know how to run a text file without a #! line;
+      // POSIX says the shell should run it as a script
+      if errors.Is(err, syscall.ENOEXEC) {
+        var script *exec.Cmd
+        script, err = scriptCommand(path, command.Args)
+        if err == nil {
+          cmd = script
+          err = startExternal(cmd, stdin, stdout, stderr)
+        }
+      }
 
-      cmd.Start()
+      if err != nil {
+        fmt.Fprintf(stderr, "harsh: %s: %s\n", path, errorText(err))
+        status = 126
+        if errors.Is(err, os.ErrNotExist) {
+          status = 127
+        }
+        cmd = nil
+      }
     },
-    Wait: func() {
+    Wait: func() int {
       if cmd == nil {
-        return
+        return status
       }
-      cmd.Wait()
+      if err := cmd.Wait(); err != nil {
+        if exitErr, ok := err.(*exec.ExitError); ok {
+          return exitErr.ExitCode()
+        }
+        return 1
+      }
+      return 0
     },
   }
 }
 
-func Eval(commands []*parser.Command) {
+func startExternal(cmd *exec.Cmd, stdin io.Reader, stdout, stderr io.Writer) error {
+  cmd.Stdin = stdin
+  cmd.Stdout = stdout
+  cmd.Stderr = stderr
+  cmd.ExtraFiles = extraFiles()
+  return cmd.Start()
+}
+
+// ShellPath is the harsh binary, which runs scripts that have no #! line.
+// Without it they fail like any file that can't be executed.
+var ShellPath string
+
+// errBinaryFile is reported for a file the kernel refused that doesn't
+// look like a script either
+var errBinaryFile = errors.New("cannot execute binary file: Exec format error")
+
+// scriptCommand runs the file at path with a new harsh, unless it looks
+// like a binary: a NUL byte in its first line
+func scriptCommand(path string, args []string) (*exec.Cmd, error) {
+  if ShellPath == "" {
+    return nil, &os.PathError{Op: "exec", Path: path, Err: syscall.ENOEXEC}
+  }
+
+  file, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+  head := make([]byte, 80)
+  n, _ := file.Read(head)
+  head = head[:n]
+  if newline := bytes.IndexByte(head, '\n'); newline >= 0 {
+    head = head[:newline]
+  }
+  if bytes.IndexByte(head, 0) >= 0 {
+    return nil, errBinaryFile
+  }
+
+  return exec.Command(ShellPath, append([]string{path}, args...)...), nil
+}
+
+// Eval runs commands as a single pipeline and returns the exit status of the
+// last one, which is also recorded in LastStatus
+func Eval(commands []*parser.Command) int {
+  stdin, stdout, stderr := ShellStreams()
+  return EvalWith(commands, stdin, stdout, stderr)
+}
+
+// EvalWith is Eval with the pipeline's outer stdin, stdout and stderr
+// supplied by the caller, e.g. to capture output for command substitution
+func EvalWith(commands []*parser.Command, stdin io.Reader, stdout, stderr io.Writer) int {
+  outerStdin, outerStdout, outerStderr := stdin, stdout, stderr
   runnables := make([]Runnable, 0)
-  for _, command := range commands {
-    if lookupBuiltin(command.Name) != unknownBuiltin {
-      runnables = append(runnables, WrapBuiltin(command))
+  status := 0
+  // missingStatus is set when the last command couldn't be run at all
+  missingStatus := 0
+  // wrapped[i] is the command behind runnables[i], commands that weren't
+  // found have no runnable
+  wrapped := make([]*parser.Command, 0)
+  redirFailed := false
+  for i, command := range commands {
+    expandCommand(command)
+    unwrapCommand(command)
+    if len(commands) > 1 {
+      unwrapExec(command)
+    }
+    if command.Name == "" {
+      // Only assignments, or nothing left after expansion, e.g. a lone
+      // unset $VAR
+      assignVars(command.Assigns, outerStderr)
+      continue
+    }
+    assigns := expandAssignments(command.Assigns)
+    if command.Cond != nil {
+      runnables = append(runnables, WrapConditional(command))
+      wrapped = append(wrapped, command)
+    } else if lookupBuiltin(command.Name) != unknownBuiltin {
+      runnables = append(runnables, withAssignments(WrapBuiltin(command), assigns))
+      wrapped = append(wrapped, command)
     } else{
-      _, err := findExecutable(command.Name)
+      path, err := commandPath(command.Name, assigns)
       if err == nil {
-        runnables = append(runnables, WrapExternal(command))
+        runnables = append(runnables, withAssignments(WrapExternal(command, path), assigns))
+        wrapped = append(wrapped, command)
       } else {
-        fmt.Fprintf(os.Stderr, "%s: command not found\n",command.Name)
+        code := cannotRun(outerStderr, command.Name, err)
+        if i == len(commands)-1 {
+          missingStatus = code
+        }
       }
     }
   }
@@ -270,9 +442,9 @@ func Eval(commands []*parser.Command) {
   pipes := make([]*os.File, 0, 2*len(runnables))
 
   for i := 0; i < len(runnables); i++ {
-    var stdin io.Reader = os.Stdin
-    var stdout io.Writer = os.Stdout
-    var stderr io.Writer = os.Stderr
+    var stdin io.Reader = outerStdin
+    var stdout io.Writer = outerStdout
+    var stderr io.Writer = outerStderr
 
     if i > 0 {
       stdin = pipes[2*(i-1)]
@@ -284,46 +456,33 @@ func Eval(commands []*parser.Command) {
       stdout = w
     }
 
-    if i == len(runnables)-1 {
-      for _, redir := range commands[i].Redirs {
-        if redir.Type == ">" {
-          if redir.Fd == 1 {
-            file, err := os.Create(redir.FilePath)
-            if err != nil {
-              fmt.Fprint(os.Stderr, err)
-            }
-            defer file.Close()
-            stdout = file
-          } else if redir.Fd == 2 {
-            file, err := os.Create(redir.FilePath)
-            if err != nil {
-              fmt.Fprint(os.Stderr, err)
-            }
-            defer file.Close()
-            stderr = file
-          }
-        } else if redir.Type == ">>" {
-          if redir.Fd == 1 {
-            file, err := os.OpenFile(redir.FilePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-            if err != nil {
-              fmt.Fprint(os.Stderr, err)
-            }
-            defer file.Close()
-            stdout = file
-          } else if redir.Fd == 2 {
-            file, err := os.OpenFile(redir.FilePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-            if err != nil {
-              fmt.Fprint(os.Stderr, err)
-            }
-            defer file.Close()
-            stderr = file
-          }
+    // exec without a command keeps its redirections for the shell
+    fds := &streams{stdin: stdin, stdout: stdout, stderr: stderr, extra: map[int]*os.File{}}
+    if !redirectsShell(wrapped[i]) {
+      for _, redir := range wrapped[i].Redirs {
+        file, err := fds.redirect(redir)
+        if file != nil {
+          defer file.Close()
+        }
+        if err != nil {
+          fmt.Fprintf(outerStderr, "harsh: %s\n", pathErrorText(err))
+          redirFailed = true
+          break
         }
       }
-      commands[i].Redirs = []parser.Redirection{}
+      wrapped[i].Redirs = []parser.Redirection{}
+    }
+    if redirFailed {
+      break
     }
 
-    runnables[i].Start(stdin, stdout, stderr)
+    withFds(runnables[i], fds.extra).Start(fds.stdin, fds.stdout, fds.stderr)
+
+    // The writer now has its own copy of the pipe, or is done with it for a
+    // builtin; closing ours lets the reader see end of file
+    if i < len(runnables)-1 {
+      pipes[2*i+1].Close()
+    }
   }
 
   for _, pipe := range pipes {
@@ -331,7 +490,26 @@ func Eval(commands []*parser.Command) {
   }
 
   for _, r := range runnables {
-    r.Wait()
+    status = r.Wait()
+  }
+  if missingStatus != 0 {
+    status = missingStatus
+  } else if redirFailed {
+    status = 1
   }
+
+  LastStatus = status
+  return status
 }
 
+
+// openRedirection opens the file a <, > or >> redirection is to
+func openRedirection(redir parser.Redirection) (*os.File, error) {
+  if redir.Type == "<" {
+    return os.Open(redir.FilePath)
+  }
+  if redir.Type == ">>" {
+    return os.OpenFile(redir.FilePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+  }
+  return os.Create(redir.FilePath)
+}
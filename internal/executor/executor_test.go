@@ -3,8 +3,11 @@ package executor
 import (
   "testing"
   "bytes"
+  "os"
+  "path/filepath"
   "strings"
 
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
   "github.com/cheesyhypocrisy/harsh/internal/parser"
 )
 
@@ -20,6 +23,20 @@ func TestLookupBuiltin(t *testing.T) {
     {"pwd command", "pwd", pwd},
     {"cd command", "cd", cd},
     {"history command", "history", history},
+    {"dot command", ".", dot},
+    {"source command", "source", source},
+    {"eval command", "eval", eval},
+    {"printf command", "printf", printf},
+    {"read command", "read", read},
+    {"test command", "test", _test},
+    {"bracket command", "[", bracket},
+    {"pushd command", "pushd", pushd},
+    {"popd command", "popd", popd},
+    {"dirs command", "dirs", dirs},
+    {"command command", "command", _command},
+    {"builtin command", "builtin", _builtin},
+    {"hash command", "hash", hash},
+    {"exec command", "exec", _exec},
     {"unknown command", "unknown", unknownBuiltin},
   }
 
@@ -75,6 +92,101 @@ func TestFindExecutable(t *testing.T) {
   }
 }
 
+// resolutionFixture makes a dir on PATH with an executable, a file that
+// isn't executable, a directory, a script without #! and a binary one
+func resolutionFixture(t *testing.T) string {
+  dir := t.TempDir()
+  os.WriteFile(filepath.Join(dir, "tool"), []byte("#!/bin/sh\necho tool\n"), 0755)
+  os.WriteFile(filepath.Join(dir, "plain"), []byte("echo plain\n"), 0644)
+  os.Mkdir(filepath.Join(dir, "subdir"), 0755)
+  os.WriteFile(filepath.Join(dir, "script"), []byte("echo script $1\n"), 0755)
+  os.WriteFile(filepath.Join(dir, "binary"), []byte("\x7fELF\x00\x00\n"), 0755)
+
+  savedDirs, savedShell := PathDirs, ShellPath
+  PathDirs = []string{dir}
+  ShellPath = "/bin/sh"
+  t.Cleanup(func() { PathDirs, ShellPath = savedDirs, savedShell })
+  return dir
+}
+
+func TestFindExecutablePermissions(t *testing.T) {
+  dir := resolutionFixture(t)
+  other := t.TempDir()
+  os.WriteFile(filepath.Join(other, "plain"), []byte{}, 0755)
+
+  tests := []struct {
+    name     string
+    pathDirs []string
+    command  string
+    expected string
+    errText  string
+  }{
+    {"On PATH", []string{dir}, "tool", dir + "/tool", ""},
+    {"Not on PATH", []string{dir}, "nope", "", "Executable not found in PATH: nope"},
+    {"Not executable", []string{dir}, "plain", "", "exec " + dir + "/plain: permission denied"},
+    {"Executable later on PATH", []string{dir, other}, "plain", other + "/plain", ""},
+    {"Directory is skipped", []string{dir}, "subdir", "", "Executable not found in PATH: subdir"},
+    {"Path with slash", nil, dir + "/tool", dir + "/tool", ""},
+    {"Missing path", nil, dir + "/nope", dir + "/nope", "stat " + dir + "/nope: no such file or directory"},
+    {"Path not executable", nil, dir + "/plain", dir + "/plain", "exec " + dir + "/plain: permission denied"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      PathDirs = test.pathDirs
+      path, err := findExecutable(test.command)
+      errText := ""
+      if err != nil {
+        errText = err.Error()
+      }
+      if path != test.expected || errText != test.errText {
+        t.Errorf("findExecutable(%s) = %q, %q, expected %q, %q", test.command, path, errText, test.expected, test.errText)
+      }
+    })
+  }
+}
+
+func TestExternalStatus(t *testing.T) {
+  dir := resolutionFixture(t)
+
+  tests := []struct {
+    name     string
+    line     string
+    output   string
+    errOut   string
+    status   int
+  }{
+    {"Runs", "tool", "tool\n", "", 0},
+    {"Runs by path", dir + "/tool", "tool\n", "", 0},
+    {"Not found", "nope", "", "nope: command not found\n", 127},
+    {"Missing path", dir + "/nope", "", "harsh: " + dir + "/nope: No such file or directory\n", 127},
+    {"Not executable", "plain", "", "harsh: " + dir + "/plain: Permission denied\n", 126},
+    {"Directory", dir + "/subdir", "", "harsh: " + dir + "/subdir: Is a directory\n", 126},
+    {"Script without #!", "script arg", "script arg\n", "", 0},
+    {"Binary", "binary", "", "harsh: " + dir + "/binary: Cannot execute binary file: Exec format error\n", 126},
+    {"Only the last command counts", "nope | tool", "tool\n", "nope: command not found\n", 0},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      tokens, err := lexer.NewLexer(test.line).Lex()
+      if err != nil {
+        t.Fatalf("Lex(%q) failed: %v", test.line, err)
+      }
+      commands, err := parser.ParseTokens(tokens)
+      if err != nil {
+        t.Fatalf("ParseTokens(%q) failed: %v", test.line, err)
+      }
+
+      var out, errOut bytes.Buffer
+      status := EvalWith(commands, os.Stdin, &out, &errOut)
+      if out.String() != test.output || errOut.String() != test.errOut || status != test.status {
+        t.Errorf("%s = %q, %q (%d), expected %q, %q (%d)", test.line, out.String(), errOut.String(), status, test.output, test.errOut, test.status)
+      }
+    })
+  }
+}
+
 func TestWrapBuiltin(t *testing.T) {
   tests := []struct {
     name           string
@@ -88,7 +200,7 @@ func TestWrapBuiltin(t *testing.T) {
         Name: "echo",
         Args: []string{"hello", "world"},
       },
-      expectedOutput: "helloworld\n",
+      expectedOutput: "hello world\n",
       expectedError:  "",
     },
     {
@@ -109,6 +221,24 @@ func TestWrapBuiltin(t *testing.T) {
       expectedOutput: "",
       expectedError:  "Missing argument for type command\n",
     },
+    {
+      name: "Source command with no args",
+      command: &parser.Command{
+        Name: "source",
+        Args: []string{},
+      },
+      expectedOutput: "",
+      expectedError:  "source: filename argument required\n",
+    },
+    {
+      name: "Dot command with missing file",
+      command: &parser.Command{
+        Name: ".",
+        Args: []string{"/nonexistent/harshrc"},
+      },
+      expectedOutput: "",
+      expectedError:  ".: /nonexistent/harshrc: file not found\n",
+    },
   }
 
   for _, test := range tests {
@@ -0,0 +1,437 @@
+package executor
+
+import (
+  "bytes"
+  "fmt"
+  "os"
+  "os/user"
+  "strconv"
+  "strings"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// LookupVar resolves a parameter name, including the special parameters
+// ($?, $$, $#, $0, $1...) that don't live in the environment
+func LookupVar(name string) (string, bool) {
+  switch name {
+  case "?":
+    return strconv.Itoa(LastStatus), true
+  case "$":
+    return strconv.Itoa(os.Getpid()), true
+  case "#":
+    return strconv.Itoa(len(PositionalArgs)), true
+  case "0":
+    return "harsh", true
+  case "@", "*":
+    return strings.Join(PositionalArgs, " "), true
+  }
+
+  if n, err := strconv.Atoi(name); err == nil {
+    if n < 1 || n > len(PositionalArgs) {
+      return "", false
+    }
+    return PositionalArgs[n-1], true
+  }
+
+  if values, ok := arrayValues(name); ok {
+    if len(values) == 0 {
+      return "", false
+    }
+    return values[0], true
+  }
+  return os.LookupEnv(name)
+}
+
+// Arrays holds the shell's indexed arrays. They can't be exported, so unlike
+// other variables they don't live in the environment.
+var Arrays = map[string][]string{}
+
+// SetVar assigns a shell variable. Variables live in the environment for
+// now, so they're also what child processes see. Assigning PATH resets the
+// command hash table.
+func SetVar(name, value string) error {
+  if !isName(name) {
+    return fmt.Errorf("'%s': not a valid identifier", name)
+  }
+  delete(Arrays, name)
+  if name == "PATH" {
+    pathChanged(value)
+  }
+  return os.Setenv(name, value)
+}
+
+// arrayValues looks up an array, including DIRSTACK which reflects the
+// directory stack
+func arrayValues(name string) ([]string, bool) {
+  if name == "DIRSTACK" {
+    return dirStackEntries(), true
+  }
+  values, ok := Arrays[name]
+  return values, ok
+}
+
+// SetArray assigns values to the indexed array name, replacing any scalar
+// of that name
+func SetArray(name string, values []string) error {
+  if !isName(name) {
+    return fmt.Errorf("'%s': not a valid identifier", name)
+  }
+  os.Unsetenv(name)
+  Arrays[name] = values
+  return nil
+}
+
+func isName(name string) bool {
+  if name == "" || !isNameChar(name[0], true) {
+    return false
+  }
+  for i := 1; i < len(name); i++ {
+    if !isNameChar(name[i], false) {
+      return false
+    }
+  }
+  return true
+}
+
+// lookupElement resolves name[index], index being a number or @ and * for
+// all the elements
+func lookupElement(name, index string) (string, bool) {
+  values, ok := arrayValues(name)
+  if !ok {
+    if index == "0" || index == "@" || index == "*" {
+      return LookupVar(name)
+    }
+    return "", false
+  }
+  if index == "@" || index == "*" {
+    return strings.Join(values, " "), len(values) > 0
+  }
+  n, err := strconv.Atoi(Expand(index))
+  if err != nil || n < 0 || n >= len(values) {
+    return "", false
+  }
+  return values[n], true
+}
+
+// Expand performs parameter expansion and command substitution on s with
+// double-quote rules: backslash only escapes $, `, " and \ itself
+func Expand(s string) string {
+  var out strings.Builder
+  for i := 0; i < len(s); i++ {
+    switch s[i] {
+    case '\\':
+      if i+1 < len(s) && strings.IndexByte("$`\"\\", s[i+1]) >= 0 {
+        out.WriteByte(s[i+1])
+        i++
+        continue
+      }
+      out.WriteByte('\\')
+    case '`':
+      end := strings.IndexByte(s[i+1:], '`')
+      if end < 0 {
+        out.WriteString(s[i:])
+        return out.String()
+      }
+      out.WriteString(CommandOutput(s[i+1 : i+1+end]))
+      i += end + 1
+    case '$':
+      value, consumed := expandDollar(s[i:])
+      if consumed == 0 {
+        out.WriteByte('$')
+        continue
+      }
+      out.WriteString(value)
+      i += consumed - 1
+    default:
+      out.WriteByte(s[i])
+    }
+  }
+  return out.String()
+}
+
+// ExpandFilename expands a file name taken from a variable, as $ENV is: a
+// leading tilde prefix like a word's, then Expand on the rest
+func ExpandFilename(s string) string {
+  if !strings.HasPrefix(s, "~") {
+    return Expand(s)
+  }
+  prefix, rest, slash := strings.Cut(s[1:], "/")
+  dir, ok := expandTilde(prefix)
+  if !ok {
+    return Expand(s)
+  }
+  if !slash {
+    return dir
+  }
+  return dir + "/" + Expand(rest)
+}
+
+// expandDollar expands the $-construct at the start of s and returns the
+// result with the number of bytes it used; 0 means a literal '$'
+func expandDollar(s string) (string, int) {
+  if len(s) < 2 {
+    return "", 0
+  }
+
+  switch c := s[1]; {
+  case c == '(':
+    end := lexer.MatchingParen(s, 1)
+    if end < 0 {
+      return "", 0
+    }
+    return CommandOutput(s[2:end]), end + 1
+  case c == '{':
+    end := strings.IndexByte(s, '}')
+    if end < 0 {
+      return "", 0
+    }
+    return expandBraced(s[2:end]), end + 1
+  case strings.IndexByte("?$#@*", c) >= 0 || (c >= '0' && c <= '9'):
+    value, _ := LookupVar(string(c))
+    return value, 2
+  case isNameChar(c, true):
+    end := 2
+    for end < len(s) && isNameChar(s[end], false) {
+      end++
+    }
+    value, _ := LookupVar(s[1:end])
+    return value, end
+  }
+  return "", 0
+}
+
+// expandBraced handles the inside of ${...}: a plain name, an array element
+// name[i], ${#name}, ${#name[@]} and the ${name:-word} default form
+func expandBraced(inner string) string {
+  if strings.HasPrefix(inner, "#") && len(inner) > 1 {
+    name := inner[1:]
+    if strings.HasSuffix(name, "[@]") || strings.HasSuffix(name, "[*]") {
+      name = name[:len(name)-3]
+      if values, ok := arrayValues(name); ok {
+        return strconv.Itoa(len(values))
+      }
+      if _, ok := LookupVar(name); ok {
+        return "1"
+      }
+      return "0"
+    }
+    value, _ := lookupBraced(name)
+    return strconv.Itoa(len(value))
+  }
+  if idx := strings.Index(inner, ":-"); idx > 0 {
+    value, ok := lookupBraced(inner[:idx])
+    if !ok || value == "" {
+      return Expand(inner[idx+2:])
+    }
+    return value
+  }
+  value, _ := lookupBraced(inner)
+  return value
+}
+
+// lookupBraced looks up a name as written inside ${...}, where it may carry
+// an array subscript
+func lookupBraced(name string) (string, bool) {
+  if open := strings.IndexByte(name, '['); open > 0 && strings.HasSuffix(name, "]") {
+    return lookupElement(name[:open], name[open+1:len(name)-1])
+  }
+  return LookupVar(name)
+}
+
+func isNameChar(c byte, first bool) bool {
+  if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+    return true
+  }
+  return !first && c >= '0' && c <= '9'
+}
+
+// ExpandWord turns a lexed word into the fields it stands for. Quoted text
+// is taken as is; expansions are performed and, unless they were inside
+// double quotes, split into separate fields on $IFS. A word made only of
+// unquoted expansions that come out empty disappears.
+func ExpandWord(parts []lexer.WordPart) []string {
+  fields := make([]string, 0)
+  current := strings.Builder{}
+  hasCurrent := false
+  push := func() {
+    fields = append(fields, current.String())
+    current.Reset()
+    hasCurrent = false
+  }
+
+  for _, part := range expandTildePrefix(parts) {
+    if part.Kind != lexer.ExpansionPart {
+      current.WriteString(part.Text)
+      hasCurrent = true
+      continue
+    }
+
+    // "$@" is the one quoted expansion that yields several fields
+    if part.Quoted && part.Text == "$@" {
+      for i, arg := range PositionalArgs {
+        if i > 0 {
+          push()
+        }
+        current.WriteString(arg)
+        hasCurrent = true
+      }
+      continue
+    }
+
+    value := Expand(part.Text)
+    if part.Quoted {
+      current.WriteString(value)
+      hasCurrent = true
+      continue
+    }
+
+    pieces := strings.FieldsFunc(value, isIFS)
+    if len(pieces) == 0 {
+      if value != "" && hasCurrent {
+        push()
+      }
+      continue
+    }
+    if isIFS(rune(value[0])) && hasCurrent {
+      push()
+    }
+    for i, piece := range pieces {
+      if i > 0 {
+        push()
+      }
+      current.WriteString(piece)
+      hasCurrent = true
+    }
+    if isIFS(rune(value[len(value)-1])) {
+      push()
+    }
+  }
+
+  if hasCurrent {
+    push()
+  }
+  return fields
+}
+
+// expandTildePrefix performs tilde expansion at the start of a word. The
+// prefix runs up to the first slash and must be unquoted; if it names
+// nothing the word is left alone. The result is quoted so it's neither
+// split nor used as a pattern.
+func expandTildePrefix(parts []lexer.WordPart) []lexer.WordPart {
+  if len(parts) == 0 || parts[0].Kind != lexer.LiteralPart || !strings.HasPrefix(parts[0].Text, "~") {
+    return parts
+  }
+  text := parts[0].Text
+  end := strings.IndexByte(text, '/')
+  if end < 0 {
+    if len(parts) > 1 {
+      // Something quoted or expanded is part of the prefix
+      return parts
+    }
+    end = len(text)
+  }
+
+  value, ok := expandTilde(text[1:end])
+  if !ok {
+    return parts
+  }
+  expanded := []lexer.WordPart{{Kind: lexer.SingleQuotedPart, Text: value}}
+  if end < len(text) {
+    expanded = append(expanded, lexer.WordPart{Kind: lexer.LiteralPart, Text: text[end:]})
+  }
+  return append(expanded, parts[1:]...)
+}
+
+// expandTilde resolves what follows a ~: nothing for $HOME, a user name for
+// their home, + and - for $PWD and $OLDPWD, and N, +N or -N for an entry of
+// the directory stack as dirs numbers it
+func expandTilde(name string) (string, bool) {
+  switch name {
+  case "":
+    if home, ok := os.LookupEnv("HOME"); ok {
+      return home, true
+    }
+    current, err := user.Current()
+    if err != nil {
+      return "", false
+    }
+    return current.HomeDir, true
+  case "+":
+    return os.LookupEnv("PWD")
+  case "-":
+    return os.LookupEnv("OLDPWD")
+  }
+
+  index := name
+  if index[0] >= '0' && index[0] <= '9' {
+    index = "+" + index
+  }
+  entries := dirStackEntries()
+  if n, isIndex, err := stackIndex(index, len(entries)); isIndex {
+    if err != nil {
+      return "", false
+    }
+    return entries[n], true
+  }
+
+  account, err := user.Lookup(name)
+  if err != nil {
+    return "", false
+  }
+  return account.HomeDir, true
+}
+
+// isIFS reports whether r separates fields, $IFS defaulting to blanks
+func isIFS(r rune) bool {
+  ifs, exists := os.LookupEnv("IFS")
+  if !exists {
+    ifs = " \t\n"
+  }
+  return strings.ContainsRune(ifs, r)
+}
+
+// expandCommand performs expansions on command's words and redirection
+// targets in place. Commands built without Words are left as they are.
+func expandCommand(command *parser.Command) {
+  if len(command.Words) > 0 {
+    fields := make([]string, 0)
+    for _, word := range command.Words {
+      fields = append(fields, ExpandWord(word)...)
+    }
+    command.Name = ""
+    command.Args = []string{}
+    if len(fields) > 0 {
+      command.Name = fields[0]
+      command.Args = fields[1:]
+    }
+  }
+
+  for i, redir := range command.Redirs {
+    if len(redir.Target) > 0 {
+      command.Redirs[i].FilePath = strings.Join(ExpandWord(redir.Target), " ")
+    }
+  }
+}
+
+// CommandOutput runs line in a subshell and returns what it wrote to
+// stdout, minus trailing newlines, as $(...) does. Like a forked one, the
+// subshell can't change the shell's directory or variables, or exit it.
+func CommandOutput(line string) string {
+  tokens, err := lexer.NewLexer(strings.TrimSpace(line)).Lex()
+  if err != nil {
+    return ""
+  }
+  commands, err := parser.ParseTokens(tokens)
+  if err != nil {
+    return ""
+  }
+
+  var out bytes.Buffer
+  stdin, _, stderr := ShellStreams()
+  inSubshell(func() int {
+    return EvalWith(commands, stdin, &out, stderr)
+  })
+  return strings.TrimRight(out.String(), "\n")
+}
@@ -0,0 +1,170 @@
+package executor
+
+import (
+  "maps"
+  "os"
+  "testing"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+)
+
+func TestExpand(t *testing.T) {
+  t.Setenv("HARSH_TEST_VAR", "value")
+  originalArgs := PositionalArgs
+  originalStatus := LastStatus
+  defer func() {
+    PositionalArgs = originalArgs
+    LastStatus = originalStatus
+  }()
+  PositionalArgs = []string{"first", "second"}
+  LastStatus = 3
+
+  tests := []struct {
+    name     string
+    input    string
+    expected string
+  }{
+    {"Plain text", "hello", "hello"},
+    {"Simple variable", "a $HARSH_TEST_VAR b", "a value b"},
+    {"Braced variable", "${HARSH_TEST_VAR}s", "values"},
+    {"Unset variable", "[$HARSH_TEST_UNSET]", "[]"},
+    {"Default value", "${HARSH_TEST_UNSET:-fallback}", "fallback"},
+    {"Length", "${#HARSH_TEST_VAR}", "5"},
+    {"Last status", "$?", "3"},
+    {"Positional parameters", "$1 $2 $#", "first second 2"},
+    {"Escaped dollar", "\\$HARSH_TEST_VAR", "$HARSH_TEST_VAR"},
+    {"Lone dollar", "cost: $", "cost: $"},
+    {"Command substitution", "[$(echo hi)]", "[hi]"},
+    {"Backquote substitution", "[`echo hi`]", "[hi]"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      result := Expand(test.input)
+      if result != test.expected {
+        t.Errorf("Expand(%q) = %q, expected %q", test.input, result, test.expected)
+      }
+    })
+  }
+}
+
+func TestExpandFilename(t *testing.T) {
+  t.Setenv("HOME", "/home/test")
+  t.Setenv("HARSH_TEST_VAR", "value")
+
+  tests := []struct {
+    name     string
+    input    string
+    expected string
+  }{
+    {"Plain path", "/etc/harshrc", "/etc/harshrc"},
+    {"Variable", "$HOME/.$HARSH_TEST_VAR", "/home/test/.value"},
+    {"Tilde", "~", "/home/test"},
+    {"Tilde prefix", "~/.$HARSH_TEST_VAR", "/home/test/.value"},
+    {"Tilde elsewhere", "a~/b", "a~/b"},
+    {"Unknown user", "~harsh-no-such-user/x", "~harsh-no-such-user/x"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      if result := ExpandFilename(test.input); result != test.expected {
+        t.Errorf("ExpandFilename(%q) = %q, expected %q", test.input, result, test.expected)
+      }
+    })
+  }
+}
+
+func TestCommandOutputIsSubshell(t *testing.T) {
+  dir := t.TempDir()
+  t.Chdir(dir)
+  t.Setenv("PWD", dir)
+  t.Setenv("HARSH_TEST_SUB", "outer")
+  originalStatus := LastStatus
+  defer func() { LastStatus = originalStatus }()
+  LastStatus = 4
+  originalHist := Hist
+  defer func() { Hist = originalHist }()
+  Hist = []HistEntry{{Line: "echo kept"}}
+  fds := maps.Clone(fdFiles)
+
+  tests := []struct {
+    name     string
+    line     string
+    expected string
+  }{
+    {"cd", "cd /", ""},
+    {"Assignment", "HARSH_TEST_SUB=inner", ""},
+    {"exit", "exit 3", ""},
+    {"Output", "echo $HARSH_TEST_SUB", "outer"},
+    {"Redirected stdout", "exec >out", ""},
+    {"Opened descriptor", "exec 3>three", ""},
+    {"Cleared history", "history -c", ""},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      if result := CommandOutput(test.line); result != test.expected {
+        t.Errorf("CommandOutput(%q) = %q, expected %q", test.line, result, test.expected)
+      }
+      if cwd, _ := os.Getwd(); cwd != dir || os.Getenv("PWD") != dir {
+        t.Errorf("$(%s) moved the shell to %q, PWD %q", test.line, cwd, os.Getenv("PWD"))
+      }
+      if value := os.Getenv("HARSH_TEST_SUB"); value != "outer" {
+        t.Errorf("$(%s) left HARSH_TEST_SUB=%q", test.line, value)
+      }
+      if LastStatus != 4 {
+        t.Errorf("$(%s) left $? at %d", test.line, LastStatus)
+      }
+      if !maps.Equal(fdFiles, fds) {
+        t.Errorf("$(%s) left the descriptors %v", test.line, fdFiles)
+      }
+      if len(Hist) != 1 || Hist[0].Line != "echo kept" {
+        t.Errorf("$(%s) left the history %v", test.line, Hist)
+      }
+    })
+  }
+}
+
+func TestExpandWord(t *testing.T) {
+  t.Setenv("HARSH_TEST_LIST", " a  b ")
+  t.Setenv("HARSH_TEST_EMPTY", "")
+  originalArgs := PositionalArgs
+  defer func() { PositionalArgs = originalArgs }()
+  PositionalArgs = []string{"one", "two words"}
+
+  tests := []struct {
+    name     string
+    input    string
+    expected []string
+  }{
+    {"Concatenated quoting", "'foo'bar\"baz\"", []string{"foobarbaz"}},
+    {"Unquoted expansion is split", "$HARSH_TEST_LIST", []string{"a", "b"}},
+    {"Quoted expansion is kept whole", "\"$HARSH_TEST_LIST\"", []string{" a  b "}},
+    {"Split expansion joins neighbours", "x${HARSH_TEST_LIST}y", []string{"x", "a", "b", "y"}},
+    {"Empty unquoted expansion disappears", "$HARSH_TEST_EMPTY", []string{}},
+    {"Empty quoted expansion stays", "\"$HARSH_TEST_EMPTY\"", []string{""}},
+    {"Empty quotes stay", "''", []string{""}},
+    {"Quoted at-sign", "\"$@\"", []string{"one", "two words"}},
+    {"Unquoted at-sign", "$@", []string{"one", "two", "words"}},
+    {"Single quotes suppress expansion", "'$HARSH_TEST_LIST'", []string{"$HARSH_TEST_LIST"}},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      tokens, err := lexer.NewLexer(test.input).Lex()
+      if err != nil || len(tokens) != 1 {
+        t.Fatalf("Expected a single word from %q, got %+v (%v)", test.input, tokens, err)
+      }
+
+      result := ExpandWord(tokens[0].Parts)
+      if len(result) != len(test.expected) {
+        t.Fatalf("ExpandWord(%q) = %q, expected %q", test.input, result, test.expected)
+      }
+      for i := range result {
+        if result[i] != test.expected[i] {
+          t.Errorf("ExpandWord(%q) = %q, expected %q", test.input, result, test.expected)
+        }
+      }
+    })
+  }
+}
@@ -0,0 +1,304 @@
+package executor
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "strconv"
+
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// fdFiles is the shell's descriptor table: what commands get for each
+// descriptor they don't redirect themselves. exec redirections change it
+// for the rest of the session. Descriptors the shell inherited are added
+// the first time they're referred to by number.
+var fdFiles = map[int]*os.File{}
+
+// inheritedFds holds the one *os.File made for each inherited descriptor,
+// kept here so it's never collected and closed while in use
+var inheritedFds = map[int]*os.File{}
+
+// subshellFiles are the files of the shell a subshell runs in. The subshell
+// may replace or close those descriptors, but the files stay open for the
+// shell to go on with afterwards.
+var subshellFiles = map[*os.File]bool{}
+
+// fdFile returns the shell's open file for descriptor fd
+func fdFile(fd int) (*os.File, error) {
+  if file, ok := fdFiles[fd]; ok {
+    return file, nil
+  }
+  switch fd {
+  case 0:
+    return os.Stdin, nil
+  case 1:
+    return os.Stdout, nil
+  case 2:
+    return os.Stderr, nil
+  }
+  file, ok := inheritedFds[fd]
+  if !ok {
+    if !validFd(fd) {
+      return nil, fmt.Errorf("%d: invalid file descriptor: Bad file descriptor", fd)
+    }
+    file = os.NewFile(uintptr(fd), "fd"+strconv.Itoa(fd))
+    inheritedFds[fd] = file
+  }
+  fdFiles[fd] = file
+  return file, nil
+}
+
+// releaseFile closes a file that was one of the shell's descriptors, unless
+// a subshell is letting go of what belongs to the shell it runs in, which
+// includes the descriptors inherited from the parent
+func releaseFile(file *os.File) error {
+  if isStdFile(file) || subshellFiles[file] {
+    return nil
+  }
+  for fd, inherited := range inheritedFds {
+    if inherited == file {
+      if subshellDepth > 0 {
+        return nil
+      }
+      delete(inheritedFds, fd)
+    }
+  }
+  return file.Close()
+}
+
+// ShellStreams is what commands read and write when they don't redirect
+// stdin, stdout and stderr
+func ShellStreams() (io.Reader, io.Writer, io.Writer) {
+  stdin, _ := fdFile(0)
+  stdout, _ := fdFile(1)
+  stderr, _ := fdFile(2)
+  return stdin, stdout, stderr
+}
+
+// extraFiles lists the shell's descriptors from 3 up for a child process,
+// entry i becoming its descriptor 3+i. Gaps are nil, closed in the child.
+func extraFiles() []*os.File {
+  highest := 2
+  for fd := range fdFiles {
+    highest = max(highest, fd)
+  }
+  files := make([]*os.File, highest-2)
+  for fd, file := range fdFiles {
+    if fd > 2 {
+      files[fd-3] = file
+    }
+  }
+  return files
+}
+
+func isStdFile(file *os.File) bool {
+  return file == os.Stdin || file == os.Stdout || file == os.Stderr
+}
+
+// setFd makes file the shell's descriptor fd, closing what was there
+func setFd(fd int, file *os.File) {
+  if old, ok := fdFiles[fd]; ok && old != file {
+    releaseFile(old)
+  }
+  fdFiles[fd] = file
+}
+
+// closeFd closes the shell's descriptor fd. Go itself needs 0-2, so those
+// read and write /dev/null instead.
+func closeFd(fd int) error {
+  if fd <= 2 {
+    devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+    if err != nil {
+      return err
+    }
+    setFd(fd, devNull)
+    return nil
+  }
+  file, err := fdFile(fd)
+  if err != nil {
+    return fmt.Errorf("%d: Bad file descriptor", fd)
+  }
+  delete(fdFiles, fd)
+  return releaseFile(file)
+}
+
+// redirectShell applies exec's redirections to the shell itself, so they
+// hold for every command that follows
+func redirectShell(redirs []parser.Redirection) error {
+  for _, redir := range redirs {
+    if redir.Type != "<&" && redir.Type != ">&" {
+      file, err := openRedirection(redir)
+      if err != nil {
+        return err
+      }
+      setFd(redir.Fd, file)
+      continue
+    }
+
+    if redir.FilePath == "-" {
+      if err := closeFd(redir.Fd); err != nil {
+        return err
+      }
+      continue
+    }
+    n, err := strconv.Atoi(redir.FilePath)
+    if err != nil {
+      if redir.Type != ">&" || redir.Fd != 1 {
+        return fmt.Errorf("%s: ambiguous redirect", redir.FilePath)
+      }
+      // >&file sends both stdout and stderr to file
+      file, err := os.Create(redir.FilePath)
+      if err != nil {
+        return err
+      }
+      copied, err := dupFile(file)
+      if err != nil {
+        return err
+      }
+      setFd(1, file)
+      setFd(2, copied)
+      continue
+    }
+
+    source, err := fdFile(n)
+    if err != nil {
+      return fmt.Errorf("%d: Bad file descriptor", n)
+    }
+    copied, err := dupFile(source)
+    if err != nil {
+      return err
+    }
+    setFd(redir.Fd, copied)
+  }
+  return nil
+}
+
+// streams is what a single command gets as each descriptor. 0-2 can be
+// any reader or writer, like a pipe or a buffer capturing output; the rest
+// must be files so they can be passed to child processes.
+type streams struct {
+  stdin io.Reader
+  stdout, stderr io.Writer
+  // extra holds the descriptors from 3 up that the command redirects, nil
+  // for ones it closes
+  extra map[int]*os.File
+}
+
+// get returns what fd refers to for the command
+func (s *streams) get(fd int) (any, error) {
+  switch fd {
+  case 0:
+    return s.stdin, nil
+  case 1:
+    return s.stdout, nil
+  case 2:
+    return s.stderr, nil
+  }
+  if file, ok := s.extra[fd]; ok {
+    if file == nil {
+      return nil, fmt.Errorf("%d: Bad file descriptor", fd)
+    }
+    return file, nil
+  }
+  file, err := fdFile(fd)
+  if err != nil {
+    return nil, fmt.Errorf("%d: Bad file descriptor", fd)
+  }
+  return file, nil
+}
+
+// set makes stream the command's descriptor fd
+func (s *streams) set(fd int, stream any) error {
+  ok := false
+  switch fd {
+  case 0:
+    s.stdin, ok = stream.(io.Reader)
+  case 1:
+    s.stdout, ok = stream.(io.Writer)
+  case 2:
+    s.stderr, ok = stream.(io.Writer)
+  default:
+    s.extra[fd], ok = stream.(*os.File)
+  }
+  if !ok {
+    return fmt.Errorf("%d: Bad file descriptor", fd)
+  }
+  return nil
+}
+
+// redirect applies redir to the command, returning any file it opened for
+// the caller to close once the command is done
+func (s *streams) redirect(redir parser.Redirection) (*os.File, error) {
+  if redir.Type != "<&" && redir.Type != ">&" {
+    file, err := openRedirection(redir)
+    if err != nil {
+      return nil, err
+    }
+    return file, s.set(redir.Fd, file)
+  }
+
+  if redir.FilePath == "-" {
+    if redir.Fd > 2 {
+      s.extra[redir.Fd] = nil
+      return nil, nil
+    }
+    devNull, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+    if err != nil {
+      return nil, err
+    }
+    return devNull, s.set(redir.Fd, devNull)
+  }
+
+  n, err := strconv.Atoi(redir.FilePath)
+  if err != nil {
+    if redir.Type != ">&" || redir.Fd != 1 {
+      return nil, fmt.Errorf("%s: ambiguous redirect", redir.FilePath)
+    }
+    file, err := os.Create(redir.FilePath)
+    if err != nil {
+      return nil, err
+    }
+    s.stdout, s.stderr = file, file
+    return file, nil
+  }
+  stream, err := s.get(n)
+  if err != nil {
+    return nil, err
+  }
+  return nil, s.set(redir.Fd, stream)
+}
+
+// withFds makes the command's own descriptors from 3 up part of the
+// shell's table while runnable starts, which is when a child process
+// inherits them and a builtin does its work
+func withFds(runnable Runnable, extra map[int]*os.File) Runnable {
+  if len(extra) == 0 {
+    return runnable
+  }
+  start := runnable.Start
+  runnable.Start = func(stdin io.Reader, stdout, stderr io.Writer) {
+    saved := make(map[int]*os.File, len(extra))
+    for fd, file := range extra {
+      if old, ok := fdFiles[fd]; ok {
+        saved[fd] = old
+      }
+      if file == nil {
+        delete(fdFiles, fd)
+      } else {
+        fdFiles[fd] = file
+      }
+    }
+    defer func() {
+      for fd := range extra {
+        if old, ok := saved[fd]; ok {
+          fdFiles[fd] = old
+        } else {
+          delete(fdFiles, fd)
+        }
+      }
+    }()
+    start(stdin, stdout, stderr)
+  }
+  return runnable
+}
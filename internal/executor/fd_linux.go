@@ -0,0 +1,90 @@
+//go:build linux
+
+package executor
+
+import (
+  "errors"
+  "os"
+  "syscall"
+)
+
+// dupFile returns a new descriptor for the same open file, so each can be
+// closed on its own
+func dupFile(file *os.File) (*os.File, error) {
+  fd, err := dupCloexec(int(file.Fd()))
+  if err != nil {
+    return nil, err
+  }
+  return os.NewFile(uintptr(fd), file.Name()), nil
+}
+
+// dupCloexec duplicates fd onto a descriptor from 10 up that isn't passed
+// on to programs the shell runs
+func dupCloexec(fd int) (int, error) {
+  newFd, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_DUPFD_CLOEXEC, 10)
+  if errno != 0 {
+    return -1, errno
+  }
+  return int(newFd), nil
+}
+
+// execProcess replaces the shell with the first of programs the kernel
+// agrees to run, after putting files[fd] at each descriptor fd. If none
+// can be run, the descriptors are put back as they were.
+func execProcess(programs []program, env []string, files map[int]*os.File) error {
+  // Copy the sources before touching any target, one file's source can be
+  // another's target, as in exec 3>&1 >log
+  sources := make(map[int]int, len(files))
+  defer func() {
+    for _, source := range sources {
+      syscall.Close(source)
+    }
+  }()
+  for fd, file := range files {
+    source, err := dupCloexec(int(file.Fd()))
+    if err != nil {
+      return err
+    }
+    sources[fd] = source
+  }
+
+  type savedFd struct {
+    copy int
+    flags uintptr
+  }
+  saved := make(map[int]savedFd, len(files))
+  for fd := range files {
+    flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+    if errno != 0 {
+      continue
+    }
+    if copy, err := dupCloexec(fd); err == nil {
+      saved[fd] = savedFd{copy, flags}
+    }
+  }
+  defer func() {
+    for fd, old := range saved {
+      flags := 0
+      if old.flags&syscall.FD_CLOEXEC != 0 {
+        flags = syscall.O_CLOEXEC
+      }
+      syscall.Dup3(old.copy, fd, flags)
+      syscall.Close(old.copy)
+    }
+  }()
+
+  for fd, source := range sources {
+    if err := syscall.Dup3(source, fd, 0); err != nil {
+      return err
+    }
+  }
+
+  err := errors.New("nothing to run")
+  for _, p := range programs {
+    err = syscall.Exec(p.path, p.argv, env)
+    if !errors.Is(err, syscall.ENOEXEC) {
+      break
+    }
+  }
+  return err
+}
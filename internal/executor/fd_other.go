@@ -0,0 +1,34 @@
+//go:build !linux
+
+package executor
+
+import (
+  "errors"
+  "os"
+  "syscall"
+)
+
+// dupFile can't make a real copy here, so the two share the file
+func dupFile(file *os.File) (*os.File, error) {
+  return file, nil
+}
+
+// execProcess replaces the shell with the first of programs the kernel
+// agrees to run. Descriptors can't be moved here, so every file must
+// already be at its place.
+func execProcess(programs []program, env []string, files map[int]*os.File) error {
+  for fd, file := range files {
+    if int(file.Fd()) != fd {
+      return errors.New("redirecting a replaced shell is not supported on this platform")
+    }
+  }
+
+  err := errors.New("nothing to run")
+  for _, p := range programs {
+    err = syscall.Exec(p.path, p.argv, env)
+    if !errors.Is(err, syscall.ENOEXEC) {
+      break
+    }
+  }
+  return err
+}
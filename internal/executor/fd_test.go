@@ -0,0 +1,131 @@
+package executor
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "testing"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// fdFixture puts the shell's descriptor table back as it was after the
+// test, closing whatever the test opened, and makes sh available
+func fdFixture(t *testing.T) string {
+  saved := make(map[int]*os.File, len(fdFiles))
+  for fd, file := range fdFiles {
+    saved[fd] = file
+  }
+  savedDirs := PathDirs
+  PathDirs = []string{"/bin", "/usr/bin"}
+  t.Cleanup(func() {
+    for fd, file := range fdFiles {
+      if saved[fd] != file && !isStdFile(file) {
+        file.Close()
+      }
+    }
+    fdFiles = saved
+    PathDirs = savedDirs
+  })
+  return t.TempDir()
+}
+
+// evalLine runs line with its output captured
+func evalLine(t *testing.T, line string) (string, string, int) {
+  tokens, err := lexer.NewLexer(line).Lex()
+  if err != nil {
+    t.Fatalf("Lex(%q) failed: %v", line, err)
+  }
+  commands, err := parser.ParseTokens(tokens)
+  if err != nil {
+    t.Fatalf("ParseTokens(%q) failed: %v", line, err)
+  }
+  var out, errOut bytes.Buffer
+  status := EvalWith(commands, os.Stdin, &out, &errOut)
+  return out.String(), errOut.String(), status
+}
+
+func TestRedirections(t *testing.T) {
+  dir := fdFixture(t)
+  file := filepath.Join(dir, "file")
+
+  tests := []struct {
+    name     string
+    line     string
+    output   string
+    errOut   string
+    status   int
+    contents string
+  }{
+    {"Stderr to stdout", `sh -c 'echo err >&2' 2>&1`, "err\n", "", 0, ""},
+    {"Order matters", `sh -c 'echo out; echo err >&2' 2>&1 >` + file, "err\n", "", 0, "out\n"},
+    {"Stdout to stderr", "echo moved >&2", "", "moved\n", 0, ""},
+    {"Builtin through a new descriptor", "echo three 3>" + file + " >&3", "", "", 0, "three\n"},
+    {"Child inherits a descriptor", `sh -c 'echo child >&3' 3>` + file, "", "", 0, "child\n"},
+    {"Both to a file", `sh -c 'echo out; echo err >&2' >&` + file, "", "", 0, "out\nerr\n"},
+    {"Closed descriptor", "echo x 3>" + file + " 3>&- >&3", "", "harsh: 3: Bad file descriptor\n", 1, ""},
+    {"Unknown descriptor", "echo x >&9", "", "harsh: 9: Bad file descriptor\n", 1, ""},
+    {"Ambiguous", "echo x 2>&" + file, "", "harsh: " + file + ": ambiguous redirect\n", 1, ""},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      os.Remove(file)
+      output, errOut, status := evalLine(t, test.line)
+      if output != test.output || errOut != test.errOut || status != test.status {
+        t.Errorf("%s = %q, %q (%d), expected %q, %q (%d)", test.line, output, errOut, status, test.output, test.errOut, test.status)
+      }
+      contents, _ := os.ReadFile(file)
+      if string(contents) != test.contents {
+        t.Errorf("%s left %q in the file, expected %q", test.line, contents, test.contents)
+      }
+    })
+  }
+}
+
+func TestExecRedirections(t *testing.T) {
+  dir := fdFixture(t)
+  log := filepath.Join(dir, "log")
+
+  lines := []struct {
+    line   string
+    status int
+  }{
+    {"exec 3>" + log, 0},
+    {"echo one >&3", 0},
+    {`sh -c 'echo two >&3'`, 0},
+    {"exec 4>&3 3>&-", 0},
+    {"echo lost >&3", 1},
+    {"echo three >&4", 0},
+    {"exec 4>&-", 0},
+    {"exec 5>&-", 1},
+  }
+  for _, test := range lines {
+    if status, err := Run(test.line); err != nil || status != test.status {
+      t.Errorf("%s = %d, %v, expected %d", test.line, status, err, test.status)
+    }
+  }
+
+  if contents, _ := os.ReadFile(log); string(contents) != "one\ntwo\nthree\n" {
+    t.Errorf("Expected all three lines in the log, got %q", contents)
+  }
+  if _, ok := fdFiles[3]; ok {
+    t.Errorf("Expected descriptor 3 to be closed")
+  }
+}
+
+func TestExecStdout(t *testing.T) {
+  dir := fdFixture(t)
+  out := filepath.Join(dir, "out")
+
+  Run("exec >" + out)
+  Run("echo captured")
+  Run(`sh -c 'echo from child'`)
+  Run("exec >&-")
+  Run("echo discarded")
+
+  if contents, _ := os.ReadFile(out); string(contents) != "captured\nfrom child\n" {
+    t.Errorf("Expected the shell's output in the file, got %q", contents)
+  }
+}
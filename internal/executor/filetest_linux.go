@@ -0,0 +1,36 @@
+//go:build linux
+
+package executor
+
+import (
+  "os"
+  "syscall"
+)
+
+// fileAccess asks the kernel whether path is readable (4), writable (2) or
+// executable (1) by the shell, which also accounts for root and ACLs
+func fileAccess(path string, mode uint32) bool {
+  return syscall.Access(path, mode) == nil
+}
+
+// ownedBy reports whether the file is owned by the shell's effective user
+// or, with group, its effective group
+func ownedBy(info os.FileInfo, group bool) bool {
+  stat, ok := info.Sys().(*syscall.Stat_t)
+  if !ok {
+    return false
+  }
+  if group {
+    return int(stat.Gid) == os.Getegid()
+  }
+  return int(stat.Uid) == os.Geteuid()
+}
+
+// modifiedSinceRead reports whether the file changed after it was last read
+func modifiedSinceRead(info os.FileInfo) bool {
+  stat, ok := info.Sys().(*syscall.Stat_t)
+  if !ok {
+    return false
+  }
+  return syscall.TimespecToNsec(stat.Mtim) > syscall.TimespecToNsec(stat.Atim)
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package executor
+
+import (
+  "os"
+  "syscall"
+)
+
+// lockFile takes an advisory lock on file, waiting for other holders. It's
+// released when the file is closed.
+func lockFile(file *os.File, exclusive bool) error {
+  how := syscall.LOCK_SH
+  if exclusive {
+    how = syscall.LOCK_EX
+  }
+  for {
+    err := syscall.Flock(int(file.Fd()), how)
+    if err != syscall.EINTR {
+      return err
+    }
+  }
+}
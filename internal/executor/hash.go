@@ -0,0 +1,195 @@
+package executor
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "sort"
+  "strings"
+)
+
+// hashedCommand is where a command was found and how often it ran from
+// there
+type hashedCommand struct {
+  path string
+  hits int
+}
+
+// hashTable remembers where commands were found on PATH so that running
+// them again doesn't search every directory. It is emptied when PATH is
+// assigned.
+var hashTable = map[string]*hashedCommand{}
+
+// hashedDirs is the PathDirs the table was filled from, in case they were
+// replaced without going through PATH
+var hashedDirs string
+
+// checkHashTable empties the table if PathDirs changed since it was filled
+func checkHashTable() {
+  if dirs := strings.Join(PathDirs, ":"); dirs != hashedDirs {
+    hashTable = map[string]*hashedCommand{}
+    hashedDirs = dirs
+  }
+}
+
+// hashLookup returns name's remembered path if the file is still there
+func hashLookup(name string) (string, bool) {
+  checkHashTable()
+  entry, ok := hashTable[name]
+  if !ok {
+    return "", false
+  }
+  if _, err := os.Stat(entry.path); err != nil {
+    delete(hashTable, name)
+    return "", false
+  }
+  return entry.path, true
+}
+
+// hashPath searches PATH for name and remembers what it found
+func hashPath(name string) (string, bool) {
+  checkHashTable()
+  paths := searchPath(name, PathDirs)
+  if len(paths) == 0 {
+    return "", false
+  }
+  hashTable[name] = &hashedCommand{path: paths[0]}
+  return paths[0], true
+}
+
+// hashHit counts a run of a hashed command
+func hashHit(name string) {
+  if entry, ok := hashTable[name]; ok {
+    entry.hits++
+  }
+}
+
+// pathChanged is called when PATH is assigned: the directories are split
+// again and everything found on the old ones forgotten
+func pathChanged(path string) {
+  PathDirs = strings.Split(path, ":")
+  hashTable = map[string]*hashedCommand{}
+  hashedDirs = path
+}
+
+const hashUsage = "hash: usage: hash [-lr] [-p pathname] [-dt] [name ...]"
+
+// runHash implements hash. Names are looked up and remembered; -r forgets
+// everything, -d the given names, -p remembers a name as the given path
+// and -t prints where names were found. Without names the table is listed
+// with hit counts, or with -l as commands that would recreate it.
+func runHash(args []string, stdout, stderr io.Writer) int {
+  reset, remove, show, reusable := false, false, false, false
+  pathname, hasPath := "", false
+  for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+    arg := args[0]
+    args = args[1:]
+    if arg == "--" {
+      break
+    }
+    for i := 1; i < len(arg); i++ {
+      switch arg[i] {
+      case 'r':
+        reset = true
+      case 'd':
+        remove = true
+      case 't':
+        show = true
+      case 'l':
+        reusable = true
+      case 'p':
+        hasPath = true
+        if i+1 < len(arg) {
+          pathname = arg[i+1:]
+        } else if len(args) > 0 {
+          pathname, args = args[0], args[1:]
+        } else {
+          fmt.Fprintf(stderr, "hash: -p: option requires an argument\n%s\n", hashUsage)
+          return 2
+        }
+        i = len(arg)
+      default:
+        fmt.Fprintf(stderr, "hash: -%c: invalid option\n%s\n", arg[i], hashUsage)
+        return 2
+      }
+    }
+  }
+
+  checkHashTable()
+  if reset {
+    hashTable = map[string]*hashedCommand{}
+  }
+  if len(args) == 0 {
+    if show {
+      fmt.Fprintf(stderr, "hash: -t: option requires an argument\n")
+      return 1
+    }
+    if !reset {
+      listHashTable(stdout, reusable)
+    }
+    return 0
+  }
+
+  status := 0
+  for _, name := range args {
+    switch {
+    case show:
+      entry, ok := hashTable[name]
+      if !ok {
+        fmt.Fprintf(stderr, "hash: %s: not found\n", name)
+        status = 1
+      } else if len(args) > 1 {
+        fmt.Fprintf(stdout, "%s\t%s\n", name, entry.path)
+      } else {
+        fmt.Fprintln(stdout, entry.path)
+      }
+    case remove:
+      if _, ok := hashTable[name]; !ok {
+        fmt.Fprintf(stderr, "hash: %s: not found\n", name)
+        status = 1
+      }
+      delete(hashTable, name)
+    case hasPath:
+      if info, err := os.Stat(pathname); err == nil && info.IsDir() {
+        fmt.Fprintf(stderr, "hash: %s: Is a directory\n", pathname)
+        return 1
+      }
+      hashTable[name] = &hashedCommand{path: pathname}
+    default:
+      // Builtins and paths are never looked up, so there's nothing to hash
+      if lookupBuiltin(name) != unknownBuiltin || strings.Contains(name, "/") {
+        continue
+      }
+      if _, ok := hashPath(name); !ok {
+        fmt.Fprintf(stderr, "hash: %s: not found\n", name)
+        status = 1
+      }
+    }
+  }
+  return status
+}
+
+func listHashTable(stdout io.Writer, reusable bool) {
+  if len(hashTable) == 0 {
+    fmt.Fprintln(stdout, "hash: hash table empty")
+    return
+  }
+
+  names := make([]string, 0, len(hashTable))
+  for name := range hashTable {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+
+  if !reusable {
+    fmt.Fprintln(stdout, "hits\tcommand")
+  }
+  for _, name := range names {
+    entry := hashTable[name]
+    if reusable {
+      fmt.Fprintf(stdout, "builtin hash -p %s %s\n", entry.path, name)
+    } else {
+      fmt.Fprintf(stdout, "%4d\t%s\n", entry.hits, entry.path)
+    }
+  }
+}
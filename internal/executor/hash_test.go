@@ -0,0 +1,118 @@
+package executor
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+// hashFixture empties the hash table and points PathDirs at a temp dir
+// holding "tool" and "other" executables, returning the dir
+func hashFixture(t *testing.T) string {
+  dir := t.TempDir()
+  for _, name := range []string{"tool", "other"} {
+    os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755)
+  }
+  saved := PathDirs
+  PathDirs = []string{dir}
+  hashTable = map[string]*hashedCommand{}
+  t.Cleanup(func() { PathDirs = saved })
+  return dir
+}
+
+func TestHash(t *testing.T) {
+  dir := hashFixture(t)
+  tool, other := filepath.Join(dir, "tool"), filepath.Join(dir, "other")
+
+  tests := []struct {
+    name     string
+    setup    [][]string
+    args     []string
+    expected string
+    errOut   string
+    status   int
+  }{
+    {"Empty", nil, []string{}, "hash: hash table empty\n", "", 0},
+    {"Hash and list", [][]string{{"tool", "other"}}, []string{}, "hits\tcommand\n   0\t" + other + "\n   0\t" + tool + "\n", "", 0},
+    {"Not found", nil, []string{"nope", "tool"}, "", "hash: nope: not found\n", 1},
+    {"Builtins aren't hashed", [][]string{{"echo"}}, []string{}, "hash: hash table empty\n", "", 0},
+    {"Show", [][]string{{"tool"}}, []string{"-t", "tool"}, tool + "\n", "", 0},
+    {"Show several", [][]string{{"tool", "other"}}, []string{"-t", "tool", "other"}, "tool\t" + tool + "\nother\t" + other + "\n", "", 0},
+    {"Show unhashed", nil, []string{"-t", "tool"}, "", "hash: tool: not found\n", 1},
+    {"Delete", [][]string{{"tool", "other"}, {"-d", "tool"}}, []string{"-t", "other", "tool"}, "other\t" + other + "\n", "hash: tool: not found\n", 1},
+    {"Delete unhashed", nil, []string{"-d", "tool"}, "", "hash: tool: not found\n", 1},
+    {"Reset", [][]string{{"tool"}, {"-r"}}, []string{}, "hash: hash table empty\n", "", 0},
+    {"Set path", [][]string{{"-p", "/bin/sh", "tool"}}, []string{"-t", "tool"}, "/bin/sh\n", "", 0},
+    {"Set path to directory", nil, []string{"-p", "/", "tool"}, "", "hash: /: Is a directory\n", 1},
+    {"Reusable", [][]string{{"tool"}}, []string{"-l"}, "builtin hash -p " + tool + " tool\n", "", 0},
+    {"Invalid option", nil, []string{"-x"}, "", "hash: -x: invalid option\n" + hashUsage + "\n", 2},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      hashTable = map[string]*hashedCommand{}
+      for _, args := range test.setup {
+        runHash(args, &bytes.Buffer{}, &bytes.Buffer{})
+      }
+      var out, errOut bytes.Buffer
+      status := runHash(test.args, &out, &errOut)
+      if out.String() != test.expected || errOut.String() != test.errOut || status != test.status {
+        t.Errorf("hash %q = %q, %q (%d), expected %q, %q (%d)", test.args, out.String(), errOut.String(), status, test.expected, test.errOut, test.status)
+      }
+    })
+  }
+}
+
+func TestHashHits(t *testing.T) {
+  dir := hashFixture(t)
+
+  for i := 0; i < 2; i++ {
+    if status, err := Run("tool"); err != nil || status != 0 {
+      t.Fatalf("Run(tool) = %d, %v", status, err)
+    }
+  }
+  if entry := hashTable["tool"]; entry == nil || entry.path != filepath.Join(dir, "tool") || entry.hits != 2 {
+    t.Errorf("Expected tool hashed with 2 hits, got %+v", entry)
+  }
+
+  var out bytes.Buffer
+  runType([]string{"tool"}, &out, &bytes.Buffer{})
+  if expected := "tool is hashed (" + filepath.Join(dir, "tool") + ")\n"; out.String() != expected {
+    t.Errorf("type tool = %q, expected %q", out.String(), expected)
+  }
+}
+
+func TestHashForgetsRemovedFile(t *testing.T) {
+  dir := hashFixture(t)
+  runHash([]string{"tool"}, &bytes.Buffer{}, &bytes.Buffer{})
+
+  os.Remove(filepath.Join(dir, "tool"))
+  if path, err := findExecutable("tool"); err == nil {
+    t.Errorf("Expected removed tool not to be found, got %s", path)
+  }
+  if _, ok := hashTable["tool"]; ok {
+    t.Errorf("Expected removed tool to be dropped from the hash table")
+  }
+}
+
+func TestHashInvalidatedByPath(t *testing.T) {
+  first := hashFixture(t)
+  second := t.TempDir()
+  os.WriteFile(filepath.Join(second, "tool"), []byte("#!/bin/sh\n"), 0755)
+  t.Setenv("PATH", os.Getenv("PATH"))
+
+  if path, _ := findExecutable("tool"); path != filepath.Join(first, "tool") {
+    t.Fatalf("Expected tool in %s, got %s", first, path)
+  }
+
+  if status, err := Run("PATH=" + second + ":" + first); err != nil || status != 0 {
+    t.Fatalf("Assigning PATH failed: %d, %v", status, err)
+  }
+  if len(hashTable) != 0 {
+    t.Errorf("Expected an empty hash table after assigning PATH, got %d entries", len(hashTable))
+  }
+  if path, _ := findExecutable("tool"); path != filepath.Join(second, "tool") {
+    t.Errorf("Expected tool in %s after assigning PATH, got %s", second, path)
+  }
+}
@@ -0,0 +1,266 @@
+package executor
+
+import (
+  "bufio"
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// histRecord is a command in the history database, $HISTDB, which keeps
+// one JSON object per line and is only ever appended to
+type histRecord struct {
+  Command string `json:"cmd"`
+  Dir string `json:"cwd"`
+  Start time.Time `json:"start"`
+  // Duration is in milliseconds
+  Duration int64 `json:"duration_ms"`
+  Status int `json:"status"`
+  Host string `json:"host"`
+  Session string `json:"session"`
+}
+
+// historySession tells this shell's records in the database apart from
+// those of other sessions
+var historySession = newSessionID()
+
+func newSessionID() string {
+  id := make([]byte, 8)
+  rand.Read(id)
+  return hex.EncodeToString(id)
+}
+
+// RecordHistory adds a command that has run to the history database if
+// $HISTDB is set, entry being what AddHistory made of it. $HISTFILE goes on
+// as before; the database is extra.
+func RecordHistory(entry HistEntry, duration time.Duration, status int) error {
+  histdb := os.Getenv("HISTDB")
+  if histdb == "" {
+    return nil
+  }
+  host, _ := os.Hostname()
+  data, err := json.Marshal(histRecord{
+    Command: entry.Line,
+    Dir: entry.Dir,
+    Start: entry.Time,
+    Duration: duration.Milliseconds(),
+    Status: status,
+    Host: host,
+    Session: historySession,
+  })
+  if err != nil {
+    return err
+  }
+
+  file, err := openHistory(histdb, os.O_WRONLY|os.O_APPEND|os.O_CREATE)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  // One write, so a record is never split by another session's
+  _, err = file.Write(append(data, '\n'))
+  return err
+}
+
+// readHistoryDB reads the records in filename, skipping lines that don't
+// parse rather than giving up on the rest
+func readHistoryDB(filename string) ([]histRecord, error) {
+  file, err := openHistory(filename, os.O_RDONLY)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  var records []histRecord
+  scanner := bufio.NewScanner(file)
+  scanner.Buffer(nil, 1<<20)
+  for scanner.Scan() {
+    var record histRecord
+    if json.Unmarshal(scanner.Bytes(), &record) == nil {
+      records = append(records, record)
+    }
+  }
+  return records, scanner.Err()
+}
+
+// historyDirs fills in where the entries read from the history file were
+// run, which the file doesn't keep, from $HISTDB if set. An entry goes with
+// the record of the same command started the same second, or without a time
+// of its own, with the latest record of the command.
+func historyDirs(entries []HistEntry) {
+  histdb := os.Getenv("HISTDB")
+  if histdb == "" || len(entries) == 0 {
+    return
+  }
+  records, err := readHistoryDB(histdb)
+  if err != nil {
+    return
+  }
+
+  type run struct {
+    command string
+    start int64
+  }
+  dirs := map[run]string{}
+  for _, record := range records {
+    dirs[run{record.Command, record.Start.Unix()}] = record.Dir
+    dirs[run{record.Command, 0}] = record.Dir
+  }
+  for i, entry := range entries {
+    start := int64(0)
+    if !entry.Time.IsZero() {
+      start = entry.Time.Unix()
+    }
+    if entry.Dir == "" {
+      entries[i].Dir = dirs[run{entry.Line, start}]
+    }
+  }
+}
+
+// historyQuery is what history --query filters the database by
+type historyQuery struct {
+  dir, host, session, text string
+  status int
+  hasStatus, failed bool
+  since, until time.Time
+}
+
+func (q *historyQuery) matches(record histRecord) bool {
+  switch {
+  case q.dir != "" && record.Dir != q.dir,
+    q.host != "" && record.Host != q.host,
+    q.session != "" && record.Session != q.session,
+    q.hasStatus && record.Status != q.status,
+    q.failed && record.Status == 0,
+    !q.since.IsZero() && record.Start.Before(q.since),
+    !q.until.IsZero() && record.Start.After(q.until),
+    q.text != "" && !strings.Contains(record.Command, q.text):
+    return false
+  }
+  return true
+}
+
+const historyQueryUsage = "history: usage: history --query [--dir dir] [--status n] [--failed] [--since time] [--until time] [--host name] [--session] [text]"
+
+// queryHistory implements history --query, listing the commands in the
+// database that ran in a directory, ended with a status, started within a
+// time window, on a host, in this session or contain some text, oldest
+// first, with when they started, their status, how long they took and
+// where they ran
+func queryHistory(args []string, stdout, stderr io.Writer) int {
+  var q historyQuery
+  now := time.Now()
+  for len(args) > 0 {
+    arg := args[0]
+    args = args[1:]
+    switch arg {
+    case "--failed":
+      q.failed = true
+      continue
+    case "--session":
+      q.session = historySession
+      continue
+    }
+    if !strings.HasPrefix(arg, "--") {
+      if q.text != "" {
+        fmt.Fprintf(stderr, "history: --query: too many arguments\n%s\n", historyQueryUsage)
+        return 2
+      }
+      q.text = arg
+      continue
+    }
+    if arg != "--dir" && arg != "--status" && arg != "--since" && arg != "--until" && arg != "--host" {
+      fmt.Fprintf(stderr, "history: --query: %s: invalid option\n%s\n", arg, historyQueryUsage)
+      return 2
+    }
+    if len(args) == 0 {
+      fmt.Fprintf(stderr, "history: --query: %s: option requires an argument\n%s\n", arg, historyQueryUsage)
+      return 2
+    }
+    value := args[0]
+    args = args[1:]
+
+    var err error
+    switch arg {
+    case "--dir":
+      q.dir, err = queryDir(value)
+    case "--status":
+      q.hasStatus = true
+      if q.status, err = strconv.Atoi(value); err != nil {
+        err = fmt.Errorf("%s: numeric argument required", value)
+      }
+    case "--since":
+      q.since, err = parseQueryTime(value, now)
+    case "--until":
+      q.until, err = parseQueryTime(value, now)
+    case "--host":
+      q.host = value
+    }
+    if err != nil {
+      fmt.Fprintf(stderr, "history: %s: %s\n", arg, err.Error())
+      return 1
+    }
+  }
+
+  histdb := os.Getenv("HISTDB")
+  if histdb == "" {
+    fmt.Fprintln(stderr, "history: HISTDB is not set")
+    return 1
+  }
+  records, err := readHistoryDB(histdb)
+  if err != nil && !errors.Is(err, os.ErrNotExist) {
+    fmt.Fprintf(stderr, "history: %s\n", pathErrorText(err))
+    return 1
+  }
+  for _, record := range records {
+    if q.matches(record) {
+      duration := time.Duration(record.Duration) * time.Millisecond
+      fmt.Fprintf(stdout, "%s  %d  %s  %s  %s\n", record.Start.Local().Format("2006-01-02 15:04:05"), record.Status, duration, record.Dir, record.Command)
+    }
+  }
+  return 0
+}
+
+// queryDir makes a --dir argument absolute the way AddHistory records
+// directories
+func queryDir(dir string) (string, error) {
+  if !filepath.IsAbs(dir) {
+    cwd, err := WorkingDir()
+    if err != nil {
+      return "", err
+    }
+    dir = filepath.Join(cwd, dir)
+  }
+  return filepath.Clean(dir), nil
+}
+
+// queryTimeLayouts are the forms a --since or --until time can take, in
+// local time, besides an age like 2h or 3d
+var queryTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parseQueryTime reads a --since or --until time: a date and time, or how
+// long before now as a number of s, m, h, d or w
+func parseQueryTime(value string, now time.Time) (time.Time, error) {
+  for _, layout := range queryTimeLayouts {
+    if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+      return t, nil
+    }
+  }
+  units := map[byte]time.Duration{'s': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+  if n := len(value); n > 1 {
+    if unit, ok := units[value[n-1]]; ok {
+      if count, err := strconv.Atoi(value[:n-1]); err == nil && count >= 0 {
+        return now.Add(-time.Duration(count) * unit), nil
+      }
+    }
+  }
+  return time.Time{}, fmt.Errorf("%s: invalid time", value)
+}
@@ -0,0 +1,166 @@
+package executor
+
+import (
+  "bytes"
+  "encoding/json"
+  "os"
+  "path/filepath"
+  "slices"
+  "strings"
+  "testing"
+  "time"
+)
+
+// historyDBFixture points HISTDB at a temp file holding records
+func historyDBFixture(t *testing.T, records ...histRecord) string {
+  filename := filepath.Join(t.TempDir(), "history.jsonl")
+  var data []byte
+  for _, record := range records {
+    line, _ := json.Marshal(record)
+    data = append(append(data, line...), '\n')
+  }
+  os.WriteFile(filename, data, 0600)
+  t.Setenv("HISTDB", filename)
+  return filename
+}
+
+func TestRecordHistory(t *testing.T) {
+  filename := historyDBFixture(t)
+  start := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+
+  entry := HistEntry{Line: "make test", Time: start, Dir: "/src"}
+  if err := RecordHistory(entry, 1500*time.Millisecond, 2); err != nil {
+    t.Fatalf("RecordHistory: %v", err)
+  }
+  if err := RecordHistory(HistEntry{Line: "ls", Time: start, Dir: "/"}, 0, 0); err != nil {
+    t.Fatalf("RecordHistory: %v", err)
+  }
+
+  records, err := readHistoryDB(filename)
+  if err != nil || len(records) != 2 {
+    t.Fatalf("readHistoryDB = %+v, %v", records, err)
+  }
+  host, _ := os.Hostname()
+  expected := histRecord{"make test", "/src", start, 1500, 2, host, historySession}
+  if got := records[0]; got.Command != expected.Command || got.Dir != expected.Dir || !got.Start.Equal(start) || got.Duration != expected.Duration || got.Status != expected.Status || got.Host != expected.Host || got.Session != expected.Session {
+    t.Errorf("record = %+v, expected %+v", got, expected)
+  }
+}
+
+func TestRecordHistoryWithoutHISTDB(t *testing.T) {
+  t.Setenv("HISTDB", "")
+  if err := RecordHistory(HistEntry{Line: "ls"}, 0, 0); err != nil {
+    t.Errorf("RecordHistory without HISTDB = %v", err)
+  }
+}
+
+func TestHistoryDirsFromHISTDB(t *testing.T) {
+  start := time.Unix(1700000000, 0)
+  historyDBFixture(t,
+    histRecord{Command: "make", Dir: "/src", Start: start},
+    histRecord{Command: "make", Dir: "/tmp", Start: start.Add(time.Hour)},
+    histRecord{Command: "ls", Dir: "/old", Start: start},
+    histRecord{Command: "ls", Dir: "/new", Start: start.Add(time.Minute)},
+  )
+  filename := historyFixture(t)
+  os.WriteFile(filename, []byte("#1700000000\nmake\nls\npwd\n"), 0600)
+
+  Hist = nil
+  if err := LoadHistory(filename); err != nil {
+    t.Fatal(err)
+  }
+  dirs := make([]string, 0, len(Hist))
+  for _, entry := range Hist {
+    dirs = append(dirs, entry.Dir)
+  }
+  // The stamped make is the first run, ls without a time the latest, and
+  // pwd was never recorded
+  if expected := []string{"/src", "/new", ""}; !slices.Equal(dirs, expected) {
+    t.Errorf("Dirs of %q = %q, expected %q", historyLines(), dirs, expected)
+  }
+}
+
+func TestHistoryQuery(t *testing.T) {
+  day := time.Date(2026, 10, 19, 9, 0, 0, 0, time.Local)
+  historyDBFixture(t,
+    histRecord{"make", "/src", day, 2000, 0, "box", "old"},
+    histRecord{"make test", "/src", day.Add(time.Hour), 350, 2, "box", "old"},
+    histRecord{"ls", "/tmp", day.Add(2 * time.Hour), 1, 0, "laptop", historySession},
+    histRecord{"make install", "/tmp", day.Add(3 * time.Hour), 10, 1, "box", historySession},
+  )
+  // A line that isn't a record is skipped
+  file, _ := os.OpenFile(os.Getenv("HISTDB"), os.O_WRONLY|os.O_APPEND, 0600)
+  file.WriteString("{broken\n")
+  file.Close()
+
+  all := []string{
+    "2026-10-19 09:00:00  0  2s  /src  make",
+    "2026-10-19 10:00:00  2  350ms  /src  make test",
+    "2026-10-19 11:00:00  0  1ms  /tmp  ls",
+    "2026-10-19 12:00:00  1  10ms  /tmp  make install",
+  }
+  lines := func(indexes ...int) string {
+    var out strings.Builder
+    for _, i := range indexes {
+      out.WriteString(all[i] + "\n")
+    }
+    return out.String()
+  }
+
+  tests := []struct {
+    name     string
+    args     []string
+    expected string
+    errOut   string
+    status   int
+  }{
+    {"Everything", []string{}, lines(0, 1, 2, 3), "", 0},
+    {"Directory", []string{"--dir", "/src"}, lines(0, 1), "", 0},
+    {"Status", []string{"--status", "0"}, lines(0, 2), "", 0},
+    {"Failed", []string{"--failed"}, lines(1, 3), "", 0},
+    {"Since", []string{"--since", "2026-10-19 10:30"}, lines(2, 3), "", 0},
+    {"Until", []string{"--until", "2026-10-19 10:00:00"}, lines(0, 1), "", 0},
+    {"Time window", []string{"--since", "2026-10-19 09:30", "--until", "2026-10-19 11:00"}, lines(1, 2), "", 0},
+    {"Host", []string{"--host", "laptop"}, lines(2), "", 0},
+    {"Session", []string{"--session"}, lines(2, 3), "", 0},
+    {"Text", []string{"--dir", "/tmp", "make"}, lines(3), "", 0},
+    {"Bad status", []string{"--status", "x"}, "", "history: --status: x: numeric argument required\n", 1},
+    {"Bad time", []string{"--since", "soon"}, "", "history: --since: soon: invalid time\n", 1},
+    {"Missing argument", []string{"--dir"}, "", "history: --query: --dir: option requires an argument\n" + historyQueryUsage + "\n", 2},
+    {"Bad option", []string{"--cwd", "/"}, "", "history: --query: --cwd: invalid option\n" + historyQueryUsage + "\n", 2},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var stdout, stderr bytes.Buffer
+      status := runHistory(append([]string{"--query"}, test.args...), &stdout, &stderr)
+      if stdout.String() != test.expected || stderr.String() != test.errOut || status != test.status {
+        t.Errorf("history --query %v = %q, %q, %d, expected %q, %q, %d", test.args, stdout.String(), stderr.String(), status, test.expected, test.errOut, test.status)
+      }
+    })
+  }
+}
+
+func TestParseQueryTime(t *testing.T) {
+  now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+  tests := []struct {
+    value    string
+    expected time.Time
+  }{
+    {"2026-10-18", time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local)},
+    {"2026-10-18 08:15", time.Date(2026, 10, 18, 8, 15, 0, 0, time.Local)},
+    {"2026-10-18T08:15:00Z", time.Date(2026, 10, 18, 8, 15, 0, 0, time.UTC)},
+    {"90m", now.Add(-90 * time.Minute)},
+    {"2d", now.Add(-48 * time.Hour)},
+    {"1w", now.Add(-7 * 24 * time.Hour)},
+  }
+
+  for _, test := range tests {
+    t.Run(test.value, func(t *testing.T) {
+      result, err := parseQueryTime(test.value, now)
+      if err != nil || !result.Equal(test.expected) {
+        t.Errorf("parseQueryTime(%q) = %v, %v, expected %v", test.value, result, err, test.expected)
+      }
+    })
+  }
+}
@@ -0,0 +1,443 @@
+package executor
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+)
+
+// histSubst is the last :s substitution, which :& and an empty old string
+// reuse
+var histSubst struct {
+  old, new string
+  set bool
+}
+
+// histSearch is the string of the last !?string? search and histSearchWord
+// the word it matched, which !% refers to
+var histSearch, histSearchWord string
+
+// histChars returns the history expansion, quick substitution and comment
+// characters from $histchars, "!^#" unless it's set. A zero byte turns the
+// feature off.
+func histChars() (expand, quick, comment byte) {
+  value, ok := os.LookupEnv("histchars")
+  if !ok {
+    return '!', '^', '#'
+  }
+  var chars [3]byte
+  copy(chars[:], value)
+  return chars[0], chars[1], chars[2]
+}
+
+// ExpandHistory performs history expansion on a line read interactively,
+// before it's recorded or lexed. It returns the expanded line and whether
+// a :p modifier asked for it to be printed rather than run.
+func ExpandHistory(line string) (string, bool, error) {
+  expandChar, quickChar, commentChar := histChars()
+  if expandChar == 0 {
+    return line, false, nil
+  }
+  // ^old^new^ is short for !!:s^old^new^
+  if quickChar != 0 && strings.HasPrefix(line, string(quickChar)) {
+    line = string([]byte{expandChar, expandChar, ':', 's'}) + line
+  }
+
+  var out strings.Builder
+  printOnly := false
+  inDouble := false
+  for i := 0; i < len(line); {
+    c := line[i]
+    switch {
+    case c == '\\' && i+1 < len(line):
+      out.WriteString(line[i : i+2])
+      i += 2
+      continue
+    case c == '\'' && !inDouble:
+      end := strings.IndexByte(line[i+1:], '\'')
+      if end < 0 {
+        out.WriteString(line[i:])
+        return out.String(), printOnly, nil
+      }
+      out.WriteString(line[i : i+end+2])
+      i += end + 2
+      continue
+    case c == '"':
+      inDouble = !inDouble
+    case c == commentChar && !inDouble && (i == 0 || isHistSpace(line[i-1])):
+      out.WriteString(line[i:])
+      return out.String(), printOnly, nil
+    case c == expandChar && !historyInhibited(line, i, inDouble):
+      text, next, p, err := expandEvent(line, i, out.String())
+      if err != nil {
+        return "", false, err
+      }
+      out.WriteString(text)
+      printOnly = printOnly || p
+      i = next
+      continue
+    }
+    out.WriteByte(c)
+    i++
+  }
+  return out.String(), printOnly, nil
+}
+
+func isHistSpace(c byte) bool {
+  return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isDigit(c byte) bool {
+  return c >= '0' && c <= '9'
+}
+
+// historyInhibited tells whether the expansion character at line[i] is
+// just a character: before a blank, = or (, or inside $!, ${!name} and [!...]
+func historyInhibited(line string, i int, inDouble bool) bool {
+  if i+1 >= len(line) || isHistSpace(line[i+1]) || line[i+1] == '=' || line[i+1] == '(' {
+    return true
+  }
+  if inDouble && line[i+1] == '"' {
+    return true
+  }
+  return i > 0 && (line[i-1] == '$' || line[i-1] == '[') || strings.HasSuffix(line[:i], "${")
+}
+
+// expandEvent expands the history reference starting at line[i], soFar
+// being the expanded line before it for !#. It returns the text to put in
+// its place and where the rest of the line starts.
+func expandEvent(line string, i int, soFar string) (string, int, bool, error) {
+  start := i
+  i++
+  notFound := func() error {
+    return fmt.Errorf("%s: event not found", line[start:i])
+  }
+
+  var event string
+  var err error
+  searchWord := ""
+  c := line[i]
+  switch {
+  case c == line[start]:
+    i++
+    event, err = historyEvent(-1)
+  case c == '#':
+    i++
+    event = soFar
+  case isDigit(c) || c == '-' && i+1 < len(line) && isDigit(line[i+1]):
+    j := i + 1
+    for j < len(line) && isDigit(line[j]) {
+      j++
+    }
+    n, _ := strconv.Atoi(line[i:j])
+    i = j
+    event, err = historyEvent(n)
+  case c == '?':
+    end := strings.IndexAny(line[i+1:], "?\n")
+    search := line[i+1:]
+    i = len(line)
+    if end >= 0 {
+      search = line[start+2 : start+2+end]
+      i = start + 2 + end
+      if line[i] == '?' {
+        i++
+      }
+    }
+    event, searchWord, err = searchHistory(search, true)
+  case strings.IndexByte("^$*%:", c) >= 0:
+    // A word designator alone refers to the previous command
+    event, err = historyEvent(-1)
+  default:
+    j := i
+    for j < len(line) && !isHistSpace(line[j]) && strings.IndexByte(":;&|()<>\"'", line[j]) < 0 {
+      j++
+    }
+    search := line[i:j]
+    i = j
+    event, _, err = searchHistory(search, false)
+  }
+  if err != nil {
+    return "", 0, false, notFound()
+  }
+  if searchWord != "" {
+    histSearchWord = searchWord
+  }
+
+  text := event
+  if i < len(line) && (strings.IndexByte("^$*%", line[i]) >= 0 || line[i] == ':' && i+1 < len(line) && strings.IndexByte("0123456789^$*%-", line[i+1]) >= 0) {
+    if line[i] == ':' {
+      i++
+    }
+    next, selected, ok := selectWords(line, i, historyWords(event))
+    i = next
+    if !ok {
+      return "", 0, false, fmt.Errorf("%s: bad word specifier", line[start:i])
+    }
+    text = selected
+  }
+
+  printOnly := false
+  for i+1 < len(line) && line[i] == ':' && (isLetter(line[i+1]) || line[i+1] == '&') {
+    modStart := i
+    i++
+    switch line[i] {
+    case 'h':
+      i++
+      if slash := strings.LastIndexByte(text, '/'); slash > 0 {
+        text = text[:slash]
+      } else if slash == 0 {
+        text = "/"
+      }
+    case 't':
+      i++
+      text = text[strings.LastIndexByte(text, '/')+1:]
+    case 'r':
+      i++
+      if dot := suffixStart(text); dot >= 0 {
+        text = text[:dot]
+      }
+    case 'e':
+      i++
+      if dot := suffixStart(text); dot >= 0 {
+        text = text[dot:]
+      } else {
+        text = ""
+      }
+    case 'q':
+      i++
+      text = "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+    case 'p':
+      i++
+      printOnly = true
+    case 's', '&', 'g', 'a':
+      global := false
+      if line[i] == 'g' || line[i] == 'a' {
+        global = true
+        i++
+        if i >= len(line) || line[i] != 's' && line[i] != '&' {
+          return "", 0, false, fmt.Errorf("%s: unrecognized history modifier", line[modStart:min(i+1, len(line))])
+        }
+      }
+      if line[i] == 's' {
+        i++
+        i = parseSubstitution(line, i)
+      } else {
+        i++
+      }
+      if !histSubst.set {
+        return "", 0, false, errors.New(line[modStart:i] + ": no previous substitution")
+      }
+      if !strings.Contains(text, histSubst.old) {
+        return "", 0, false, fmt.Errorf("%s: substitution failed", line[modStart:i])
+      }
+      if global {
+        text = strings.ReplaceAll(text, histSubst.old, histSubst.new)
+      } else {
+        text = strings.Replace(text, histSubst.old, histSubst.new, 1)
+      }
+    default:
+      return "", 0, false, fmt.Errorf("%s: unrecognized history modifier", line[modStart:i+1])
+    }
+  }
+  return text, i, printOnly, nil
+}
+
+func isLetter(c byte) bool {
+  return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// suffixStart finds the dot starting the file suffix of the last path
+// component of s, -1 if there is none
+func suffixStart(s string) int {
+  dot := strings.LastIndexByte(s, '.')
+  if dot < strings.LastIndexByte(s, '/') {
+    return -1
+  }
+  return dot
+}
+
+// historyEvent returns the history entry history lists as n, or for a
+// negative n, the one that many back from the end
+func historyEvent(n int) (string, error) {
+  index := n - 1
+  if n < 0 {
+    index = len(Hist) + n
+  }
+  if n == 0 || index < 0 || index >= len(Hist) {
+    return "", errors.New("event not found")
+  }
+  return Hist[index].Line, nil
+}
+
+// searchHistory finds the most recent entry starting with search, or with
+// contains set, containing it anywhere; then also the word it matched in.
+// An empty !?? search repeats the last one.
+func searchHistory(search string, contains bool) (string, string, error) {
+  if contains {
+    if search == "" {
+      search = histSearch
+    }
+    histSearch = search
+  }
+  if search == "" {
+    return "", "", errors.New("event not found")
+  }
+  for i := len(Hist) - 1; i >= 0; i-- {
+    if !contains && strings.HasPrefix(Hist[i].Line, search) {
+      return Hist[i].Line, "", nil
+    }
+    if contains && strings.Contains(Hist[i].Line, search) {
+      for _, word := range historyWords(Hist[i].Line) {
+        if strings.Contains(word, search) {
+          return Hist[i].Line, word, nil
+        }
+      }
+      return Hist[i].Line, "", nil
+    }
+  }
+  return "", "", errors.New("event not found")
+}
+
+// historyWords splits a history entry into the words designators count:
+// quoted strings stay whole and operators are words of their own
+func historyWords(line string) []string {
+  words := make([]string, 0)
+  for i := 0; i < len(line); {
+    if isHistSpace(line[i]) {
+      i++
+      continue
+    }
+    start := i
+    if strings.IndexByte(";&|<>()", line[i]) >= 0 {
+      i++
+      if i < len(line) && line[i] == line[start] && line[i] != '(' && line[i] != ')' {
+        i++
+      }
+      words = append(words, line[start:i])
+      continue
+    }
+    for i < len(line) && !isHistSpace(line[i]) && strings.IndexByte(";&|<>()", line[i]) < 0 {
+      switch line[i] {
+      case '\\':
+        i++
+      case '\'', '"':
+        quote := line[i]
+        for i++; i < len(line) && line[i] != quote; i++ {
+          if quote == '"' && line[i] == '\\' {
+            i++
+          }
+        }
+      }
+      i++
+    }
+    words = append(words, line[start:min(i, len(line))])
+  }
+  return words
+}
+
+// selectWords applies the word designator at line[i:] to words, returning
+// where it ends, the selected words joined by spaces and whether they exist
+func selectWords(line string, i int, words []string) (int, string, bool) {
+  last := len(words) - 1
+  if line[i] == '%' {
+    return i + 1, histSearchWord, histSearchWord != ""
+  }
+  if line[i] == '*' {
+    return i + 1, strings.Join(words[min(1, len(words)):], " "), true
+  }
+
+  // wordIndex reads a single word number, ^ or $
+  wordIndex := func() (int, bool) {
+    switch {
+    case i < len(line) && line[i] == '^':
+      i++
+      return 1, true
+    case i < len(line) && line[i] == '$':
+      i++
+      return last, true
+    case i < len(line) && isDigit(line[i]):
+      j := i
+      for j < len(line) && isDigit(line[j]) {
+        j++
+      }
+      n, _ := strconv.Atoi(line[i:j])
+      i = j
+      return n, true
+    }
+    return 0, false
+  }
+
+  first, ok := wordIndex()
+  if !ok && line[i] != '-' {
+    return i + 1, "", false
+  }
+  end := first
+  if i < len(line) && line[i] == '*' {
+    // x* is x-$, nothing at all when x is just past the last word
+    i++
+    if first == len(words) {
+      return i, "", true
+    }
+    end = last
+  } else if i < len(line) && line[i] == '-' {
+    i++
+    if end, ok = wordIndex(); !ok {
+      // x- is x-$ without the last word
+      end = last - 1
+    }
+  }
+  if first < 0 || first > end || end > last {
+    return i, "", false
+  }
+  return i, strings.Join(words[first:end+1], " "), true
+}
+
+// parseSubstitution reads the /old/new/ of an :s modifier at line[i:] into
+// histSubst and returns where it ends. Any character can be the delimiter,
+// a backslash quotes it, & in new stands for old, and an empty old reuses
+// the previous one or the last !?string? search.
+func parseSubstitution(line string, i int) int {
+  if i >= len(line) {
+    return i
+  }
+  delim := line[i]
+  i++
+  part := func(ampersand string) string {
+    var text strings.Builder
+    for i < len(line) && line[i] != delim {
+      c := line[i]
+      switch {
+      case c == '\\' && i+1 < len(line) && (line[i+1] == delim || line[i+1] == '&' && ampersand != ""):
+        i++
+        text.WriteByte(line[i])
+      case c == '&' && ampersand != "":
+        text.WriteString(ampersand)
+      default:
+        text.WriteByte(c)
+      }
+      i++
+    }
+    if i < len(line) {
+      i++
+    }
+    return text.String()
+  }
+
+  old := part("")
+  if old == "" {
+    if histSubst.set {
+      old = histSubst.old
+    } else {
+      old = histSearch
+    }
+  }
+  if old == "" {
+    return i
+  }
+  histSubst.old = old
+  histSubst.new = part(old)
+  histSubst.set = true
+  return i
+}
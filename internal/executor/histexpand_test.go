@@ -0,0 +1,130 @@
+package executor
+
+import (
+  "testing"
+)
+
+func TestExpandHistory(t *testing.T) {
+  hist := []string{
+    "ls -l /usr/local/lib/archive.tar.gz",
+    "git commit -m 'fix it' && git push",
+    "echo one two three",
+  }
+
+  tests := []struct {
+    name      string
+    line      string
+    expected  string
+    printOnly bool
+    err       string
+  }{
+    {"No references", "echo hi", "echo hi", false, ""},
+    {"Previous", "sudo !!", "sudo echo one two three", false, ""},
+    {"Absolute", "!1", "ls -l /usr/local/lib/archive.tar.gz", false, ""},
+    {"Relative", "!-2", "git commit -m 'fix it' && git push", false, ""},
+    {"Prefix", "!git", "git commit -m 'fix it' && git push", false, ""},
+    {"Prefix ends at colon", "!ls:0", "ls", false, ""},
+    {"Contains", "!?commit?", "git commit -m 'fix it' && git push", false, ""},
+    {"Contains to end of line", "!?one", "echo one two three", false, ""},
+    {"Search word", "vim !?tw?:%", "vim two", false, ""},
+    {"Not found", "!nope", "", false, "!nope: event not found"},
+    {"Out of range", "!9", "", false, "!9: event not found"},
+    {"Last word", "vim !$", "vim three", false, ""},
+    {"First argument", "vim !^", "vim one", false, ""},
+    {"All arguments", "printf %s !*", "printf %s one two three", false, ""},
+    {"Word zero", "!!:0", "echo", false, ""},
+    {"Range", "!!:1-2", "one two", false, ""},
+    {"Range to end", "!!:2*", "two three", false, ""},
+    {"Range without last", "!!:1-", "one two", false, ""},
+    {"Range from zero", "!!:-1", "echo one", false, ""},
+    {"Quoted word", "!2:3", "'fix it'", false, ""},
+    {"Operator words", "!2:4", "&&", false, ""},
+    {"Bad word", "!!:7", "", false, "!!:7: bad word specifier"},
+    {"Current line", "mv file !#:1.bak", "mv file file.bak", false, ""},
+    {"Head", "cd !1:$:h", "cd /usr/local/lib", false, ""},
+    {"Tail", "!1:$:t", "archive.tar.gz", false, ""},
+    {"Root", "!1:$:r", "/usr/local/lib/archive.tar", false, ""},
+    {"Extension", "!1:$:e", ".gz", false, ""},
+    {"Chained modifiers", "!1:$:t:r:r", "archive", false, ""},
+    {"Substitute", "!!:s/one/1/", "echo 1 two three", false, ""},
+    {"Substitute first only", "!2:s/git/hg/", "hg commit -m 'fix it' && git push", false, ""},
+    {"Substitute globally", "!2:gs/git/hg/", "hg commit -m 'fix it' && hg push", false, ""},
+    {"Substitute ampersand", "!!:s/one/[&]", "echo [one] two three", false, ""},
+    {"Substitute other delimiter", "!!:s|two|2|", "echo one 2 three", false, ""},
+    {"Substitution failed", "!!:s/four/4/", "", false, ":s/four/4/: substitution failed"},
+    {"Quick substitution", "^three^3^", "echo one two 3", false, ""},
+    {"Quick substitution without end", "^three^3", "echo one two 3", false, ""},
+    {"Quote", "!!:q", `'echo one two three'`, false, ""},
+    {"Print", "!!:p", "echo one two three", true, ""},
+    {"Unknown modifier", "!!:z", "", false, ":z: unrecognized history modifier"},
+    {"Single quotes", "echo '!!'", "echo '!!'", false, ""},
+    {"Double quotes", `echo "!!"`, `echo "echo one two three"`, false, ""},
+    {"Escaped", `echo \!!`, `echo \!!`, false, ""},
+    {"Before space", "echo ! x", "echo ! x", false, ""},
+    {"At end", "echo hi!", "echo hi!", false, ""},
+    {"Before equals", "[ a != b ]", "[ a != b ]", false, ""},
+    {"Last pid", "echo $!", "echo $!", false, ""},
+    {"Indirection", "echo ${!name}", "echo ${!name}", false, ""},
+    {"Bracket negation", "ls [!a]*", "ls [!a]*", false, ""},
+    {"Comment", "echo hi # !!", "echo hi # !!", false, ""},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      Hist = historyEntries(hist...)
+      histSearchWord = ""
+      t.Cleanup(func() { Hist = nil })
+
+      expanded, printOnly, err := ExpandHistory(test.line)
+      errText := ""
+      if err != nil {
+        errText = err.Error()
+      }
+      if expanded != test.expected || printOnly != test.printOnly || errText != test.err {
+        t.Errorf("ExpandHistory(%q) = %q, %v, %q, expected %q, %v, %q", test.line, expanded, printOnly, errText, test.expected, test.printOnly, test.err)
+      }
+    })
+  }
+}
+
+func TestExpandHistoryRepeatsSubstitution(t *testing.T) {
+  Hist = historyEntries("cp a.txt a.bak")
+  t.Cleanup(func() { Hist = nil })
+
+  if expanded, _, err := ExpandHistory("!!:s/a/b/"); err != nil || expanded != "cp b.txt a.bak" {
+    t.Fatalf("ExpandHistory = %q, %v", expanded, err)
+  }
+  if expanded, _, err := ExpandHistory("!!:s/a/b/:&"); err != nil || expanded != "cp b.txt b.bak" {
+    t.Errorf("ExpandHistory with :& = %q, %v", expanded, err)
+  }
+  if expanded, _, err := ExpandHistory("!!:s//c/"); err != nil || expanded != "cp c.txt a.bak" {
+    t.Errorf("ExpandHistory with empty old = %q, %v", expanded, err)
+  }
+}
+
+func TestHistchars(t *testing.T) {
+  Hist = historyEntries("echo one")
+  t.Cleanup(func() { Hist = nil })
+
+  tests := []struct {
+    histchars string
+    line      string
+    expected  string
+  }{
+    {"%", "%% two", "echo one two"},
+    {"%", "!! two", "!! two"},
+    {"!@", "@one@1", "echo 1"},
+    {"!^;", "echo ; !!", "echo ; !!"},
+    {"", "!!", "!!"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.histchars, func(t *testing.T) {
+      t.Setenv("histchars", test.histchars)
+      expanded, _, err := ExpandHistory(test.line)
+      if err != nil || expanded != test.expected {
+        t.Errorf("histchars=%q: ExpandHistory(%q) = %q, %v, expected %q", test.histchars, test.line, expanded, err, test.expected)
+      }
+    })
+  }
+}
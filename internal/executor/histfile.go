@@ -0,0 +1,377 @@
+package executor
+
+import (
+  "bytes"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "slices"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// histFile is how far the shell has read the history file, so history -n
+// and shared history take in only what other sessions have appended since.
+// info identifies the file read, since one that was rewritten meanwhile
+// can't be continued from offset.
+var histFile struct {
+  name string
+  offset int64
+  info os.FileInfo
+}
+
+// histPending holds entries other sessions appended to the history file,
+// seen while appending this session's, for history -n to take in
+var histPending []HistEntry
+
+// LoadHistory reads the history file into Hist at startup. A file that
+// doesn't exist yet is fine, it's created when history is saved.
+func LoadHistory(filename string) error {
+  if err := readHistory(filename); err != nil && !errors.Is(err, os.ErrNotExist) {
+    return err
+  }
+  return nil
+}
+
+// SyncHistory runs after each interactive command. It appends the entries
+// not yet in $HISTFILE, so sessions sharing the file add to it rather than
+// overwrite each other at exit, and with $HISTSHARE set also takes in the
+// entries other sessions have appended.
+func SyncHistory() error {
+  histfile := os.Getenv("HISTFILE")
+  if histfile == "" {
+    return nil
+  }
+  share := os.Getenv("HISTSHARE") != ""
+  if histAppended < len(Hist) || share {
+    if err := appendHistory(histfile); err != nil {
+      return err
+    }
+  }
+  if share {
+    return mergeHistory(histfile)
+  }
+  return nil
+}
+
+// historyFile is the file history -anrw work on: the argument if given,
+// otherwise $HISTFILE
+func historyFile(args []string) (string, error) {
+  if len(args) > 0 {
+    return args[0], nil
+  }
+  if histfile := os.Getenv("HISTFILE"); histfile != "" {
+    return histfile, nil
+  }
+  return "", errors.New("HISTFILE is not set")
+}
+
+func historyFileOp(op byte, filename string) error {
+  switch op {
+  case 'a':
+    if err := appendHistory(filename); err != nil {
+      return err
+    }
+    return trimHistoryFile(filename)
+  case 'n':
+    return mergeHistory(filename)
+  case 'r':
+    return readHistory(filename)
+  case 'w':
+    return saveHistory(filename)
+  }
+  return nil
+}
+
+// openHistory opens the history file and locks it, shared when flag only
+// reads and exclusive otherwise. Another session may replace the file while
+// we wait for the lock, so it only counts if the path still names the file
+// we locked; otherwise we start over with the new one.
+func openHistory(filename string, flag int) (*os.File, error) {
+  for {
+    file, err := os.OpenFile(filename, flag, 0600)
+    if err != nil {
+      return nil, err
+    }
+    if err := lockFile(file, flag != os.O_RDONLY); err != nil {
+      file.Close()
+      return nil, err
+    }
+    locked, err := file.Stat()
+    if err != nil {
+      file.Close()
+      return nil, err
+    }
+    current, err := os.Stat(filename)
+    if err == nil && os.SameFile(locked, current) {
+      return file, nil
+    }
+    // Closing releases the lock
+    file.Close()
+    if err != nil && !errors.Is(err, os.ErrNotExist) {
+      return nil, err
+    }
+  }
+}
+
+// markHistoryRead records that the shell has seen all of the history file
+func markHistoryRead(filename string, info os.FileInfo) {
+  histFile.name, histFile.offset, histFile.info = filename, info.Size(), info
+}
+
+// unreadHistory reads the entries added to the locked history file since
+// the shell last read or wrote it, and marks them read. If another session
+// rewrote the file meanwhile there's no telling which entries are new, so
+// none are taken.
+func unreadHistory(file *os.File, filename string) ([]HistEntry, error) {
+  info, err := file.Stat()
+  if err != nil {
+    return nil, err
+  }
+  offset := int64(0)
+  if histFile.info != nil && histFile.name == filename {
+    if !os.SameFile(info, histFile.info) || info.Size() < histFile.offset {
+      markHistoryRead(filename, info)
+      return nil, nil
+    }
+    offset = histFile.offset
+  }
+
+  data := make([]byte, info.Size()-offset)
+  if _, err := file.ReadAt(data, offset); err != nil && err != io.EOF {
+    return nil, err
+  }
+  markHistoryRead(filename, info)
+  entries := parseHistory(historyFileLines(data))
+  historyDirs(entries)
+  return entries, nil
+}
+
+func historyFileLines(data []byte) []string {
+  if len(data) == 0 {
+    return nil
+  }
+  return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// readHistory implements history -r, adding all of filename to the history
+func readHistory(filename string) error {
+  file, err := openHistory(filename, os.O_RDONLY)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+
+  info, err := file.Stat()
+  if err != nil {
+    return err
+  }
+  data, err := io.ReadAll(file)
+  if err != nil {
+    return err
+  }
+  // What was read came from the file, so it's not for -a to append
+  entries := parseHistory(historyFileLines(data))
+  historyDirs(entries)
+  Hist = append(Hist, entries...)
+  histAppended = len(Hist)
+  histPending = nil
+  markHistoryRead(filename, info)
+  limitHistory()
+  return nil
+}
+
+// mergeHistory implements history -n, taking in what other sessions have
+// appended to filename. It goes after the entries this session has already
+// written there and before the ones it hasn't, which -a still has to add.
+func mergeHistory(filename string) error {
+  file, err := openHistory(filename, os.O_RDONLY)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+
+  entries, err := unreadHistory(file, filename)
+  if err != nil {
+    return err
+  }
+  entries = append(histPending, entries...)
+  histPending = nil
+  Hist = slices.Insert(Hist, min(histAppended, len(Hist)), entries...)
+  histAppended = min(histAppended, len(Hist)) + len(entries)
+  limitHistory()
+  return nil
+}
+
+// appendHistory adds the entries not yet in filename to its end in one
+// write under the lock. Whatever other sessions appended since it was last
+// read goes to histPending first, so -n can still take it in.
+func appendHistory(filename string) error {
+  file, err := openHistory(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+
+  others, err := unreadHistory(file, filename)
+  if err != nil {
+    return err
+  }
+  histPending = append(histPending, others...)
+
+  var buf bytes.Buffer
+  _, stamps := os.LookupEnv("HISTTIMEFORMAT")
+  writeHistory(&buf, Hist[min(histAppended, len(Hist)):], stamps)
+  if _, err := file.Write(buf.Bytes()); err != nil {
+    return err
+  }
+  histAppended = len(Hist)
+
+  info, err := file.Stat()
+  if err != nil {
+    return err
+  }
+  markHistoryRead(filename, info)
+  return nil
+}
+
+// saveHistory implements history -w, replacing the contents of filename
+// with the newest HISTFILESIZE entries of the history
+func saveHistory(filename string) error {
+  lock, err := openHistory(filename, os.O_RDWR|os.O_CREATE)
+  if err != nil {
+    return err
+  }
+  defer lock.Close()
+
+  entries := Hist
+  if size := historyLimit("HISTFILESIZE"); size >= 0 && len(entries) > size {
+    entries = entries[len(entries)-size:]
+  }
+  _, stamps := os.LookupEnv("HISTTIMEFORMAT")
+  if err := replaceHistoryFile(filename, entries, stamps); err != nil {
+    return err
+  }
+  histAppended = len(Hist)
+  histPending = nil
+  return nil
+}
+
+// trimHistoryFile drops the oldest entries of filename beyond HISTFILESIZE,
+// keeping the timestamps of the rest
+func trimHistoryFile(filename string) error {
+  size := historyLimit("HISTFILESIZE")
+  if size < 0 {
+    return nil
+  }
+  file, err := openHistory(filename, os.O_RDWR)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+
+  // The rewrite counts as reading the file, so keep what's new in it
+  others, err := unreadHistory(file, filename)
+  if err != nil {
+    return err
+  }
+  histPending = append(histPending, others...)
+
+  data, err := io.ReadAll(file)
+  if err != nil {
+    return err
+  }
+  entries := parseHistory(historyFileLines(data))
+  if len(entries) <= size {
+    return nil
+  }
+  return replaceHistoryFile(filename, entries[len(entries)-size:], true)
+}
+
+// replaceHistoryFile writes entries to a temporary file that's then renamed
+// over filename, so nobody ever reads a half written history and a failure
+// leaves the old one as it was. The caller holds the lock on filename.
+func replaceHistoryFile(filename string, entries []HistEntry, stamps bool) error {
+  temp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+  if err != nil {
+    return err
+  }
+  defer os.Remove(temp.Name())
+
+  var buf bytes.Buffer
+  writeHistory(&buf, entries, stamps)
+  _, err = temp.Write(buf.Bytes())
+  if err == nil {
+    err = temp.Sync()
+  }
+  if closeErr := temp.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    return err
+  }
+  if err := os.Rename(temp.Name(), filename); err != nil {
+    return err
+  }
+
+  info, err := os.Stat(filename)
+  if err != nil {
+    return err
+  }
+  markHistoryRead(filename, info)
+  return nil
+}
+
+// parseHistory turns history file lines into entries, a #<epoch> line
+// giving the time of the entry after it. A line ending in an odd number of
+// backslashes goes on in the next one, the way writeHistory stores a command
+// typed over several lines.
+func parseHistory(lines []string) []HistEntry {
+  entries := make([]HistEntry, 0, len(lines))
+  var stamp time.Time
+  for i := 0; i < len(lines); i++ {
+    line := lines[i]
+    if i+1 < len(lines) && len(line) > 1 && line[0] == '#' {
+      if seconds, err := strconv.ParseInt(line[1:], 10, 64); err == nil {
+        stamp = time.Unix(seconds, 0)
+        continue
+      }
+    }
+    for i+1 < len(lines) && trailingBackslashes(line)%2 == 1 {
+      i++
+      line = line[:len(line)-1] + "\n" + lines[i]
+    }
+    entries = append(entries, HistEntry{Line: line, Time: stamp})
+    stamp = time.Time{}
+  }
+  return entries
+}
+
+// writeHistory writes entries to w, each after a #<epoch> line if stamps
+// is set and its time is known. The lines of a multi-line entry but the
+// last get a backslash added to go on in the next. A complete command never
+// ends in an odd number of backslashes, that would have escaped the newline,
+// so an entry of one line never reads back as going on. Only a line break
+// inside single quotes right after an odd number of backslashes can't be
+// told apart, and reads back a backslash short.
+func writeHistory(w io.Writer, entries []HistEntry, stamps bool) {
+  for _, entry := range entries {
+    if stamps && !entry.Time.IsZero() {
+      fmt.Fprintf(w, "#%d\n", entry.Time.Unix())
+    }
+    lines := strings.Split(entry.Line, "\n")
+    for i, line := range lines {
+      if i < len(lines)-1 && trailingBackslashes(line)%2 == 0 {
+        line += "\\"
+      }
+      fmt.Fprintf(w, "%s\n", line)
+    }
+  }
+}
+
+func trailingBackslashes(line string) int {
+  return len(line) - len(strings.TrimRight(line, "\\"))
+}
@@ -0,0 +1,175 @@
+package executor
+
+import (
+  "fmt"
+  "os"
+  "path/filepath"
+  "slices"
+  "testing"
+)
+
+// appendFile adds text to filename the way another session would
+func appendFile(t *testing.T, filename, text string) {
+  file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+  if err != nil {
+    t.Fatal(err)
+  }
+  file.WriteString(text)
+  file.Close()
+}
+
+func TestSyncHistory(t *testing.T) {
+  readFile := func(filename string) string {
+    data, _ := os.ReadFile(filename)
+    return string(data)
+  }
+
+  t.Run("Appends without clobbering", func(t *testing.T) {
+    filename := historyFixture(t, "a")
+    appendFile(t, filename, "x\n")
+    AddHistory("b")
+    if err := SyncHistory(); err != nil {
+      t.Fatal(err)
+    }
+    AddHistory("c")
+    SyncHistory()
+    if got := readFile(filename); got != "a\nx\nb\nc\n" {
+      t.Errorf("file = %q", got)
+    }
+    if historyLines() != "a,b,c" {
+      t.Errorf("history = %q, other sessions' entries only come in with -n", historyLines())
+    }
+
+    if err := historyFileOp('n', filename); err != nil {
+      t.Fatal(err)
+    }
+    if historyLines() != "a,b,c,x" {
+      t.Errorf("history after -n = %q", historyLines())
+    }
+  })
+
+  t.Run("Merge keeps unsaved entries last", func(t *testing.T) {
+    filename := historyFixture(t, "a")
+    Hist = append(Hist, historyEntries("b")...)
+    appendFile(t, filename, "x\n")
+    historyFileOp('n', filename)
+    if historyLines() != "a,x,b" {
+      t.Errorf("history after -n = %q", historyLines())
+    }
+    historyFileOp('a', filename)
+    if got := readFile(filename); got != "a\nx\nb\n" {
+      t.Errorf("file after -a = %q", got)
+    }
+  })
+
+  t.Run("Shared", func(t *testing.T) {
+    filename := historyFixture(t, "a")
+    t.Setenv("HISTSHARE", "1")
+    appendFile(t, filename, "x\n")
+    AddHistory("b")
+    SyncHistory()
+    appendFile(t, filename, "y\n")
+    SyncHistory()
+    if historyLines() != "a,b,x,y" {
+      t.Errorf("shared history = %q", historyLines())
+    }
+    if got := readFile(filename); got != "a\nx\nb\ny\n" {
+      t.Errorf("file = %q", got)
+    }
+  })
+
+  t.Run("Not set", func(t *testing.T) {
+    historyFixture(t, "a")
+    t.Setenv("HISTFILE", "")
+    AddHistory("b")
+    if err := SyncHistory(); err != nil || histAppended != 1 {
+      t.Errorf("SyncHistory without HISTFILE = %v, appended %d", err, histAppended)
+    }
+  })
+
+  t.Run("Rewritten by another session", func(t *testing.T) {
+    filename := historyFixture(t, "a", "b")
+    other := filepath.Join(filepath.Dir(filename), "other")
+    os.WriteFile(other, []byte("z\n"), 0600)
+    os.Rename(other, filename)
+    historyFileOp('n', filename)
+    if historyLines() != "a,b" {
+      t.Errorf("history after -n of a rewritten file = %q", historyLines())
+    }
+    appendFile(t, filename, "y\n")
+    historyFileOp('n', filename)
+    if historyLines() != "a,b,y" {
+      t.Errorf("history after -n = %q", historyLines())
+    }
+  })
+}
+
+func TestTrimHistoryFileIsAtomic(t *testing.T) {
+  filename := historyFixture(t, "a", "b", "c")
+  t.Setenv("HISTFILESIZE", "2")
+  before, _ := os.Stat(filename)
+  Hist = append(Hist, historyEntries("d")...)
+  if err := historyFileOp('a', filename); err != nil {
+    t.Fatal(err)
+  }
+
+  data, _ := os.ReadFile(filename)
+  if string(data) != "c\nd\n" {
+    t.Errorf("trimmed file = %q", data)
+  }
+  after, _ := os.Stat(filename)
+  if os.SameFile(before, after) {
+    t.Error("trimming rewrote the file in place, expected a new file renamed over it")
+  }
+  if after.Mode().Perm() != 0600 {
+    t.Errorf("trimmed file mode = %v", after.Mode().Perm())
+  }
+  entries, _ := os.ReadDir(filepath.Dir(filename))
+  if len(entries) != 1 {
+    t.Errorf("left behind %d files, expected just the history", len(entries))
+  }
+
+  // The shell has seen the rewritten file, so nothing is new in it
+  historyFileOp('n', filename)
+  if historyLines() != "a,b,c,d" {
+    t.Errorf("history after -n = %q", historyLines())
+  }
+}
+
+func TestMultiLineHistoryRoundTrip(t *testing.T) {
+  entries := []string{
+    "cat <<EOF\nhello\nEOF",
+    "echo 'a\n#1700000000\n'",
+    "echo 'a\\\\\nb'",
+    `echo a\\`,
+    "ls",
+  }
+
+  for _, stamps := range []bool{false, true} {
+    t.Run(fmt.Sprintf("Timestamps %v", stamps), func(t *testing.T) {
+      filename := historyFixture(t)
+      if stamps {
+        t.Setenv("HISTTIMEFORMAT", "%F ")
+      }
+      for _, entry := range entries {
+        AddHistory(entry)
+      }
+      if err := historyFileOp('w', filename); err != nil {
+        t.Fatal(err)
+      }
+
+      Hist = nil
+      if err := historyFileOp('r', filename); err != nil {
+        t.Fatal(err)
+      }
+      lines := make([]string, 0, len(Hist))
+      for _, entry := range Hist {
+        lines = append(lines, entry.Line)
+      }
+      if !slices.Equal(lines, entries) {
+        data, _ := os.ReadFile(filename)
+        t.Errorf("history read back as %q from %q, expected %q", lines, data, entries)
+      }
+    })
+  }
+}
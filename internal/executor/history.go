@@ -0,0 +1,352 @@
+package executor
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "regexp"
+  "slices"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// HistEntry is a line in the history, when it was entered and in which
+// directory. Time is zero for lines read from a history file without
+// timestamps. The file doesn't keep Dir, so for lines read from it, Dir
+// comes from $HISTDB or is empty.
+type HistEntry struct {
+  Line string
+  Time time.Time
+  Dir string
+}
+
+// HistCommand is the entry that the interactive command being run added to
+// the history, set by the shell for as long as the command runs
+var HistCommand HistEntry
+
+// histAppended is how many entries at the start of Hist are already in the
+// history file, read from it or written out. history -a appends the rest.
+var histAppended int
+
+// AddHistory records a line read interactively, unless HISTCONTROL or
+// HISTIGNORE say to leave it out, then drops the oldest entries beyond
+// HISTSIZE. line is as typed, leading blanks included for ignorespace. It
+// returns the entry and whether it was recorded.
+func AddHistory(line string) (HistEntry, bool) {
+  trimmed := strings.TrimSpace(line)
+  if trimmed == "" {
+    return HistEntry{}, false
+  }
+  control := strings.Split(os.Getenv("HISTCONTROL"), ":")
+  ignoreBoth := slices.Contains(control, "ignoreboth")
+  if (ignoreBoth || slices.Contains(control, "ignorespace")) && (line[0] == ' ' || line[0] == '\t') {
+    return HistEntry{}, false
+  }
+  if (ignoreBoth || slices.Contains(control, "ignoredups")) && len(Hist) > 0 && Hist[len(Hist)-1].Line == trimmed {
+    return HistEntry{}, false
+  }
+  if historyIgnored(trimmed) {
+    return HistEntry{}, false
+  }
+  if slices.Contains(control, "erasedups") {
+    for i := len(Hist) - 1; i >= 0; i-- {
+      if Hist[i].Line == trimmed {
+        removeHistory(i, i+1)
+      }
+    }
+  }
+  dir, _ := WorkingDir()
+  entry := HistEntry{Line: trimmed, Time: time.Now(), Dir: dir}
+  Hist = append(Hist, entry)
+  limitHistory()
+  return entry, true
+}
+
+// historyIgnored tells whether line matches one of the colon separated
+// glob patterns in HISTIGNORE. A pattern of & stands for the previous
+// history entry, and \: for a colon within a pattern.
+func historyIgnored(line string) bool {
+  ignore := os.Getenv("HISTIGNORE")
+  if ignore == "" {
+    return false
+  }
+  patterns := strings.Split(strings.ReplaceAll(ignore, `\:`, "\x00"), ":")
+  for _, pattern := range patterns {
+    pattern = strings.ReplaceAll(pattern, "\x00", ":")
+    if pattern == "&" {
+      if len(Hist) > 0 && Hist[len(Hist)-1].Line == line {
+        return true
+      }
+      continue
+    }
+    re, err := regexp.Compile("(?s)^" + globToRegexp(pattern) + "$")
+    if err == nil && re.MatchString(line) {
+      return true
+    }
+  }
+  return false
+}
+
+// historyLimit reads HISTSIZE or HISTFILESIZE, -1 meaning no limit as an
+// empty, negative or non-numeric value does. HISTSIZE is 500 when unset,
+// and HISTFILESIZE follows HISTSIZE.
+func historyLimit(name string) int {
+  value, ok := os.LookupEnv(name)
+  if !ok {
+    if name == "HISTFILESIZE" {
+      return historyLimit("HISTSIZE")
+    }
+    return 500
+  }
+  n, err := strconv.Atoi(value)
+  if err != nil || n < 0 {
+    return -1
+  }
+  return n
+}
+
+// limitHistory drops the oldest entries beyond HISTSIZE
+func limitHistory() {
+  if size := historyLimit("HISTSIZE"); size >= 0 && len(Hist) > size {
+    removeHistory(0, len(Hist)-size)
+  }
+}
+
+const historyUsage = "history: usage: history [-c] [-d offset] [n] or history -anrw [filename] or history -ps arg [arg...] or history --query [filter...]"
+
+// runHistory implements history. With no options it lists the history, or
+// its last n entries. -c clears it and -d deletes an entry or a range of
+// them. -a appends the entries added since the file was last written, -n
+// reads the lines added to it since it was last read, -r reads it all and
+// -w writes the whole history; the file defaults to $HISTFILE. -s adds its
+// arguments as an entry and -p prints them after history expansion.
+// --query searches the history database instead.
+func runHistory(args []string, stdout, stderr io.Writer) int {
+  if len(args) > 0 && args[0] == "--query" {
+    return queryHistory(args[1:], stdout, stderr)
+  }
+  clear := false
+  deleteArg, hasDelete := "", false
+  fileOp := byte(0)
+  for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && !isNumber(args[0][1:]) {
+    arg := args[0]
+    args = args[1:]
+    if arg == "--" {
+      break
+    }
+    for i := 1; i < len(arg); i++ {
+      switch arg[i] {
+      case 'c':
+        clear = true
+      case 'd':
+        hasDelete = true
+        if i+1 < len(arg) {
+          deleteArg = arg[i+1:]
+        } else if len(args) > 0 {
+          deleteArg, args = args[0], args[1:]
+        } else {
+          fmt.Fprintf(stderr, "history: -d: option requires an argument\n%s\n", historyUsage)
+          return 2
+        }
+        i = len(arg)
+      case 'a', 'n', 'r', 'w':
+        if fileOp != 0 && fileOp != arg[i] {
+          fmt.Fprintln(stderr, "history: cannot use more than one of -anrw")
+          return 1
+        }
+        fileOp = arg[i]
+      case 'p':
+        dropHistoryCommand()
+        for _, word := range args {
+          expanded, _, err := ExpandHistory(word)
+          if err != nil {
+            fmt.Fprintf(stderr, "history: %s\n", err.Error())
+            return 1
+          }
+          fmt.Fprintln(stdout, expanded)
+        }
+        return 0
+      case 's':
+        dropHistoryCommand()
+        if len(args) > 0 {
+          Hist = append(Hist, HistEntry{Line: strings.Join(args, " "), Time: time.Now()})
+          limitHistory()
+        }
+        return 0
+      default:
+        fmt.Fprintf(stderr, "history: -%c: invalid option\n%s\n", arg[i], historyUsage)
+        return 2
+      }
+    }
+  }
+
+  if clear {
+    Hist = nil
+    histAppended = 0
+  }
+  if hasDelete {
+    if err := deleteHistory(deleteArg); err != nil {
+      fmt.Fprintf(stderr, "history: %s\n", err.Error())
+      return 1
+    }
+  }
+  if fileOp != 0 {
+    filename, err := historyFile(args)
+    if err == nil {
+      err = historyFileOp(fileOp, filename)
+    }
+    if err != nil {
+      fmt.Fprintf(stderr, "history: %s\n", pathErrorText(err))
+      return 1
+    }
+    return 0
+  }
+  if clear || hasDelete {
+    return 0
+  }
+
+  limit := len(Hist)
+  if len(args) > 0 {
+    n, err := strconv.Atoi(args[0])
+    if err != nil || n < 0 {
+      fmt.Fprintf(stderr, "history: %s: numeric argument required\n", args[0])
+      return 1
+    }
+    limit = n
+  }
+  timeFormat, stamps := os.LookupEnv("HISTTIMEFORMAT")
+  for i := max(0, len(Hist)-limit); i < len(Hist); i++ {
+    stamp := ""
+    if stamps && Hist[i].Time.IsZero() {
+      stamp = "??"
+    } else if stamps {
+      stamp = strftime(timeFormat, Hist[i].Time)
+    }
+    fmt.Fprintf(stdout, "%d %s%s\n", i+1, stamp, Hist[i].Line)
+  }
+  return 0
+}
+
+func isNumber(s string) bool {
+  _, err := strconv.Atoi(s)
+  return err == nil
+}
+
+// dropHistoryCommand takes the entry of the interactive command being run,
+// the history -p or -s, back out of the history, as bash does, so only what
+// it adds remains. In a script or $PROMPT_COMMAND there's no such entry.
+func dropHistoryCommand() {
+  if HistCommand.Time.IsZero() {
+    return
+  }
+  for i := len(Hist) - 1; i >= 0; i-- {
+    if Hist[i].Line == HistCommand.Line && Hist[i].Time.Equal(HistCommand.Time) {
+      removeHistory(i, i+1)
+      break
+    }
+  }
+  HistCommand = HistEntry{}
+}
+
+// removeHistory deletes entries start to end-1, keeping histAppended
+// pointing past the same entries
+func removeHistory(start, end int) {
+  Hist = append(Hist[:start], Hist[end:]...)
+  if histAppended > end {
+    histAppended -= end - start
+  } else if histAppended > start {
+    histAppended = start
+  }
+}
+
+// deleteHistory implements history -d: arg is an offset as history lists
+// it, negative ones counting back from the end, or a start-end range
+func deleteHistory(arg string) error {
+  startArg, endArg := arg, arg
+  if dash := strings.Index(arg[min(1, len(arg)):], "-"); dash >= 0 {
+    startArg, endArg = arg[:dash+1], arg[dash+2:]
+  }
+
+  start, err := historyOffset(startArg)
+  if err != nil {
+    return err
+  }
+  end, err := historyOffset(endArg)
+  if err != nil {
+    return err
+  }
+  if end < start {
+    return fmt.Errorf("%s: history position out of range", arg)
+  }
+  removeHistory(start, end+1)
+  return nil
+}
+
+// historyOffset converts a history -d offset to an index into Hist
+func historyOffset(arg string) (int, error) {
+  n, err := strconv.Atoi(arg)
+  if err != nil {
+    return 0, fmt.Errorf("%s: numeric argument required", arg)
+  }
+  index := n - 1
+  if n < 0 {
+    index = len(Hist) + n
+  }
+  if n == 0 || index < 0 || index >= len(Hist) {
+    return 0, fmt.Errorf("%s: history position out of range", arg)
+  }
+  return index, nil
+}
+
+// strftimeLayouts maps the strftime conversions that have an equivalent
+// time layout; strftime handles the few numeric ones that don't
+var strftimeLayouts = map[byte]string{
+  'a': "Mon", 'A': "Monday", 'b': "Jan", 'h': "Jan", 'B': "January",
+  'c': "Mon Jan _2 15:04:05 2006", 'd': "02", 'D': "01/02/06", 'e': "_2",
+  'F': "2006-01-02", 'H': "15", 'I': "03", 'm': "01", 'M': "04", 'p': "PM",
+  'r': "03:04:05 PM", 'R': "15:04", 'S': "05", 'T': "15:04:05",
+  'x': "01/02/06", 'X': "15:04:05", 'y': "06", 'Y': "2006", 'z': "-0700",
+  'Z': "MST",
+}
+
+// strftime formats t like the C function, for HISTTIMEFORMAT
+func strftime(format string, t time.Time) string {
+  var out strings.Builder
+  for i := 0; i < len(format); i++ {
+    if format[i] != '%' || i+1 == len(format) {
+      out.WriteByte(format[i])
+      continue
+    }
+    i++
+    c := format[i]
+    if layout, ok := strftimeLayouts[c]; ok {
+      out.WriteString(t.Format(layout))
+      continue
+    }
+    switch c {
+    case 'j':
+      fmt.Fprintf(&out, "%03d", t.YearDay())
+    case 'k':
+      fmt.Fprintf(&out, "%2d", t.Hour())
+    case 'l':
+      fmt.Fprintf(&out, "%2d", (t.Hour()+11)%12+1)
+    case 's':
+      fmt.Fprintf(&out, "%d", t.Unix())
+    case 'u':
+      fmt.Fprintf(&out, "%d", (int(t.Weekday())+6)%7+1)
+    case 'w':
+      fmt.Fprintf(&out, "%d", t.Weekday())
+    case 'n':
+      out.WriteByte('\n')
+    case 't':
+      out.WriteByte('\t')
+    case '%':
+      out.WriteByte('%')
+    default:
+      out.WriteByte('%')
+      out.WriteByte(c)
+    }
+  }
+  return out.String()
+}
@@ -0,0 +1,364 @@
+package executor
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+// historyFixture sets the history to entries, all of them already in the
+// history file, and points HISTFILE at a temp file holding them
+func historyFixture(t *testing.T, entries ...string) string {
+  filename := filepath.Join(t.TempDir(), "history")
+  if len(entries) > 0 {
+    os.WriteFile(filename, []byte(strings.Join(entries, "\n")+"\n"), 0600)
+  }
+  t.Setenv("HISTFILE", filename)
+  Hist = historyEntries(entries...)
+  histAppended = len(entries)
+  histPending = nil
+  histFile.info = nil
+  if info, err := os.Stat(filename); err == nil {
+    markHistoryRead(filename, info)
+  }
+  t.Cleanup(func() { Hist = nil })
+  return filename
+}
+
+// historyEntries makes history entries without times of lines
+func historyEntries(lines ...string) []HistEntry {
+  entries := make([]HistEntry, 0, len(lines))
+  for _, line := range lines {
+    entries = append(entries, HistEntry{Line: line})
+  }
+  return entries
+}
+
+// historyLines joins the lines in the history with commas
+func historyLines() string {
+  lines := make([]string, 0, len(Hist))
+  for _, entry := range Hist {
+    lines = append(lines, entry.Line)
+  }
+  return strings.Join(lines, ",")
+}
+
+func TestHistory(t *testing.T) {
+  tests := []struct {
+    name     string
+    args     []string
+    expected string
+    errOut   string
+    status   int
+    hist     []string
+  }{
+    {"List", []string{}, "1 a\n2 b\n3 c\n4 d\n", "", 0, []string{"a", "b", "c", "d"}},
+    {"Last n", []string{"2"}, "3 c\n4 d\n", "", 0, []string{"a", "b", "c", "d"}},
+    {"Bad count", []string{"x"}, "", "history: x: numeric argument required\n", 1, []string{"a", "b", "c", "d"}},
+    {"Clear", []string{"-c"}, "", "", 0, nil},
+    {"Delete", []string{"-d", "2"}, "", "", 0, []string{"a", "c", "d"}},
+    {"Delete attached", []string{"-d2"}, "", "", 0, []string{"a", "c", "d"}},
+    {"Delete from end", []string{"-d", "-1"}, "", "", 0, []string{"a", "b", "c"}},
+    {"Delete range", []string{"-d", "2-3"}, "", "", 0, []string{"a", "d"}},
+    {"Delete range from end", []string{"-d", "-3--2"}, "", "", 0, []string{"a", "d"}},
+    {"Delete out of range", []string{"-d", "5"}, "", "history: 5: history position out of range\n", 1, []string{"a", "b", "c", "d"}},
+    {"Delete zero", []string{"-d", "0"}, "", "history: 0: history position out of range\n", 1, []string{"a", "b", "c", "d"}},
+    {"Delete backwards range", []string{"-d", "3-2"}, "", "history: 3-2: history position out of range\n", 1, []string{"a", "b", "c", "d"}},
+    {"Delete missing offset", []string{"-d"}, "", "history: -d: option requires an argument\n" + historyUsage + "\n", 2, []string{"a", "b", "c", "d"}},
+    {"Clear then list", []string{"-c", "-d", "1"}, "", "history: 1: history position out of range\n", 1, nil},
+    {"Store", []string{"-s", "echo", "hi"}, "", "", 0, []string{"a", "b", "c", "d", "echo hi"}},
+    {"Print", []string{"-p", "x", "y z"}, "x\ny z\n", "", 0, []string{"a", "b", "c", "d"}},
+    {"Print expanded", []string{"-p", "!!", "!b"}, "d\nb\n", "", 0, []string{"a", "b", "c", "d"}},
+    {"Print not found", []string{"-p", "!x"}, "", "history: !x: event not found\n", 1, []string{"a", "b", "c", "d"}},
+    {"Two file options", []string{"-a", "-r"}, "", "history: cannot use more than one of -anrw\n", 1, []string{"a", "b", "c", "d"}},
+    {"Invalid option", []string{"-x"}, "", "history: -x: invalid option\n" + historyUsage + "\n", 2, []string{"a", "b", "c", "d"}},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      historyFixture(t, "a", "b", "c", "d")
+      var out, errOut bytes.Buffer
+      status := runHistory(test.args, &out, &errOut)
+      if out.String() != test.expected || errOut.String() != test.errOut || status != test.status {
+        t.Errorf("history %q = %q, %q (%d), expected %q, %q (%d)", test.args, out.String(), errOut.String(), status, test.expected, test.errOut, test.status)
+      }
+      if historyLines() != strings.Join(test.hist, ",") {
+        t.Errorf("history %q left %q, expected %q", test.args, historyLines(), strings.Join(test.hist, ","))
+      }
+    })
+  }
+}
+
+func TestHistoryDropsItself(t *testing.T) {
+  defer func() { HistCommand = HistEntry{} }()
+  tests := []struct {
+    name     string
+    command  int
+    expected string
+  }{
+    {"Interactive", 2, "a,history,b"},
+    {"Only its own entry", 1, "a,history -s b,b"},
+    {"Not interactive", -1, "a,history,history -s b,b"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      historyFixture(t, "a", "history", "history -s b")
+      for i := range Hist {
+        Hist[i].Time = time.Unix(int64(1700000000+i), 0)
+      }
+      HistCommand = HistEntry{}
+      if test.command >= 0 {
+        HistCommand = Hist[test.command]
+      }
+      runHistory([]string{"-s", "b"}, &bytes.Buffer{}, &bytes.Buffer{})
+      if historyLines() != test.expected {
+        t.Errorf("history -s left %q, expected %q", historyLines(), test.expected)
+      }
+    })
+  }
+}
+
+func TestHistoryFiles(t *testing.T) {
+  readFile := func(filename string) string {
+    data, _ := os.ReadFile(filename)
+    return string(data)
+  }
+
+  t.Run("Append only new entries", func(t *testing.T) {
+    filename := historyFixture(t, "a", "b")
+    Hist = append(Hist, historyEntries("c", "d")...)
+    runHistory([]string{"-a"}, &bytes.Buffer{}, &bytes.Buffer{})
+    Hist = append(Hist, historyEntries("e")...)
+    runHistory([]string{"-a"}, &bytes.Buffer{}, &bytes.Buffer{})
+    if got := readFile(filename); got != "a\nb\nc\nd\ne\n" {
+      t.Errorf("history -a wrote %q", got)
+    }
+  })
+
+  t.Run("Append after delete", func(t *testing.T) {
+    filename := historyFixture(t, "a", "b")
+    Hist = append(Hist, historyEntries("c", "d")...)
+    runHistory([]string{"-d", "1"}, &bytes.Buffer{}, &bytes.Buffer{})
+    runHistory([]string{"-a"}, &bytes.Buffer{}, &bytes.Buffer{})
+    if got := readFile(filename); got != "a\nb\nc\nd\n" {
+      t.Errorf("history -a wrote %q", got)
+    }
+  })
+
+  t.Run("Write truncates", func(t *testing.T) {
+    filename := historyFixture(t, "a", "b", "c")
+    runHistory([]string{"-d", "2-3"}, &bytes.Buffer{}, &bytes.Buffer{})
+    runHistory([]string{"-w"}, &bytes.Buffer{}, &bytes.Buffer{})
+    if got := readFile(filename); got != "a\n" {
+      t.Errorf("history -w wrote %q", got)
+    }
+  })
+
+  t.Run("Write other file", func(t *testing.T) {
+    historyFixture(t, "a")
+    other := filepath.Join(t.TempDir(), "other")
+    runHistory([]string{"-w", other}, &bytes.Buffer{}, &bytes.Buffer{})
+    if got := readFile(other); got != "a\n" {
+      t.Errorf("history -w wrote %q", got)
+    }
+  })
+
+  t.Run("Read new lines", func(t *testing.T) {
+    filename := historyFixture(t, "a", "b")
+    os.WriteFile(filename, []byte("a\nb\nc\nd\n"), 0600)
+    runHistory([]string{"-n"}, &bytes.Buffer{}, &bytes.Buffer{})
+    runHistory([]string{"-n"}, &bytes.Buffer{}, &bytes.Buffer{})
+    if historyLines() != "a,b,c,d" {
+      t.Errorf("history -n left %q", historyLines())
+    }
+  })
+
+  t.Run("Read whole file", func(t *testing.T) {
+    historyFixture(t, "a", "b")
+    runHistory([]string{"-r"}, &bytes.Buffer{}, &bytes.Buffer{})
+    if historyLines() != "a,b,a,b" {
+      t.Errorf("history -r left %q", historyLines())
+    }
+  })
+
+  t.Run("No HISTFILE", func(t *testing.T) {
+    historyFixture(t)
+    t.Setenv("HISTFILE", "")
+    var errOut bytes.Buffer
+    status := runHistory([]string{"-w"}, &bytes.Buffer{}, &errOut)
+    if status != 1 || errOut.String() != "history: HISTFILE is not set\n" {
+      t.Errorf("history -w = %q (%d)", errOut.String(), status)
+    }
+  })
+
+  t.Run("Missing file", func(t *testing.T) {
+    historyFixture(t)
+    var errOut bytes.Buffer
+    status := runHistory([]string{"-r", "/nonexistent/history"}, &bytes.Buffer{}, &errOut)
+    if status != 1 || errOut.String() != "history: /nonexistent/history: No such file or directory\n" {
+      t.Errorf("history -r = %q (%d)", errOut.String(), status)
+    }
+  })
+}
+
+func TestLoadHistory(t *testing.T) {
+  filename := historyFixture(t)
+  if err := LoadHistory(filename); err != nil || len(Hist) != 0 {
+    t.Fatalf("LoadHistory of a missing file = %v, %q", err, historyLines())
+  }
+  os.WriteFile(filename, []byte("a\nb\n"), 0600)
+  if err := LoadHistory(filename); err != nil || historyLines() != "a,b" {
+    t.Fatalf("LoadHistory = %v, %q", err, historyLines())
+  }
+  Hist = append(Hist, historyEntries("c")...)
+  runHistory([]string{"-a"}, &bytes.Buffer{}, &bytes.Buffer{})
+  data, _ := os.ReadFile(filename)
+  if string(data) != "a\nb\nc\n" {
+    t.Errorf("history -a after LoadHistory wrote %q", data)
+  }
+}
+
+func TestAddHistory(t *testing.T) {
+  tests := []struct {
+    name     string
+    env      map[string]string
+    lines    []string
+    expected string
+  }{
+    {"Blank lines", nil, []string{"a", "  ", ""}, "a"},
+    {"Trimmed", nil, []string{"  a  "}, "a"},
+    {"Duplicates kept", nil, []string{"a", "a"}, "a,a"},
+    {"Ignore space", map[string]string{"HISTCONTROL": "ignorespace"}, []string{"a", " b", "\tc"}, "a"},
+    {"Ignore dups", map[string]string{"HISTCONTROL": "ignoredups"}, []string{"a", "a", "b", "a"}, "a,b,a"},
+    {"Ignore both", map[string]string{"HISTCONTROL": "ignoreboth"}, []string{"a", "a", " b"}, "a"},
+    {"Erase dups", map[string]string{"HISTCONTROL": "erasedups"}, []string{"a", "b", "a", "c", "a"}, "b,c,a"},
+    {"Several options", map[string]string{"HISTCONTROL": "ignorespace:erasedups"}, []string{"a", "b", "a", " b"}, "b,a"},
+    {"Ignore patterns", map[string]string{"HISTIGNORE": "ls:cd *"}, []string{"ls", "ls -l", "cd /tmp", "cd"}, "ls -l,cd"},
+    {"Ignore previous", map[string]string{"HISTIGNORE": "&"}, []string{"a", "a", "b"}, "a,b"},
+    {"Escaped colon", map[string]string{"HISTIGNORE": `echo a\:b`}, []string{"echo a:b", "echo a"}, "echo a"},
+    {"Size", map[string]string{"HISTSIZE": "2"}, []string{"a", "b", "c"}, "b,c"},
+    {"Size zero", map[string]string{"HISTSIZE": "0"}, []string{"a", "b"}, ""},
+    {"Size unlimited", map[string]string{"HISTSIZE": ""}, []string{"a", "b", "c"}, "a,b,c"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      historyFixture(t)
+      for _, name := range []string{"HISTCONTROL", "HISTIGNORE", "HISTSIZE"} {
+        t.Setenv(name, test.env[name])
+        if _, ok := test.env[name]; !ok {
+          os.Unsetenv(name)
+        }
+      }
+      for _, line := range test.lines {
+        AddHistory(line)
+      }
+      if got := historyLines(); got != test.expected {
+        t.Errorf("history after %q = %q, expected %q", test.lines, got, test.expected)
+      }
+    })
+  }
+}
+
+func TestHistoryFileSize(t *testing.T) {
+  readFile := func(filename string) string {
+    data, _ := os.ReadFile(filename)
+    return string(data)
+  }
+
+  t.Run("Write", func(t *testing.T) {
+    filename := historyFixture(t, "a", "b", "c")
+    t.Setenv("HISTFILESIZE", "2")
+    runHistory([]string{"-w"}, &bytes.Buffer{}, &bytes.Buffer{})
+    if got := readFile(filename); got != "b\nc\n" {
+      t.Errorf("history -w wrote %q", got)
+    }
+  })
+
+  t.Run("Append", func(t *testing.T) {
+    filename := historyFixture(t, "a", "b")
+    t.Setenv("HISTFILESIZE", "3")
+    Hist = append(Hist, historyEntries("c", "d")...)
+    runHistory([]string{"-a"}, &bytes.Buffer{}, &bytes.Buffer{})
+    if got := readFile(filename); got != "b\nc\nd\n" {
+      t.Errorf("history -a wrote %q", got)
+    }
+  })
+
+  t.Run("Follows HISTSIZE", func(t *testing.T) {
+    filename := historyFixture(t, "a", "b", "c")
+    t.Setenv("HISTSIZE", "1")
+    runHistory([]string{"-w"}, &bytes.Buffer{}, &bytes.Buffer{})
+    if got := readFile(filename); got != "c\n" {
+      t.Errorf("history -w wrote %q", got)
+    }
+  })
+
+  t.Run("Shorter file", func(t *testing.T) {
+    filename := historyFixture(t, "first line is long", "b")
+    Hist = historyEntries("c")
+    runHistory([]string{"-w"}, &bytes.Buffer{}, &bytes.Buffer{})
+    if got := readFile(filename); got != "c\n" {
+      t.Errorf("history -w wrote %q", got)
+    }
+  })
+}
+
+func TestHistoryTimestamps(t *testing.T) {
+  filename := historyFixture(t)
+  os.WriteFile(filename, []byte("#1700000000\nmake\nls\n#1700000060\n#notstamp\n"), 0600)
+  if err := LoadHistory(filename); err != nil {
+    t.Fatal(err)
+  }
+  if historyLines() != "make,ls,#notstamp" || Hist[0].Time.Unix() != 1700000000 || !Hist[1].Time.IsZero() || Hist[2].Time.Unix() != 1700000060 {
+    t.Fatalf("LoadHistory read %+v", Hist)
+  }
+
+  t.Setenv("TZ", "UTC")
+  t.Setenv("HISTTIMEFORMAT", "%F %T ")
+  var out bytes.Buffer
+  runHistory([]string{"2"}, &out, &bytes.Buffer{})
+  if expected := "2 ??ls\n3 " + strftime("%F %T ", Hist[2].Time) + "#notstamp\n"; out.String() != expected {
+    t.Errorf("history with HISTTIMEFORMAT = %q, expected %q", out.String(), expected)
+  }
+
+  runHistory([]string{"-w"}, &bytes.Buffer{}, &bytes.Buffer{})
+  data, _ := os.ReadFile(filename)
+  if string(data) != "#1700000000\nmake\nls\n#1700000060\n#notstamp\n" {
+    t.Errorf("history -w with HISTTIMEFORMAT wrote %q", data)
+  }
+
+  os.Unsetenv("HISTTIMEFORMAT")
+  runHistory([]string{"-w"}, &bytes.Buffer{}, &bytes.Buffer{})
+  data, _ = os.ReadFile(filename)
+  if string(data) != "make\nls\n#notstamp\n" {
+    t.Errorf("history -w without HISTTIMEFORMAT wrote %q", data)
+  }
+}
+
+func TestStrftime(t *testing.T) {
+  stamp := time.Date(2024, time.March, 5, 14, 7, 9, 0, time.UTC)
+  tests := []struct {
+    format   string
+    expected string
+  }{
+    {"%F %T", "2024-03-05 14:07:09"},
+    {"%d/%m/%y %H:%M", "05/03/24 14:07"},
+    {"%a %b %e", "Tue Mar  5"},
+    {"%I:%M %p", "02:07 PM"},
+    {"%j %u %w", "065 2 2"},
+    {"%s", "1709647629"},
+    {"100%% %q", "100% %q"},
+    {"trailing %", "trailing %"},
+  }
+
+  for _, test := range tests {
+    if got := strftime(test.format, stamp); got != test.expected {
+      t.Errorf("strftime(%q) = %q, expected %q", test.format, got, test.expected)
+    }
+  }
+}
@@ -0,0 +1,441 @@
+package executor
+
+import (
+  "fmt"
+  "io"
+  "strconv"
+  "strings"
+  "unicode/utf8"
+)
+
+// runEcho implements echo with the -n, -e and -E options. Option parsing
+// stops at the first argument that isn't made only of those letters.
+func runEcho(args []string, stdout io.Writer) int {
+  newline := true
+  escapes := false
+  for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && strings.Trim(args[0][1:], "neE") == "" {
+    for _, flag := range args[0][1:] {
+      switch flag {
+      case 'n':
+        newline = false
+      case 'e':
+        escapes = true
+      case 'E':
+        escapes = false
+      }
+    }
+    args = args[1:]
+  }
+
+  output := strings.Join(args, " ")
+  if escapes {
+    var stop bool
+    output, stop = expandEscapes(output, false)
+    if stop {
+      newline = false
+    }
+  }
+  if newline {
+    output += "\n"
+  }
+  fmt.Fprint(stdout, output)
+  return 0
+}
+
+// expandEscapes interprets backslash escapes the way echo -e and printf's %b
+// do. In a printf format (inFormat) octal escapes are \nnn, otherwise \0nnn.
+// stop reports a \c, after which no more output should be produced.
+func expandEscapes(s string, inFormat bool) (result string, stop bool) {
+  var out strings.Builder
+  for i := 0; i < len(s); i++ {
+    if s[i] != '\\' || i+1 == len(s) {
+      out.WriteByte(s[i])
+      continue
+    }
+
+    i++
+    switch c := s[i]; c {
+    case 'a':
+      out.WriteByte('\a')
+    case 'b':
+      out.WriteByte('\b')
+    case 'c':
+      return out.String(), true
+    case 'e', 'E':
+      out.WriteByte('\033')
+    case 'f':
+      out.WriteByte('\f')
+    case 'n':
+      out.WriteByte('\n')
+    case 'r':
+      out.WriteByte('\r')
+    case 't':
+      out.WriteByte('\t')
+    case 'v':
+      out.WriteByte('\v')
+    case '\\':
+      out.WriteByte('\\')
+    case '"':
+      if inFormat {
+        out.WriteByte('"')
+      } else {
+        out.WriteString("\\\"")
+      }
+    case 'x':
+      end := i + 1
+      for end < len(s) && end < i+3 && isHexDigit(s[end]) {
+        end++
+      }
+      if end == i+1 {
+        out.WriteString("\\x")
+        continue
+      }
+      code, _ := strconv.ParseUint(s[i+1:end], 16, 8)
+      out.WriteByte(byte(code))
+      i = end - 1
+    case '0', '1', '2', '3', '4', '5', '6', '7':
+      start := i
+      if !inFormat {
+        if c != '0' {
+          out.WriteByte('\\')
+          out.WriteByte(c)
+          continue
+        }
+        // \0nnn: up to three digits after the zero
+        start = i + 1
+      }
+      end := start
+      for end < len(s) && end < start+3 && s[end] >= '0' && s[end] <= '7' {
+        end++
+      }
+      code := uint64(0)
+      if end > start {
+        code, _ = strconv.ParseUint(s[start:end], 8, 16)
+      }
+      out.WriteByte(byte(code))
+      i = end - 1
+    default:
+      out.WriteByte('\\')
+      out.WriteByte(c)
+    }
+  }
+  return out.String(), false
+}
+
+func isHexDigit(c byte) bool {
+  return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// runPrintf implements the printf builtin. The format is reused for as long
+// as arguments remain; missing arguments count as "" or 0. With -v the
+// result is assigned to a variable instead of printed.
+func runPrintf(args []string, stdout, stderr io.Writer) int {
+  varName := ""
+  if len(args) >= 2 && args[0] == "-v" {
+    varName = args[1]
+    args = args[2:]
+  }
+  if len(args) > 0 && args[0] == "--" {
+    args = args[1:]
+  }
+  if len(args) == 0 {
+    fmt.Fprintln(stderr, "printf: usage: printf [-v var] format [arguments]")
+    return 2
+  }
+
+  p := &printfState{format: args[0], args: args[1:], stderr: stderr}
+  var out strings.Builder
+  for {
+    consumed := p.next
+    stop := p.formatOnce(&out)
+    if stop || p.next >= len(p.args) || p.next == consumed {
+      break
+    }
+  }
+
+  if varName != "" {
+    if err := SetVar(varName, out.String()); err != nil {
+      fmt.Fprintf(stderr, "printf: %s\n", err.Error())
+      return 2
+    }
+  } else {
+    fmt.Fprint(stdout, out.String())
+  }
+  return p.status
+}
+
+type printfState struct {
+  format string
+  args   []string
+  next   int
+  status int
+  stderr io.Writer
+}
+
+func (p *printfState) arg() (string, bool) {
+  if p.next >= len(p.args) {
+    return "", false
+  }
+  p.next++
+  return p.args[p.next-1], true
+}
+
+// formatOnce writes one pass over the format, returning true if a \c in a
+// %b argument asked for output to stop
+func (p *printfState) formatOnce(out *strings.Builder) bool {
+  f := p.format
+  for i := 0; i < len(f); i++ {
+    switch f[i] {
+    case '\\':
+      end := i + 1
+      if end < len(f) {
+        switch {
+        case f[end] == 'x':
+          end++
+          for end < len(f) && end < i+4 && isHexDigit(f[end]) {
+            end++
+          }
+        case f[end] >= '0' && f[end] <= '7':
+          for end < len(f) && end < i+4 && f[end] >= '0' && f[end] <= '7' {
+            end++
+          }
+        default:
+          end++
+        }
+      }
+      text, stop := expandEscapes(f[i:end], true)
+      out.WriteString(text)
+      if stop {
+        return true
+      }
+      i = end - 1
+    case '%':
+      end, stop := p.conversion(out, i)
+      if stop {
+        return true
+      }
+      i = end
+    default:
+      out.WriteByte(f[i])
+    }
+  }
+  return false
+}
+
+// conversion handles the % directive starting at start and returns the index
+// of its last byte
+func (p *printfState) conversion(out *strings.Builder, start int) (int, bool) {
+  f := p.format
+  i := start + 1
+  if i < len(f) && f[i] == '%' {
+    out.WriteByte('%')
+    return i, false
+  }
+
+  spec := strings.Builder{}
+  spec.WriteByte('%')
+  for i < len(f) && strings.IndexByte("-+ #0", f[i]) >= 0 {
+    spec.WriteByte(f[i])
+    i++
+  }
+  i = p.number(&spec, i)
+  precision := i < len(f) && f[i] == '.'
+  if precision {
+    spec.WriteByte('.')
+    i = p.number(&spec, i+1)
+  }
+  if i >= len(f) {
+    out.WriteString(f[start:])
+    return len(f) - 1, false
+  }
+
+  verb := f[i]
+  arg, _ := p.arg()
+  switch verb {
+  case 'd', 'i':
+    spec.WriteByte('d')
+    fmt.Fprintf(out, spec.String(), p.integer(arg))
+  case 'u', 'o', 'x', 'X':
+    if verb == 'u' {
+      verb = 'd'
+    }
+    spec.WriteByte(verb)
+    fmt.Fprintf(out, spec.String(), uint64(p.integer(arg)))
+  case 'f', 'F', 'e', 'E', 'g', 'G':
+    if verb == 'F' {
+      verb = 'f'
+    }
+    // C's %g has 6 significant digits by default, Go's as many as it takes
+    if (verb == 'g' || verb == 'G') && !precision {
+      spec.WriteString(".6")
+    }
+    spec.WriteByte(verb)
+    fmt.Fprintf(out, spec.String(), p.float(arg))
+  case 'c':
+    spec.WriteByte('s')
+    r, size := utf8.DecodeRuneInString(arg)
+    if size == 0 {
+      fmt.Fprintf(out, spec.String(), "")
+    } else {
+      fmt.Fprintf(out, spec.String(), string(r))
+    }
+  case 's':
+    spec.WriteByte('s')
+    fmt.Fprintf(out, spec.String(), arg)
+  case 'b':
+    text, stop := expandEscapes(arg, false)
+    spec.WriteByte('s')
+    fmt.Fprintf(out, spec.String(), text)
+    if stop {
+      return i, true
+    }
+  case 'q':
+    spec.WriteByte('s')
+    fmt.Fprintf(out, spec.String(), shellQuote(arg))
+  default:
+    fmt.Fprintf(p.stderr, "printf: %%%c: invalid format character\n", verb)
+    p.status = 1
+    return len(f) - 1, false
+  }
+  return i, false
+}
+
+// number copies a width or precision at i into spec, taking it from the
+// next argument for '*'
+func (p *printfState) number(spec *strings.Builder, i int) int {
+  f := p.format
+  if i < len(f) && f[i] == '*' {
+    arg, _ := p.arg()
+    spec.WriteString(strconv.FormatInt(p.integer(arg), 10))
+    return i + 1
+  }
+  for i < len(f) && f[i] >= '0' && f[i] <= '9' {
+    spec.WriteByte(f[i])
+    i++
+  }
+  return i
+}
+
+// integer converts a numeric argument like strtol would: decimal, 0x hex,
+// leading-0 octal, or 'c for the character code of c
+func (p *printfState) integer(arg string) int64 {
+  s := strings.TrimSpace(arg)
+  if s == "" {
+    return 0
+  }
+  if s[0] == '\'' || s[0] == '"' {
+    r, _ := utf8.DecodeRuneInString(s[1:])
+    if len(s) == 1 {
+      return 0
+    }
+    return int64(r)
+  }
+
+  n, err := strtol(s)
+  if err != nil {
+    fmt.Fprintf(p.stderr, "printf: %s: invalid number\n", arg)
+    p.status = 1
+    return 0
+  }
+  return n
+}
+
+// strtol parses s with an optional sign and then 0x or 0X for hex, a leading
+// 0 for octal or else decimal, without the 0b, 0o or underscores that Go's
+// own syntax would allow. Values past int64 wrap the way C's do as unsigned.
+func strtol(s string) (int64, error) {
+  sign, digits := "", s
+  if digits != "" && (digits[0] == '+' || digits[0] == '-') {
+    sign, digits = digits[:1], digits[1:]
+  }
+  base := 10
+  switch {
+  case len(digits) > 2 && (digits[:2] == "0x" || digits[:2] == "0X"):
+    base, digits = 16, digits[2:]
+  case len(digits) > 1 && digits[0] == '0':
+    base, digits = 8, digits[1:]
+  }
+  if digits == "" || digits[0] == '+' || digits[0] == '-' {
+    return 0, strconv.ErrSyntax
+  }
+
+  n, err := strconv.ParseInt(sign+digits, base, 64)
+  if err != nil && sign != "-" {
+    u, uerr := strconv.ParseUint(digits, base, 64)
+    if uerr == nil {
+      return int64(u), nil
+    }
+  }
+  return n, err
+}
+
+func (p *printfState) float(arg string) float64 {
+  s := strings.TrimSpace(arg)
+  if s == "" {
+    return 0
+  }
+  if s[0] == '\'' || s[0] == '"' {
+    return float64(p.integer(s))
+  }
+  f, err := strconv.ParseFloat(s, 64)
+  if err != nil {
+    fmt.Fprintf(p.stderr, "printf: %s: invalid number\n", arg)
+    p.status = 1
+    return 0
+  }
+  return f
+}
+
+// shellQuote renders s so that the shell would read it back as one word,
+// the way %q does: backslashes for ordinary specials, $'...' when there are
+// control characters
+func shellQuote(s string) string {
+  if s == "" {
+    return "''"
+  }
+
+  hasControl := false
+  for _, r := range s {
+    if r < ' ' || r == 0x7f {
+      hasControl = true
+      break
+    }
+  }
+
+  if hasControl {
+    var out strings.Builder
+    out.WriteString("$'")
+    for i := 0; i < len(s); i++ {
+      switch c := s[i]; c {
+      case '\n':
+        out.WriteString("\\n")
+      case '\t':
+        out.WriteString("\\t")
+      case '\r':
+        out.WriteString("\\r")
+      case '\033':
+        out.WriteString("\\E")
+      case '\'', '\\':
+        out.WriteByte('\\')
+        out.WriteByte(c)
+      default:
+        if c < ' ' || c == 0x7f {
+          fmt.Fprintf(&out, "\\%03o", c)
+        } else {
+          out.WriteByte(c)
+        }
+      }
+    }
+    out.WriteString("'")
+    return out.String()
+  }
+
+  var out strings.Builder
+  for i := 0; i < len(s); i++ {
+    if strings.IndexByte(" \t!\"#$&'()*,;<=>?[\\]^`{|}~", s[i]) >= 0 {
+      out.WriteByte('\\')
+    }
+    out.WriteByte(s[i])
+  }
+  return out.String()
+}
@@ -0,0 +1,105 @@
+package executor
+
+import (
+  "bytes"
+  "os"
+  "testing"
+)
+
+func TestEcho(t *testing.T) {
+  tests := []struct {
+    name     string
+    args     []string
+    expected string
+  }{
+    {"Plain", []string{"a", "b"}, "a b\n"},
+    {"No newline", []string{"-n", "a"}, "a"},
+    {"Escapes off by default", []string{"a\\tb"}, "a\\tb\n"},
+    {"Escapes", []string{"-e", "a\\tb\\n"}, "a\tb\n\n"},
+    {"Combined flags", []string{"-ne", "a\\tb"}, "a\tb"},
+    {"E after e", []string{"-e", "-E", "a\\tb"}, "a\\tb\n"},
+    {"Stop output", []string{"-e", "a\\cb", "c"}, "a"},
+    {"Octal", []string{"-e", "\\0101\\060"}, "A0\n"},
+    {"Hex", []string{"-e", "\\x41\\x4a"}, "AJ\n"},
+    {"Not an option", []string{"-x", "a"}, "-x a\n"},
+    {"Options end at first word", []string{"a", "-n"}, "a -n\n"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var out bytes.Buffer
+      runEcho(test.args, &out)
+      if out.String() != test.expected {
+        t.Errorf("echo %q = %q, expected %q", test.args, out.String(), test.expected)
+      }
+    })
+  }
+}
+
+func TestPrintf(t *testing.T) {
+  tests := []struct {
+    name     string
+    args     []string
+    expected string
+    status   int
+  }{
+    {"Plain format", []string{"hello\\n"}, "hello\n", 0},
+    {"Strings", []string{"[%s|%5s|%-5s|%.2s]", "a", "b", "c", "xyz"}, "[a|    b|c    |xy]", 0},
+    {"Integers", []string{"%d %i %05d %+d", "7", "-3", "42", "5"}, "7 -3 00042 +5", 0},
+    {"Bases", []string{"%o %x %X %#x", "8", "255", "255", "16"}, "10 ff FF 0x10", 0},
+    {"Number prefixes", []string{"%d %d %d", "0x10", "010", "'A"}, "16 8 65", 0},
+    {"Signed prefixes", []string{"%d %d %d %u", "-0x10", "+017", "0X1f", "0xffffffffffffffff"}, "-16 15 31 18446744073709551615", 0},
+    {"Underscores", []string{"%d", "1_000"}, "0", 1},
+    {"Go binary prefix", []string{"%d", "0b101"}, "0", 1},
+    {"Go octal prefix", []string{"%d", "0o7"}, "0", 1},
+    {"Sign after prefix", []string{"%d", "0x-5"}, "0", 1},
+    {"Bad octal digit", []string{"%d", "09"}, "0", 1},
+    {"Unsigned negative", []string{"%u", "-1"}, "18446744073709551615", 0},
+    {"Floats", []string{"%.2f %e %g", "3.14159", "1500", "0.5"}, "3.14 1.500000e+03 0.5", 0},
+    {"Default %g precision", []string{"%g %G %g %.3g", "3.14159265", "0.000012345678", "1234567", "3.14159265"}, "3.14159 1.23457E-05 1.23457e+06 3.14", 0},
+    {"Character", []string{"%c%c", "hello", "world"}, "hw", 0},
+    {"Percent", []string{"100%%"}, "100%", 0},
+    {"Star width and precision", []string{"[%*.*s]", "5", "2", "abc"}, "[   ab]", 0},
+    {"Format reused", []string{"%s=%s;", "a", "1", "b", "2"}, "a=1;b=2;", 0},
+    {"Missing arguments", []string{"%s|%d|", "x"}, "x|0|", 0},
+    {"Escapes in format", []string{"\\101\\x42\\t"}, "AB\t", 0},
+    {"Escapes in %b", []string{"%b", "a\\nb\\0101"}, "a\nbA", 0},
+    {"Stop in %b", []string{"%b%s", "a\\cb", "ignored"}, "a", 0},
+    {"Quoting", []string{"%q %q %q", "a b", "", "it's"}, "a\\ b '' it\\'s", 0},
+    {"Quoting control characters", []string{"%q", "a\nb"}, "$'a\\nb'", 0},
+    {"Invalid number", []string{"%d", "abc"}, "0", 1},
+    {"Invalid format", []string{"%z"}, "", 1},
+    {"Missing format", []string{}, "", 2},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var out, errOut bytes.Buffer
+      status := runPrintf(test.args, &out, &errOut)
+      if out.String() != test.expected {
+        t.Errorf("printf %q = %q, expected %q", test.args, out.String(), test.expected)
+      }
+      if status != test.status {
+        t.Errorf("printf %q returned %d, expected %d", test.args, status, test.status)
+      }
+    })
+  }
+}
+
+func TestPrintfAssign(t *testing.T) {
+  t.Setenv("HARSH_TEST_OUT", "")
+
+  var out, errOut bytes.Buffer
+  status := runPrintf([]string{"-v", "HARSH_TEST_OUT", "%03d-%s", "7", "x"}, &out, &errOut)
+  if status != 0 || out.Len() != 0 {
+    t.Fatalf("printf -v returned %d and printed %q", status, out.String())
+  }
+  if value := os.Getenv("HARSH_TEST_OUT"); value != "007-x" {
+    t.Errorf("HARSH_TEST_OUT = %q, expected %q", value, "007-x")
+  }
+
+  status = runPrintf([]string{"-v", "1bad", "x"}, &out, &errOut)
+  if status != 2 {
+    t.Errorf("printf -v with an invalid name returned %d, expected 2", status)
+  }
+}
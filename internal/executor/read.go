@@ -0,0 +1,286 @@
+package executor
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "strconv"
+  "strings"
+  "time"
+  "unicode/utf8"
+)
+
+type readOptions struct {
+  raw        bool
+  silent     bool
+  array      string
+  delim      byte
+  nchars     int
+  prompt     string
+  timeout    float64
+  hasTimeout bool
+  fd         int
+}
+
+const readUsage = "read: usage: read [-rs] [-a array] [-d delim] [-n nchars] [-p prompt] [-t timeout] [-u fd] [name ...]"
+
+// parseReadOptions splits the options off args. Flags can be combined and an
+// option's value can be attached (-n5) or the next argument (-n 5).
+func parseReadOptions(args []string) (readOptions, []string, error) {
+  opts := readOptions{delim: '\n', nchars: -1, fd: -1}
+  for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+    arg := args[0]
+    args = args[1:]
+    if arg == "--" {
+      break
+    }
+
+    for i := 1; i < len(arg); i++ {
+      flag := arg[i]
+      switch flag {
+      case 'r':
+        opts.raw = true
+        continue
+      case 's':
+        opts.silent = true
+        continue
+      case 'a', 'd', 'n', 'p', 't', 'u':
+      default:
+        return opts, nil, fmt.Errorf("-%c: invalid option", flag)
+      }
+
+      value := arg[i+1:]
+      if value == "" {
+        if len(args) == 0 {
+          return opts, nil, fmt.Errorf("-%c: option requires an argument", flag)
+        }
+        value = args[0]
+        args = args[1:]
+      }
+
+      var err error
+      switch flag {
+      case 'a':
+        opts.array = value
+      case 'd':
+        // An empty delimiter means NUL, which value[0] can't give
+        opts.delim = 0
+        if value != "" {
+          opts.delim = value[0]
+        }
+      case 'n':
+        opts.nchars, err = strconv.Atoi(value)
+        if err != nil || opts.nchars < 0 {
+          return opts, nil, fmt.Errorf("%s: invalid number", value)
+        }
+      case 'p':
+        opts.prompt = value
+      case 't':
+        opts.timeout, err = strconv.ParseFloat(value, 64)
+        if err != nil || opts.timeout < 0 {
+          return opts, nil, fmt.Errorf("%s: invalid timeout specification", value)
+        }
+        opts.hasTimeout = true
+      case 'u':
+        opts.fd, err = strconv.Atoi(value)
+        if err != nil || opts.fd < 0 {
+          return opts, nil, fmt.Errorf("%s: invalid file descriptor specification", value)
+        }
+      }
+      break
+    }
+  }
+  return opts, args, nil
+}
+
+// runRead implements the read builtin. It reads one byte at a time so that
+// nothing past the delimiter is taken from a shared stdin, then assigns the
+// line split on $IFS to the named variables, the last one getting the rest.
+// Each call reads a single line: the shell has no loops, so there's no
+// `while read line` to read a whole input with.
+func runRead(args []string, stdin io.Reader, stderr io.Writer) int {
+  opts, names, err := parseReadOptions(args)
+  if err != nil {
+    fmt.Fprintf(stderr, "read: %s\n", err.Error())
+    fmt.Fprintln(stderr, readUsage)
+    return 2
+  }
+  for _, name := range append([]string{opts.array}, names...) {
+    if name != "" && !isName(name) {
+      fmt.Fprintf(stderr, "read: '%s': not a valid identifier\n", name)
+      return 1
+    }
+  }
+
+  input := stdin
+  if opts.fd > 0 {
+    file, err := fdFile(opts.fd)
+    if err != nil {
+      fmt.Fprintf(stderr, "read: %s\n", err.Error())
+      return 1
+    }
+    input = file
+  }
+  file, _ := input.(*os.File)
+
+  if opts.hasTimeout && opts.timeout == 0 {
+    // -t 0 only asks whether there's input waiting
+    if file == nil {
+      return 0
+    }
+    if ready, _ := waitReadable(file, 0); !ready {
+      return 1
+    }
+    return 0
+  }
+
+  if file != nil && IsTerminal(file) {
+    if opts.prompt != "" {
+      fmt.Fprint(stderr, opts.prompt)
+    }
+    if opts.silent {
+      if restore, err := disableEcho(file); err == nil {
+        defer restore()
+      }
+    }
+    // The terminal otherwise holds input back until Enter, too late for
+    // -n or a delimiter other than newline
+    if opts.nchars >= 0 || opts.delim != '\n' {
+      if restore, err := disableCanonical(file); err == nil {
+        defer restore()
+      }
+    }
+  }
+
+  var deadline time.Time
+  if opts.hasTimeout {
+    deadline = time.Now().Add(time.Duration(opts.timeout * float64(time.Second)))
+  }
+
+  line, escaped, status := readInput(input, file, opts, deadline)
+
+  switch {
+  case opts.array != "":
+    SetArray(opts.array, splitRead(line, escaped, -1))
+  case len(names) == 0:
+    SetVar("REPLY", string(line))
+  default:
+    fields := splitRead(line, escaped, len(names))
+    for i, name := range names {
+      value := ""
+      if i < len(fields) {
+        value = fields[i]
+      }
+      SetVar(name, value)
+    }
+  }
+  return status
+}
+
+// readInput reads up to the delimiter, the character limit, end of file or
+// the deadline. Unless raw, a backslash quotes the next byte, which is marked
+// in escaped, and a backslash-newline is dropped altogether. The status is 1
+// at end of file and above 128 on timeout.
+func readInput(input io.Reader, file *os.File, opts readOptions, deadline time.Time) ([]byte, []bool, int) {
+  line := []byte{}
+  escaped := []bool{}
+  buf := make([]byte, 1)
+  count, charStart := 0, 0
+  quoteNext := false
+  for opts.nchars < 0 || count < opts.nchars {
+    if !deadline.IsZero() && file != nil {
+      if ready, _ := waitReadable(file, time.Until(deadline)); !ready {
+        return line, escaped, 128 + 14
+      }
+    }
+
+    n, err := input.Read(buf)
+    if n == 0 {
+      if err != nil {
+        return line, escaped, 1
+      }
+      continue
+    }
+
+    c := buf[0]
+    quoted := quoteNext
+    if quoteNext {
+      quoteNext = false
+      if c == '\n' {
+        continue
+      }
+    } else if c == opts.delim {
+      break
+    } else if c == '\\' && !opts.raw {
+      quoteNext = true
+      continue
+    }
+
+    line = append(line, c)
+    escaped = append(escaped, quoted)
+    if utf8.FullRune(line[charStart:]) {
+      count++
+      charStart = len(line)
+    }
+  }
+  return line, escaped, 0
+}
+
+// splitRead splits line into fields on $IFS the way read does. Runs of IFS
+// whitespace separate fields and are trimmed from the ends; any other IFS
+// character ends a field by itself. With a limit, the last field takes the
+// remainder of the line. Escaped bytes never separate.
+func splitRead(line []byte, escaped []bool, limit int) []string {
+  ifs, ok := os.LookupEnv("IFS")
+  if !ok {
+    ifs = " \t\n"
+  }
+  isSep := func(i int) bool {
+    return !escaped[i] && strings.IndexByte(ifs, line[i]) >= 0
+  }
+  isWhite := func(i int) bool {
+    return isSep(i) && (line[i] == ' ' || line[i] == '\t' || line[i] == '\n')
+  }
+
+  fields := []string{}
+  i := 0
+  skipWhite := func() {
+    for i < len(line) && isWhite(i) {
+      i++
+    }
+  }
+
+  skipWhite()
+  for i < len(line) {
+    if limit > 0 && len(fields) == limit-1 {
+      end := len(line)
+      for end > i && isWhite(end-1) {
+        end--
+      }
+      return append(fields, string(line[i:end]))
+    }
+
+    start := i
+    for i < len(line) && !isSep(i) {
+      i++
+    }
+    fields = append(fields, string(line[start:i]))
+    if i == len(line) {
+      break
+    }
+
+    // One separator: IFS whitespace, optionally around a single other IFS
+    // character
+    if isWhite(i) {
+      skipWhite()
+      if i < len(line) && isSep(i) {
+        i++
+        skipWhite()
+      }
+    } else {
+      i++
+      skipWhite()
+    }
+  }
+  return fields
+}
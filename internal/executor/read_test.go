@@ -0,0 +1,109 @@
+package executor
+
+import (
+  "bytes"
+  "os"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+func TestRead(t *testing.T) {
+  tests := []struct {
+    name     string
+    args     []string
+    input    string
+    expected map[string]string
+    status   int
+  }{
+    {"Whole line trimmed", []string{"a"}, "  one two  \nnext\n", map[string]string{"a": "one two"}, 0},
+    {"Split across names", []string{"a", "b", "c"}, "one two three four\n", map[string]string{"a": "one", "b": "two", "c": "three four"}, 0},
+    {"Missing fields are empty", []string{"a", "b"}, "one\n", map[string]string{"a": "one", "b": ""}, 0},
+    {"REPLY is unmodified", []string{}, "  one  \n", map[string]string{"REPLY": "  one  "}, 0},
+    {"Backslash quotes", []string{"a", "b"}, "x\\ y z\n", map[string]string{"a": "x y", "b": "z"}, 0},
+    {"Backslash newline continues", []string{"a"}, "one \\\ntwo\n", map[string]string{"a": "one two"}, 0},
+    {"Raw", []string{"-r", "a", "b"}, "x\\ y z\n", map[string]string{"a": "x\\", "b": "y z"}, 0},
+    {"Delimiter", []string{"-d", ":", "a"}, "one:two\n", map[string]string{"a": "one"}, 0},
+    {"Character count", []string{"-n", "3", "a"}, "abcdef\n", map[string]string{"a": "abc"}, 0},
+    {"Character count attached", []string{"-rn2", "a"}, "héllo\n", map[string]string{"a": "hé"}, 0},
+    {"Count stops at delimiter", []string{"-n", "10", "a"}, "ab\ncd\n", map[string]string{"a": "ab"}, 0},
+    {"End of file", []string{"a"}, "partial", map[string]string{"a": "partial"}, 1},
+    {"Empty input", []string{"a"}, "", map[string]string{"a": ""}, 1},
+    {"Invalid option", []string{"-z"}, "x\n", map[string]string{}, 2},
+    {"Invalid name", []string{"1a"}, "x\n", map[string]string{}, 1},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      for _, name := range []string{"a", "b", "c", "REPLY"} {
+        t.Setenv(name, "unchanged")
+      }
+
+      var errOut bytes.Buffer
+      status := runRead(test.args, strings.NewReader(test.input), &errOut)
+      if status != test.status {
+        t.Errorf("read %q returned %d, expected %d", test.args, status, test.status)
+      }
+      for name, expected := range test.expected {
+        if value := os.Getenv(name); value != expected {
+          t.Errorf("read %q set %s = %q, expected %q", test.args, name, value, expected)
+        }
+      }
+    })
+  }
+}
+
+func TestReadLeavesRestOfInput(t *testing.T) {
+  t.Setenv("a", "")
+  input := strings.NewReader("first\nsecond\n")
+  var errOut bytes.Buffer
+
+  runRead([]string{"a"}, input, &errOut)
+  runRead([]string{"a"}, input, &errOut)
+  if value := os.Getenv("a"); value != "second" {
+    t.Errorf("second read set a = %q, expected %q", value, "second")
+  }
+}
+
+func TestReadArray(t *testing.T) {
+  defer delete(Arrays, "arr")
+
+  var errOut bytes.Buffer
+  status := runRead([]string{"-a", "arr"}, strings.NewReader(" x  y\\ z w\n"), &errOut)
+  if status != 0 {
+    t.Fatalf("read -a returned %d", status)
+  }
+  expected := []string{"x", "y z", "w"}
+  if !reflect.DeepEqual(Arrays["arr"], expected) {
+    t.Errorf("read -a set arr = %q, expected %q", Arrays["arr"], expected)
+  }
+  if result := Expand("${arr[1]}|${#arr[@]}|$arr"); result != "y z|3|x" {
+    t.Errorf("array expansion = %q, expected %q", result, "y z|3|x")
+  }
+}
+
+func TestSplitRead(t *testing.T) {
+  tests := []struct {
+    name     string
+    ifs      string
+    line     string
+    limit    int
+    expected []string
+  }{
+    {"Whitespace", " \t\n", "  a \t b  ", -1, []string{"a", "b"}},
+    {"Colons", ":", "a::b", -1, []string{"a", "", "b"}},
+    {"Colon with whitespace", ": ", "a : b", -1, []string{"a", "b"}},
+    {"Limit keeps the rest", ":", "a:b:c", 2, []string{"a", "b:c"}},
+    {"Empty IFS", "", " a b ", 2, []string{" a b "}},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      t.Setenv("IFS", test.ifs)
+      result := splitRead([]byte(test.line), make([]bool, len(test.line)), test.limit)
+      if !reflect.DeepEqual(result, test.expected) {
+        t.Errorf("splitRead(%q) = %q, expected %q", test.line, result, test.expected)
+      }
+    })
+  }
+}
@@ -0,0 +1,146 @@
+package executor
+
+import (
+  "bufio"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "strings"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// Run lexes, parses and evaluates a single line in the current shell and
+// returns its exit status. Input that doesn't parse sets $? to 2.
+func Run(line string) (int, error) {
+  tokens, err := lexer.NewLexer(line).Lex()
+  if err != nil {
+    LastStatus = 2
+    return 2, err
+  }
+  commands, err := parser.ParseTokens(tokens)
+  if err != nil {
+    LastStatus = 2
+    return 2, err
+  }
+  return Eval(commands), nil
+}
+
+// inScript is set while `harsh script.sh` runs the script, which makes a
+// syntax error in it or in a file it sources fatal
+var inScript bool
+
+// RunScript runs filename as `harsh script.sh` does. As POSIX requires of
+// a non-interactive shell, a syntax error stops it and is returned.
+func RunScript(filename string) (int, error) {
+  inScript = true
+  defer func() { inScript = false }()
+  return SourceFile(filename, os.Stderr, true)
+}
+
+// SourceFile runs the commands in filename in the current shell, the way
+// the startup files, `.` and scripts are expected to behave, and returns the
+// status of the last one. A command goes on over as many lines as it would
+// at the prompt. A syntax error names the file and line: with fatal set it
+// stops the file and is returned, otherwise it's reported on stderr and the
+// next command runs.
+func SourceFile(filename string, stderr io.Writer, fatal bool) (int, error) {
+  file, err := os.Open(filename)
+  if err != nil {
+    return 1, err
+  }
+  defer file.Close()
+
+  status := 0
+  lineNo, start := 0, 0
+  command := ""
+  var state parser.Continuation
+  // fail reports a syntax error in the command starting at line start
+  fail := func(err error) error {
+    line := start
+    var syntaxErr *lexer.SyntaxError
+    if errors.As(err, &syntaxErr) && syntaxErr.Span.Start.Line > 0 {
+      line += syntaxErr.Span.Start.Line - 1
+    }
+    err = fmt.Errorf("%s: line %d: %w", filename, line, err)
+    if fatal {
+      return err
+    }
+    fmt.Fprintf(stderr, "harsh: %s\n", err.Error())
+    return nil
+  }
+
+  scanner := bufio.NewScanner(file)
+  for scanner.Scan() {
+    lineNo++
+    if command == "" {
+      line := strings.TrimSpace(scanner.Text())
+      if line == "" || strings.HasPrefix(line, "#") {
+        continue
+      }
+      command, start = scanner.Text(), lineNo
+    } else {
+      command = parser.JoinContinuation(command, scanner.Text(), state)
+    }
+    if state = parser.ScanContinuation(command); state.Incomplete() {
+      continue
+    }
+    if err := state.Err(); err != nil {
+      command = ""
+      LastStatus = 2
+      status = 2
+      if err := fail(err); err != nil {
+        return status, err
+      }
+      continue
+    }
+
+    code, err := Run(strings.TrimSpace(command))
+    command = ""
+    status = code
+    if err != nil {
+      if err := fail(err); err != nil {
+        return code, err
+      }
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return status, err
+  }
+
+  if command != "" {
+    LastStatus = 2
+    status = 2
+    if err := fail(errors.New("syntax error: unexpected end of file")); err != nil {
+      return status, err
+    }
+  }
+  return status, nil
+}
+
+// findSourceFile resolves the argument of `.`: names containing a slash are
+// used as is, anything else is looked up in PATH first and the current
+// directory second
+func findSourceFile(name string) (string, error) {
+  if strings.Contains(name, "/") {
+    if _, err := os.Stat(name); err != nil {
+      return "", err
+    }
+    return name, nil
+  }
+
+  for _, dir := range PathDirs {
+    path := strings.TrimRight(dir, "/") + "/" + name
+    if info, err := os.Stat(path); err == nil && !info.IsDir() {
+      return path, nil
+    }
+  }
+
+  if info, err := os.Stat(name); err == nil && !info.IsDir() {
+    return name, nil
+  }
+
+  return "", fmt.Errorf("File not found: %s", name)
+}
@@ -0,0 +1,122 @@
+package executor
+
+import (
+  "bytes"
+  "io"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestRunStatus(t *testing.T) {
+  tests := []struct {
+    name     string
+    line     string
+    expected int
+    hasError bool
+  }{
+    {"Successful builtin", "cd /", 0, false},
+    {"Failing builtin", "cd /nonexistent/dir", 1, false},
+    {"Eval of failing builtin", "eval cd /nonexistent/dir", 1, false},
+    {"Unmatched quote", "echo 'oops", 2, true},
+  }
+
+  // cd moves the process and sets PWD and OLDPWD; t.Chdir puts back the
+  // directory and PWD
+  t.Chdir(t.TempDir())
+  t.Setenv("OLDPWD", os.Getenv("OLDPWD"))
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      status, err := Run(test.line)
+      if (err != nil) != test.hasError {
+        t.Fatalf("Error expectation mismatch - got error: %v, expected error: %v", err, test.hasError)
+      }
+      if status != test.expected {
+        t.Errorf("Expected status %d, got %d", test.expected, status)
+      }
+    })
+  }
+}
+
+func TestSourceFile(t *testing.T) {
+  cwd, _ := os.Getwd()
+  defer os.Chdir(cwd)
+
+  dir := t.TempDir()
+  script := filepath.Join(dir, "script.sh")
+  content := "# change directory\n\ncd " + dir + "\ncd /nonexistent/dir\n"
+  if err := os.WriteFile(script, []byte(content), 0600); err != nil {
+    t.Fatal(err)
+  }
+
+  status, err := SourceFile(script, io.Discard, true)
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+  if status != 1 {
+    t.Errorf("Expected status of last command 1, got %d", status)
+  }
+
+  wd, _ := os.Getwd()
+  if resolved, _ := filepath.EvalSymlinks(dir); wd != dir && wd != resolved {
+    t.Errorf("Expected sourced cd to change directory to %s, got %s", dir, wd)
+  }
+}
+
+func TestSourceFileMultiLine(t *testing.T) {
+  dir := t.TempDir()
+  t.Setenv("HARSH_TEST_SRC", "")
+  script := filepath.Join(dir, "script.sh")
+  out := filepath.Join(dir, "out")
+  content := "HARSH_TEST_SRC='one\n\n# not a comment\ntwo'\necho \\\n  hi \\\n  > " + out + "\n"
+  os.WriteFile(script, []byte(content), 0600)
+
+  if status, err := SourceFile(script, io.Discard, true); status != 0 || err != nil {
+    t.Fatalf("SourceFile = %d, %v", status, err)
+  }
+  if value := os.Getenv("HARSH_TEST_SRC"); value != "one\n\n# not a comment\ntwo" {
+    t.Errorf("Quoted assignment over lines set %q", value)
+  }
+  if data, _ := os.ReadFile(out); string(data) != "hi\n" {
+    t.Errorf("Continued command wrote %q", data)
+  }
+}
+
+func TestSourceFileSyntaxError(t *testing.T) {
+  tests := []struct {
+    name     string
+    content  string
+    fatal    bool
+    message  string
+    expected string
+  }{
+    {"Reported and skipped", "ls | | wc\nHARSH_TEST_SRC=after\n", false, "line 1: syntax error near unexpected token '|'", "after"},
+    {"Fatal in a script", "ls | | wc\nHARSH_TEST_SRC=after\n", true, "line 1: syntax error near unexpected token '|'", ""},
+    {"Line within a command", "HARSH_TEST_SRC=before\necho 'a\nb' |\n| wc\n", true, "line 4: syntax error near unexpected token '|'", "before"},
+    {"Unsupported construct", "HARSH_TEST_SRC=before\necho 'a\nb' &&\nHARSH_TEST_SRC=after\n", true, "line 3: syntax error: '&&' is not supported", "before"},
+    {"Unterminated at the end", "HARSH_TEST_SRC=before\n\necho 'open\n", false, "line 3: syntax error: unexpected end of file", "before"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      t.Setenv("HARSH_TEST_SRC", "")
+      script := filepath.Join(t.TempDir(), "script.sh")
+      os.WriteFile(script, []byte(test.content), 0600)
+
+      var stderr bytes.Buffer
+      status, err := SourceFile(script, &stderr, test.fatal)
+      message := stderr.String()
+      if err != nil {
+        message = err.Error()
+      }
+      if (err != nil) != test.fatal || !strings.Contains(message, script+": "+test.message) {
+        t.Errorf("SourceFile = %d, %v, printed %q, expected %q", status, err, stderr.String(), test.message)
+      }
+      if value := os.Getenv("HARSH_TEST_SRC"); value != test.expected {
+        t.Errorf("HARSH_TEST_SRC = %q, expected %q", value, test.expected)
+      }
+    })
+  }
+}
@@ -0,0 +1,79 @@
+package executor
+
+import (
+  "maps"
+  "os"
+  "slices"
+  "strings"
+)
+
+// subshellDepth counts the subshells running, inside which exit ends the
+// subshell rather than the process
+var subshellDepth int
+
+// subshellExit is how exit unwinds out of a subshell with its status
+type subshellExit struct {
+  status int
+}
+
+// inSubshell runs fn the way a forked subshell would: whatever it does to
+// the working directory, variables, arrays, directory stack, positional
+// parameters, descriptors, command hash, history or $? is undone
+// afterwards, and an exit in it only ends fn. Files it opened as the
+// shell's descriptors are closed. It returns the status exit gave, or fn's.
+func inSubshell(fn func() int) (status int) {
+  cwd, cwdErr := os.Getwd()
+  env := os.Environ()
+  arrays := maps.Clone(Arrays)
+  for name, values := range arrays {
+    arrays[name] = slices.Clone(values)
+  }
+  dirStack := slices.Clone(DirStack)
+  positional := slices.Clone(PositionalArgs)
+  pathDirs := slices.Clone(PathDirs)
+  lastStatus := LastStatus
+
+  files, shellFiles := maps.Clone(fdFiles), subshellFiles
+  subshellFiles = maps.Clone(shellFiles)
+  for _, file := range files {
+    subshellFiles[file] = true
+  }
+  hash := make(map[string]*hashedCommand, len(hashTable))
+  for name, entry := range hashTable {
+    copied := *entry
+    hash[name] = &copied
+  }
+  hashDirs := hashedDirs
+  hist, appended, pending, histCommand := slices.Clone(Hist), histAppended, slices.Clone(histPending), HistCommand
+
+  subshellDepth++
+  defer func() {
+    for _, file := range fdFiles {
+      releaseFile(file)
+    }
+    fdFiles, subshellFiles = files, shellFiles
+    hashTable, hashedDirs = hash, hashDirs
+    Hist, histAppended, histPending, HistCommand = hist, appended, pending, histCommand
+
+    subshellDepth--
+    if cwdErr == nil {
+      os.Chdir(cwd)
+    }
+    os.Clearenv()
+    for _, entry := range env {
+      name, value, _ := strings.Cut(entry, "=")
+      os.Setenv(name, value)
+    }
+    Arrays, DirStack, PositionalArgs, PathDirs = arrays, dirStack, positional, pathDirs
+    LastStatus = lastStatus
+
+    if r := recover(); r != nil {
+      exit, ok := r.(subshellExit)
+      if !ok {
+        panic(r)
+      }
+      status = exit.status
+    }
+  }()
+  return fn()
+}
@@ -0,0 +1,100 @@
+//go:build linux
+
+package executor
+
+import (
+  "os"
+  "syscall"
+  "time"
+  "unsafe"
+)
+
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+  termios := &syscall.Termios{}
+  _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(termios)))
+  if errno != 0 {
+    return nil, errno
+  }
+  return termios, nil
+}
+
+func setTermios(fd uintptr, termios *syscall.Termios) error {
+  _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(termios)))
+  if errno != 0 {
+    return errno
+  }
+  return nil
+}
+
+// IsTerminal reports whether file is a terminal
+func IsTerminal(file *os.File) bool {
+  _, err := getTermios(file.Fd())
+  return err == nil
+}
+
+// validFd reports whether fd is open in the shell process and was
+// inherited from its parent. Go opens its own descriptors close-on-exec,
+// and those must not be touched.
+func validFd(fd int) bool {
+  flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+  return errno == 0 && flags&syscall.FD_CLOEXEC == 0
+}
+
+// changeTermios applies change to the terminal's settings and returns a
+// function that puts back the ones it had
+func changeTermios(file *os.File, change func(*syscall.Termios)) (func(), error) {
+  fd := file.Fd()
+  termios, err := getTermios(fd)
+  if err != nil {
+    return nil, err
+  }
+  saved := *termios
+  change(termios)
+  if err := setTermios(fd, termios); err != nil {
+    return nil, err
+  }
+  return func() { setTermios(fd, &saved) }, nil
+}
+
+// disableEcho stops the terminal from echoing what's typed and returns a
+// function that puts it back
+func disableEcho(file *os.File) (func(), error) {
+  return changeTermios(file, func(termios *syscall.Termios) {
+    termios.Lflag &^= syscall.ECHO
+  })
+}
+
+// disableCanonical has the terminal pass on every character as it's typed
+// rather than whole lines once Enter is pressed, and returns a function
+// that puts it back
+func disableCanonical(file *os.File) (func(), error) {
+  return changeTermios(file, func(termios *syscall.Termios) {
+    termios.Lflag &^= syscall.ICANON
+    termios.Cc[syscall.VMIN] = 1
+    termios.Cc[syscall.VTIME] = 0
+  })
+}
+
+// pollIn is POLLIN, which syscall doesn't define
+const pollIn = 0x1
+
+// waitReadable waits up to timeout for file to have input, reporting false
+// if it didn't. It uses ppoll, which unlike select takes any descriptor.
+func waitReadable(file *os.File, timeout time.Duration) (bool, error) {
+  fds := [1]struct {
+    fd int32
+    events, revents int16
+  }{{fd: int32(file.Fd()), events: pollIn}}
+  deadline := time.Now().Add(max(timeout, 0))
+  for {
+    ts := syscall.NsecToTimespec(max(time.Until(deadline), 0).Nanoseconds())
+    n, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&fds[0])), 1, uintptr(unsafe.Pointer(&ts)), 0, 0, 0)
+    if errno == syscall.EINTR {
+      continue
+    }
+    if errno != 0 {
+      return false, errno
+    }
+    return n > 0, nil
+  }
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package executor
+
+import (
+  "os"
+  "syscall"
+  "testing"
+  "time"
+)
+
+func TestWaitReadable(t *testing.T) {
+  r, w, err := os.Pipe()
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer r.Close()
+  defer w.Close()
+
+  // select could only wait on descriptors below 1024
+  high := r
+  if err := syscall.Dup3(int(r.Fd()), 1500, 0); err == nil {
+    high = os.NewFile(1500, "high")
+    defer high.Close()
+  }
+
+  for _, file := range []*os.File{r, high} {
+    if ready, err := waitReadable(file, 10*time.Millisecond); ready || err != nil {
+      t.Errorf("waitReadable(fd %d) on an empty pipe = %v, %v", file.Fd(), ready, err)
+    }
+  }
+  w.WriteString("x")
+  for _, file := range []*os.File{r, high} {
+    if ready, err := waitReadable(file, time.Second); !ready || err != nil {
+      t.Errorf("waitReadable(fd %d) with input = %v, %v", file.Fd(), ready, err)
+    }
+  }
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+package executor
+
+import (
+  "errors"
+  "os"
+  "time"
+)
+
+// IsTerminal reports whether file is a terminal
+func IsTerminal(file *os.File) bool {
+  info, err := file.Stat()
+  return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// validFd can't check here, a bad descriptor shows up on first use instead
+func validFd(fd int) bool {
+  return fd >= 0
+}
+
+func disableEcho(file *os.File) (func(), error) {
+  return nil, errors.New("silent mode is not supported on this platform")
+}
+
+func disableCanonical(file *os.File) (func(), error) {
+  return nil, errors.New("character input is not supported on this platform")
+}
+
+// waitReadable can't tell here, so input always looks ready and timeouts
+// don't apply
+func waitReadable(file *os.File, timeout time.Duration) (bool, error) {
+  return true, nil
+}
@@ -0,0 +1,246 @@
+package executor
+
+import (
+  "fmt"
+  "io"
+  "strings"
+
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// keywords are the shell's reserved words. Only [[ ]] runs so far, the rest
+// are known to the parser through line continuation.
+var keywords = map[string]bool{
+  "!": true, "[[": true, "]]": true, "{": true, "}": true, "case": true,
+  "do": true, "done": true, "elif": true, "else": true, "esac": true,
+  "fi": true, "for": true, "function": true, "if": true, "in": true,
+  "select": true, "then": true, "time": true, "until": true, "while": true,
+}
+
+// defaultPath is searched by command -p, a PATH that finds the standard
+// utilities whatever the user's PATH is
+var defaultPath = []string{"/usr/local/sbin", "/usr/local/bin", "/usr/sbin", "/usr/bin", "/sbin", "/bin"}
+
+// resolution is one thing a command name can refer to
+type resolution struct {
+  // kind is "keyword", "builtin" or "file", as type -t prints it
+  kind string
+  path string
+  // hashed is set for a file found in the hash table
+  hashed bool
+}
+
+// resolveCommand lists what name refers to, in the order the shell looks
+// it up. Unless all is set, only the first one, which is what would run.
+// physical skips everything but files on PATH.
+func resolveCommand(name string, all, physical bool) []resolution {
+  found := make([]resolution, 0)
+  if !physical {
+    if keywords[name] {
+      found = append(found, resolution{kind: "keyword"})
+    }
+    if lookupBuiltin(name) != unknownBuiltin {
+      found = append(found, resolution{kind: "builtin"})
+    }
+  }
+
+  if strings.Contains(name, "/") {
+    if path, err := findExecutable(name); err == nil {
+      found = append(found, resolution{kind: "file", path: path})
+    }
+  } else if path, ok := hashLookup(name); ok && !all {
+    found = append(found, resolution{kind: "file", path: path, hashed: true})
+  } else {
+    for _, path := range searchPath(name, PathDirs) {
+      found = append(found, resolution{kind: "file", path: path})
+    }
+  }
+
+  if !all && len(found) > 1 {
+    found = found[:1]
+  }
+  return found
+}
+
+// describe is how type and command -V explain a resolution
+func describe(name string, r resolution) string {
+  switch r.kind {
+  case "keyword":
+    return fmt.Sprintf("%s is a shell keyword", name)
+  case "builtin":
+    return fmt.Sprintf("%s is a shell builtin", name)
+  }
+  if r.hashed {
+    return fmt.Sprintf("%s is hashed (%s)", name, r.path)
+  }
+  return fmt.Sprintf("%s is %s", name, r.path)
+}
+
+// runType implements type. -t prints just the kind of each name, -p the file
+// that would run (nothing for keywords and builtins), -P searches PATH even
+// for builtins and -a shows every match rather than the first.
+func runType(args []string, stdout, stderr io.Writer) int {
+  all, kindOnly, pathOnly, physical := false, false, false, false
+  for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+    if args[0] == "--" {
+      args = args[1:]
+      break
+    }
+    for _, flag := range args[0][1:] {
+      switch flag {
+      case 'a':
+        all = true
+      case 't':
+        kindOnly = true
+      case 'p':
+        pathOnly = true
+      case 'P':
+        physical = true
+      case 'f':
+        // There are no functions to skip
+      default:
+        fmt.Fprintf(stderr, "type: -%c: invalid option\ntype: usage: type [-afptP] name [name ...]\n", flag)
+        return 2
+      }
+    }
+    args = args[1:]
+  }
+  if len(args) == 0 {
+    fmt.Fprintln(stderr, "Missing argument for type command")
+    return 1
+  }
+
+  status := 0
+  for _, name := range args {
+    found := resolveCommand(name, all, physical)
+    if len(found) == 0 {
+      if !kindOnly && !pathOnly && !physical {
+        fmt.Fprintf(stderr, "type: %s: not found\n", name)
+      }
+      status = 1
+      continue
+    }
+
+    for _, r := range found {
+      switch {
+      case kindOnly:
+        fmt.Fprintln(stdout, r.kind)
+      case pathOnly || physical:
+        if r.kind == "file" {
+          fmt.Fprintln(stdout, r.path)
+        }
+      default:
+        fmt.Fprintln(stdout, describe(name, r))
+      }
+    }
+  }
+  return status
+}
+
+// runCommand implements command -v and -V, which say how each name would be
+// interpreted, tersely or like type. Running a command through it is handled
+// by unwrapCommand before it gets here.
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+  verbose, terse := false, false
+  for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+    if args[0] == "--" {
+      args = args[1:]
+      break
+    }
+    for _, flag := range args[0][1:] {
+      switch flag {
+      case 'p':
+        // Only matters when running the command
+      case 'v':
+        terse = true
+      case 'V':
+        verbose = true
+      default:
+        fmt.Fprintf(stderr, "command: -%c: invalid option\ncommand: usage: command [-pVv] command [arg ...]\n", flag)
+        return 2
+      }
+    }
+    args = args[1:]
+  }
+  if len(args) == 0 {
+    return 0
+  }
+
+  if !terse && !verbose {
+    // Reached through builtin, e.g. builtin command ls
+    unwrapped := &parser.Command{Name: "command", Args: args}
+    unwrapCommand(unwrapped)
+    if lookupBuiltin(unwrapped.Name) != unknownBuiltin {
+      return runBuiltin(unwrapped, stdin, stdout, stderr)
+    }
+    path, err := findExecutable(unwrapped.Name)
+    if err != nil {
+      return cannotRun(stderr, unwrapped.Name, err)
+    }
+    hashHit(unwrapped.Name)
+    runnable := WrapExternal(unwrapped, path)
+    runnable.Start(stdin, stdout, stderr)
+    return runnable.Wait()
+  }
+
+  status := 0
+  for _, name := range args {
+    found := resolveCommand(name, false, false)
+    if len(found) == 0 {
+      if verbose {
+        fmt.Fprintf(stderr, "command: %s: not found\n", name)
+      }
+      status = 1
+      continue
+    }
+
+    r := found[0]
+    switch {
+    case verbose:
+      fmt.Fprintln(stdout, describe(name, r))
+    case r.kind == "file":
+      fmt.Fprintln(stdout, r.path)
+    default:
+      fmt.Fprintln(stdout, name)
+    }
+  }
+  return status
+}
+
+// runBuiltinBuiltin implements builtin, which runs the named builtin even if
+// something else by that name would otherwise take precedence
+func runBuiltinBuiltin(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+  if len(args) == 0 {
+    return 0
+  }
+  if lookupBuiltin(args[0]) == unknownBuiltin {
+    fmt.Fprintf(stderr, "builtin: %s: not a shell builtin\n", args[0])
+    return 1
+  }
+  return runBuiltin(&parser.Command{Name: args[0], Args: args[1:]}, stdin, stdout, stderr)
+}
+
+// unwrapCommand turns `command name args...` into `name args...` so the
+// name runs as a builtin or file, bypassing anything else it might refer
+// to. With -p the file is looked for in a default PATH. -v and -V are left
+// for the builtin.
+func unwrapCommand(command *parser.Command) {
+  for command.Name == "command" {
+    args := command.Args
+    defaultSearch := false
+    for len(args) > 0 && (args[0] == "-p" || args[0] == "--") {
+      defaultSearch = defaultSearch || args[0] == "-p"
+      args = args[1:]
+    }
+    if len(args) == 0 || (len(args[0]) > 1 && args[0][0] == '-') {
+      return
+    }
+
+    command.Name, command.Args = args[0], args[1:]
+    if defaultSearch && lookupBuiltin(command.Name) == unknownBuiltin && !strings.Contains(command.Name, "/") {
+      if paths := searchPath(command.Name, defaultPath); len(paths) > 0 {
+        command.Name = paths[0]
+      }
+    }
+  }
+}
@@ -0,0 +1,136 @@
+package executor
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/cheesyhypocrisy/harsh/internal/parser"
+)
+
+// typeFixture points PathDirs at two temp dirs both holding a "tool" and an
+// "echo" executable, returning the dirs
+func typeFixture(t *testing.T) (string, string) {
+  first, second := t.TempDir(), t.TempDir()
+  for _, dir := range []string{first, second} {
+    for _, name := range []string{"tool", "echo"} {
+      os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755)
+    }
+  }
+  saved := PathDirs
+  PathDirs = []string{first, second}
+  t.Cleanup(func() { PathDirs = saved })
+  return first, second
+}
+
+func TestType(t *testing.T) {
+  first, second := typeFixture(t)
+
+  tests := []struct {
+    name     string
+    args     []string
+    expected string
+    errOut   string
+    status   int
+  }{
+    {"Builtin", []string{"echo"}, "echo is a shell builtin\n", "", 0},
+    {"File", []string{"tool"}, "tool is " + first + "/tool\n", "", 0},
+    {"Keyword", []string{"[["}, "[[ is a shell keyword\n", "", 0},
+    {"Several names", []string{"pwd", "if"}, "pwd is a shell builtin\nif is a shell keyword\n", "", 0},
+    {"Not found", []string{"nope", "tool"}, "tool is " + first + "/tool\n", "type: nope: not found\n", 1},
+    {"Path with slash", []string{first + "/tool"}, first + "/tool is " + first + "/tool\n", "", 0},
+    {"All", []string{"-a", "echo"}, "echo is a shell builtin\necho is " + first + "/echo\necho is " + second + "/echo\n", "", 0},
+    {"Kind", []string{"-t", "echo", "tool", "while", "nope"}, "builtin\nfile\nkeyword\n", "", 1},
+    {"Path", []string{"-p", "tool", "echo"}, first + "/tool\n", "", 0},
+    {"All paths", []string{"-ap", "echo"}, first + "/echo\n" + second + "/echo\n", "", 0},
+    {"Force path", []string{"-P", "echo"}, first + "/echo\n", "", 0},
+    {"Force path not found", []string{"-P", "cd"}, "", "", 1},
+    {"Invalid option", []string{"-x", "echo"}, "", "type: -x: invalid option\ntype: usage: type [-afptP] name [name ...]\n", 2},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var out, errOut bytes.Buffer
+      status := runType(test.args, &out, &errOut)
+      if out.String() != test.expected || errOut.String() != test.errOut || status != test.status {
+        t.Errorf("type %q = %q, %q (%d), expected %q, %q (%d)", test.args, out.String(), errOut.String(), status, test.expected, test.errOut, test.status)
+      }
+    })
+  }
+}
+
+func TestCommandBuiltin(t *testing.T) {
+  first, _ := typeFixture(t)
+
+  tests := []struct {
+    name     string
+    args     []string
+    expected string
+    errOut   string
+    status   int
+  }{
+    {"Terse builtin", []string{"-v", "echo"}, "echo\n", "", 0},
+    {"Terse file", []string{"-v", "tool"}, first + "/tool\n", "", 0},
+    {"Terse keyword", []string{"-v", "if"}, "if\n", "", 0},
+    {"Terse not found", []string{"-v", "nope"}, "", "", 1},
+    {"Verbose", []string{"-V", "echo", "tool"}, "echo is a shell builtin\ntool is " + first + "/tool\n", "", 0},
+    {"Verbose not found", []string{"-V", "nope"}, "", "command: nope: not found\n", 1},
+    {"Runs builtin", []string{"echo", "hi"}, "hi\n", "", 0},
+    {"No arguments", []string{}, "", "", 0},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      var out, errOut bytes.Buffer
+      status := runCommand(test.args, strings.NewReader(""), &out, &errOut)
+      if out.String() != test.expected || errOut.String() != test.errOut || status != test.status {
+        t.Errorf("command %q = %q, %q (%d), expected %q, %q (%d)", test.args, out.String(), errOut.String(), status, test.expected, test.errOut, test.status)
+      }
+    })
+  }
+}
+
+func TestBuiltinBuiltin(t *testing.T) {
+  var out, errOut bytes.Buffer
+  if status := runBuiltinBuiltin([]string{"echo", "forced"}, strings.NewReader(""), &out, &errOut); status != 0 || out.String() != "forced\n" {
+    t.Errorf("builtin echo = %q (%d), expected %q (0)", out.String(), status, "forced\n")
+  }
+
+  out.Reset()
+  if status := runBuiltinBuiltin([]string{"ls"}, strings.NewReader(""), &out, &errOut); status != 1 || errOut.String() != "builtin: ls: not a shell builtin\n" {
+    t.Errorf("builtin ls = %q (%d), expected an error", errOut.String(), status)
+  }
+}
+
+func TestUnwrapCommand(t *testing.T) {
+  tests := []struct {
+    name     string
+    args     []string
+    expected string
+    rest     []string
+  }{
+    {"Plain", []string{"ls", "-l"}, "ls", []string{"-l"}},
+    {"Nested", []string{"command", "ls"}, "ls", []string{}},
+    {"Query left alone", []string{"-v", "ls"}, "command", []string{"-v", "ls"}},
+    {"Default path", []string{"-p", "sh"}, "/", []string{}},
+    {"Default path keeps builtins", []string{"-p", "echo", "x"}, "echo", []string{"x"}},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      command := &parser.Command{Name: "command", Args: test.args}
+      unwrapCommand(command)
+      if test.expected == "/" {
+        if !strings.HasPrefix(command.Name, "/") || filepath.Base(command.Name) != "sh" {
+          t.Errorf("command -p sh unwrapped to %q, expected a full path", command.Name)
+        }
+        return
+      }
+      if command.Name != test.expected || strings.Join(command.Args, " ") != strings.Join(test.rest, " ") {
+        t.Errorf("Unwrapped to %q %q, expected %q %q", command.Name, command.Args, test.expected, test.rest)
+      }
+    })
+  }
+}
@@ -1,6 +1,10 @@
 package lexer
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 type TokenType int
 
@@ -10,135 +14,252 @@ const (
 	Redirect
 	Append
 	Pipe
+	// Duplicate is >& or <&, making a descriptor a copy of another
+	Duplicate
 )
 
+// Position is a location in the input. Line and Col count from 1, Col in
+// bytes like Offset.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Col    int `json:"column"`
+}
+
+// Span covers the input from Start up to, but not including, End
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
 type Token struct {
 	Typ     TokenType
 	Literal string
+	// Parts is how a LiteralStr word is made up, quoting included
+	Parts []WordPart
+	Span  Span
+}
+
+// SyntaxError is returned by the lexer and parser for malformed input, Span
+// being where the offending token is so callers can point at it
+type SyntaxError struct {
+	Msg  string
+	Span Span
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Msg
+}
+
+// Caret renders the line of input containing the error with a '^' under
+// the offending column, ready to print below the message
+func (e *SyntaxError) Caret(input string) string {
+	pos := min(max(e.Span.Start.Offset, 0), len(input))
+	start := strings.LastIndexByte(input[:pos], '\n') + 1
+	end := strings.IndexByte(input[pos:], '\n')
+	if end < 0 {
+		end = len(input)
+	} else {
+		end += pos
+	}
+
+	// Keep tabs so the caret lines up with what the terminal shows
+	pad := []rune{}
+	for _, r := range input[start:pos] {
+		if r == '\t' {
+			pad = append(pad, '\t')
+		} else {
+			pad = append(pad, ' ')
+		}
+	}
+	return input[start:end] + "\n" + string(pad) + "^"
+}
+
+// UnexpectedToken builds the error reported when tok can't appear where it was
+// found
+func UnexpectedToken(tok Token) *SyntaxError {
+	return &SyntaxError{
+		Msg:  fmt.Sprintf("syntax error near unexpected token '%s'", tok.Text()),
+		Span: tok.Span,
+	}
+}
+
+// Text is how the token is spelled in the input, for use in messages
+func (t Token) Text() string {
+	switch t.Typ {
+	case Redirect:
+		switch t.Literal {
+		case "stderr":
+			return "2>"
+		case "stdin":
+			return "<"
+		case "stdout":
+			return ">"
+		}
+	case Append:
+		switch t.Literal {
+		case "stderr":
+			return "2>>"
+		case "stdout":
+			return ">>"
+		}
+	case Pipe:
+		return "|"
+	case Space:
+		return " "
+	}
+	return t.Literal
 }
 
 type Lexer struct {
 	input    string
 	position int
+	// lineStarts holds the offset of the first byte of every line
+	lineStarts []int
+	// cond is set between the [[ and ]] of a conditional command, where an
+	// unquoted parenthesis is a token of its own rather than part of a word
+	cond bool
 }
 
 func NewLexer(input string) *Lexer {
+	lineStarts := []int{0}
+	for i := 0; i < len(input); i++ {
+		if input[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
 	return &Lexer{
-		input:    input,
-		position: 0,
+		input:      input,
+		position:   0,
+		lineStarts: lineStarts,
 	}
 }
 
+// PositionAt converts a byte offset in the input to a Position
+func (l *Lexer) PositionAt(offset int) Position {
+	line := sort.Search(len(l.lineStarts), func(i int) bool { return l.lineStarts[i] > offset }) - 1
+	return Position{Offset: offset, Line: line + 1, Col: offset - l.lineStarts[line] + 1}
+}
+
+func (l *Lexer) span(start, end int) Span {
+	return Span{Start: l.PositionAt(start), End: l.PositionAt(end)}
+}
+
 func (l *Lexer) Lex() ([]Token, error) {
 	tokens := []Token{}
 	for l.position < len(l.input) {
-		switch l.input[l.position] {
-		case '\'':
-			l.position++
-			start := l.position
-			end := l.position
-			for end < len(l.input) && l.input[end] != '\'' {
-				end++
-			}
-			if end == len(l.input) {
-				return []Token{}, fmt.Errorf("Unmatched ', expected ' at the end of the input")
-			}
-			tokens = append(tokens, Token{Typ: LiteralStr, Literal: l.input[start:end]})
-			l.position = end + 1
-		case '"':
-			l.position++
-			end := l.position
-			curr := ""
-			for end < len(l.input) && l.input[end] != '"' {
-				if l.input[end] == '\\' {
-					if end+1 < len(l.input) {
-						next := l.input[end+1]
-						if next == '$' || next == '\\' || next == '"' || next == '\n' {
-							curr += string(next)
-							end = end + 2
-							continue
-						}
-					}
-				}
-				curr += string(l.input[end])
-				end++
-			}
-			if end == len(l.input) {
-				return []Token{}, fmt.Errorf("Unmatched \", expected \" at the end of the input")
-			}
-			tokens = append(tokens, Token{Typ: LiteralStr, Literal: curr})
-			l.position = end + 1
-		case ' ':
-			tokens = append(tokens, Token{Typ: Space, Literal: string(l.input[l.position])})
-			for l.position < len(l.input) && l.input[l.position] == ' ' {
-				l.position++
-			}
-		case '\\':
-			if l.position+1 < len(l.input) {
-				tokens = append(tokens, Token{Typ: LiteralStr, Literal: string(l.input[l.position+1])})
-				l.position++
-			}
-			l.position++
-		case '1':
-			curr := l.position + 1
-			if curr < len(l.input) && l.input[curr] == ' ' {
-				curr++
-			}
-			if curr+1 < len(l.input) && l.input[curr:curr+2] == ">>" {
-				tokens = append(tokens, Token{Typ: Append, Literal: "stdout"})
-				l.position = curr + 2
-			} else if curr < len(l.input) && l.input[curr] == '>' {
-				tokens = append(tokens, Token{Typ: Redirect, Literal: "stdout"})
-				l.position = curr + 1
-			} else {
-				tokens = append(tokens, Token{Typ: LiteralStr, Literal: string('1')})
-				l.position++
-			}
-		case '2':
-			curr := l.position + 1
-			if curr < len(l.input) && l.input[curr] == ' ' {
-				curr++
-			}
-			if curr+1 < len(l.input) && l.input[curr:curr+2] == ">>" {
-				tokens = append(tokens, Token{Typ: Append, Literal: "stderr"})
-				l.position = curr + 2
-			} else if curr < len(l.input) && l.input[curr] == '>' {
-				tokens = append(tokens, Token{Typ: Redirect, Literal: "stderr"})
-				l.position = curr + 1
-			} else {
-				tokens = append(tokens, Token{Typ: LiteralStr, Literal: string('2')})
-				l.position++
-			}
-		case '>':
-			if l.position+1 < len(l.input) && l.input[l.position+1] == '>' {
-				tokens = append(tokens, Token{Typ: Append, Literal: "stdout"})
-				l.position += 2
-			} else {
-				tokens = append(tokens, Token{Typ: Redirect, Literal: "stdout"})
+		pos := l.position
+		n := len(tokens)
+		c := l.input[l.position]
+		switch {
+		case isBlank(c):
+			// Newlines only reach the lexer from multi-line commands and separate
+			// words like any other blank
+			tokens = append(tokens, Token{Typ: Space, Literal: " "})
+			for l.position < len(l.input) && isBlank(l.input[l.position]) {
 				l.position++
 			}
-		case '|':
+		case c >= '0' && c <= '9' && l.fdPrefixEnd() >= 0:
+			end := l.fdPrefixEnd()
+			fd := l.input[l.position:end]
+			l.position = end
+			tokens = append(tokens, l.lexRedirect(fd))
+		case c == '>' || c == '<':
+			tokens = append(tokens, l.lexRedirect(""))
+		case c == '|':
 			tokens = append(tokens, Token{Typ: Pipe, Literal: "pipe"})
 			l.position++
+		case l.cond && (c == '(' || c == ')'):
+			paren := string(c)
+			tokens = append(tokens, Token{Typ: LiteralStr, Literal: paren, Parts: []WordPart{{Kind: LiteralPart, Text: paren}}})
+			l.position++
 		default:
-			curr := ""
-			end := l.position
-			for end < len(l.input) && (l.input[end] != ' ' && l.input[end] != '\'' && l.input[end] != '"') {
-				if l.input[end] == '\\' {
-					if end+1 < len(l.input) {
-						next := l.input[end+1]
-						curr += string(next)
-						end = end + 2
-						continue
-					}
-				}
-				curr += string(l.input[end])
-				end++
+			parts, err := l.lexWord()
+			if err != nil {
+				return []Token{}, err
 			}
-			tokens = append(tokens, Token{Typ: LiteralStr, Literal: string(curr)})
-			l.position = end
+			switch {
+			case isUnquoted(parts, "[["):
+				l.cond = l.cond || startsCommand(tokens)
+			case isUnquoted(parts, "]]"):
+				l.cond = false
+			}
+			tokens = append(tokens, Token{Typ: LiteralStr, Literal: WordText(parts), Parts: parts})
+		}
+
+		for i := n; i < len(tokens); i++ {
+			tokens[i].Span = l.span(pos, l.position)
 		}
 	}
 
 	return tokens, nil
 }
+
+// startsCommand reports whether a word following tokens is in command
+// position, first in the line or after a pipe
+func startsCommand(tokens []Token) bool {
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if tokens[i].Typ != Space {
+			return tokens[i].Typ == Pipe
+		}
+	}
+	return true
+}
+
+// isUnquoted reports whether a word is exactly text with no quoting
+func isUnquoted(parts []WordPart, text string) bool {
+	return len(parts) == 1 && parts[0].Kind == LiteralPart && parts[0].Text == text
+}
+
+// fdPrefixEnd returns where the digits at the current position end if a
+// redirection operator follows them, making them a descriptor number, and
+// -1 otherwise
+func (l *Lexer) fdPrefixEnd() int {
+	end := l.position
+	for end < len(l.input) && l.input[end] >= '0' && l.input[end] <= '9' {
+		end++
+	}
+	if end < len(l.input) && (l.input[end] == '>' || l.input[end] == '<') {
+		return end
+	}
+	return -1
+}
+
+// lexRedirect reads <, >, >>, >& or <& at the current position, fd being
+// the descriptor number written before it, if any
+func (l *Lexer) lexRedirect(fd string) Token {
+	op := l.input[l.position : l.position+1]
+	l.position++
+	next := byte(0)
+	if l.position < len(l.input) {
+		next = l.input[l.position]
+	}
+
+	switch {
+	case next == '&':
+		l.position++
+		return Token{Typ: Duplicate, Literal: fd + op + "&"}
+	case op == ">" && next == '>':
+		l.position++
+		return Token{Typ: Append, Literal: redirectStream(fd, op, ">>")}
+	}
+	return Token{Typ: Redirect, Literal: redirectStream(fd, op, op)}
+}
+
+// redirectStream names what a redirection is for: stdin, stdout or stderr
+// for the usual forms, otherwise the operator as written, e.g. 3> or 2<
+func redirectStream(fd, op, spelling string) string {
+	switch {
+	case op == "<" && (fd == "" || fd == "0"):
+		return "stdin"
+	case op == ">" && (fd == "" || fd == "1"):
+		return "stdout"
+	case op == ">" && fd == "2":
+		return "stderr"
+	}
+	return fd + spelling
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
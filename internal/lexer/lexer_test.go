@@ -31,8 +31,7 @@ func TestLexer(t *testing.T) {
         {Typ: Space, Literal: " "},
         {Typ: LiteralStr, Literal: "quoted"},
         {Typ: Space, Literal: " "},
-        {Typ: LiteralStr, Literal: "test-"},
-        {Typ: LiteralStr, Literal: "concat"},
+        {Typ: LiteralStr, Literal: "test-concat"},
       },
       hasError: false,
     },
@@ -50,6 +49,80 @@ func TestLexer(t *testing.T) {
       },
       hasError: false,
     },
+    {
+      name: "Command with input redirection",
+      input: "read line <input.txt",
+      expected: []Token{
+        {Typ: LiteralStr, Literal: "read"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "line"},
+        {Typ: Space, Literal: " "},
+        {Typ: Redirect, Literal: "stdin"},
+        {Typ: LiteralStr, Literal: "input.txt"},
+      },
+      hasError: false,
+    },
+    {
+      name: "Input redirection ends a word",
+      input: "x<in",
+      expected: []Token{
+        {Typ: LiteralStr, Literal: "x"},
+        {Typ: Redirect, Literal: "stdin"},
+        {Typ: LiteralStr, Literal: "in"},
+      },
+      hasError: false,
+    },
+    {
+      name: "Numbered descriptors",
+      input: "exec 3>log 4<in 2>>err",
+      expected: []Token{
+        {Typ: LiteralStr, Literal: "exec"},
+        {Typ: Space, Literal: " "},
+        {Typ: Redirect, Literal: "3>"},
+        {Typ: LiteralStr, Literal: "log"},
+        {Typ: Space, Literal: " "},
+        {Typ: Redirect, Literal: "4<"},
+        {Typ: LiteralStr, Literal: "in"},
+        {Typ: Space, Literal: " "},
+        {Typ: Append, Literal: "stderr"},
+        {Typ: LiteralStr, Literal: "err"},
+      },
+      hasError: false,
+    },
+    {
+      name: "Duplication",
+      input: "cmd 2>&1 >&3 <&0 3>&-",
+      expected: []Token{
+        {Typ: LiteralStr, Literal: "cmd"},
+        {Typ: Space, Literal: " "},
+        {Typ: Duplicate, Literal: "2>&"},
+        {Typ: LiteralStr, Literal: "1"},
+        {Typ: Space, Literal: " "},
+        {Typ: Duplicate, Literal: ">&"},
+        {Typ: LiteralStr, Literal: "3"},
+        {Typ: Space, Literal: " "},
+        {Typ: Duplicate, Literal: "<&"},
+        {Typ: LiteralStr, Literal: "0"},
+        {Typ: Space, Literal: " "},
+        {Typ: Duplicate, Literal: "3>&"},
+        {Typ: LiteralStr, Literal: "-"},
+      },
+      hasError: false,
+    },
+    {
+      name: "Digits in a word aren't a descriptor",
+      input: "echo a2>x 12",
+      expected: []Token{
+        {Typ: LiteralStr, Literal: "echo"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "a2"},
+        {Typ: Redirect, Literal: "stdout"},
+        {Typ: LiteralStr, Literal: "x"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "12"},
+      },
+      hasError: false,
+    },
     {
       name:     "Unmatched quote",
       input:    "echo 'hello",
@@ -82,9 +155,45 @@ func TestLexer(t *testing.T) {
         {Typ: Space, Literal: " "},
         {Typ: LiteralStr, Literal: "test's"},
         {Typ: Space, Literal: " "},
-        {Typ: LiteralStr, Literal: "shell"},
-        {Typ: LiteralStr, Literal: ""},
-        {Typ: LiteralStr, Literal: "world"},
+        {Typ: LiteralStr, Literal: "shellworld"},
+      },
+      hasError: false,
+    },
+    {
+      name:  "Multi-line command",
+      input: "cat file |\n\tgrep 'a\nb'",
+      expected: []Token{
+        {Typ: LiteralStr, Literal: "cat"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "file"},
+        {Typ: Space, Literal: " "},
+        {Typ: Pipe, Literal: "pipe"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "grep"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "a\nb"},
+      },
+      hasError: false,
+    },
+    {
+      name:  "Parentheses inside [[",
+      input: "echo (a) | [[ (a) ]] (b)",
+      expected: []Token{
+        {Typ: LiteralStr, Literal: "echo"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "(a)"},
+        {Typ: Space, Literal: " "},
+        {Typ: Pipe, Literal: "pipe"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "[["},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "("},
+        {Typ: LiteralStr, Literal: "a"},
+        {Typ: LiteralStr, Literal: ")"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "]]"},
+        {Typ: Space, Literal: " "},
+        {Typ: LiteralStr, Literal: "(b)"},
       },
       hasError: false,
     },
@@ -117,3 +226,160 @@ func TestLexer(t *testing.T) {
   }
 }
 
+
+func TestSyntaxErrorCaret(t *testing.T) {
+  tests := []struct {
+    name     string
+    input    string
+    pos      int
+    expected string
+  }{
+    {"Single line", "ls | | wc", 5, "ls | | wc\n     ^"},
+    {"Second line", "ls |\n| wc", 5, "| wc\n^"},
+    {"Tab indentation", "\tls >", 4, "\tls >\n\t   ^"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      err := &SyntaxError{Msg: "syntax error", Span: Span{Start: Position{Offset: test.pos}}}
+      if result := err.Caret(test.input); result != test.expected {
+        t.Errorf("Expected %q, got %q", test.expected, result)
+      }
+    })
+  }
+}
+
+func TestUnmatchedQuotePosition(t *testing.T) {
+  _, err := NewLexer("echo a 'b").Lex()
+  syntaxErr, ok := err.(*SyntaxError)
+  if !ok {
+    t.Fatalf("Expected *SyntaxError, got %T", err)
+  }
+  if syntaxErr.Span.Start.Offset != 7 {
+    t.Errorf("Expected error at the opening quote (7), got %d", syntaxErr.Span.Start.Offset)
+  }
+}
+
+func TestTokenSpans(t *testing.T) {
+  tokens, err := NewLexer("echo 'a b'\n| wc 2>> err").Lex()
+  if err != nil {
+    t.Fatalf("Unexpected error: %v", err)
+  }
+
+  expected := []Span{
+    {Start: Position{0, 1, 1}, End: Position{4, 1, 5}},
+    {Start: Position{4, 1, 5}, End: Position{5, 1, 6}},
+    {Start: Position{5, 1, 6}, End: Position{10, 1, 11}},
+    {Start: Position{10, 1, 11}, End: Position{11, 2, 1}},
+    {Start: Position{11, 2, 1}, End: Position{12, 2, 2}},
+    {Start: Position{12, 2, 2}, End: Position{13, 2, 3}},
+    {Start: Position{13, 2, 3}, End: Position{15, 2, 5}},
+    {Start: Position{15, 2, 5}, End: Position{16, 2, 6}},
+    {Start: Position{16, 2, 6}, End: Position{19, 2, 9}},
+    {Start: Position{19, 2, 9}, End: Position{20, 2, 10}},
+    {Start: Position{20, 2, 10}, End: Position{23, 2, 13}},
+  }
+
+  if len(tokens) != len(expected) {
+    t.Fatalf("Expected %d tokens, got %d: %+v", len(expected), len(tokens), tokens)
+  }
+  for i, token := range tokens {
+    if token.Span != expected[i] {
+      t.Errorf("Token %d (%q) - Expected span %+v, got %+v", i, token.Literal, expected[i], token.Span)
+    }
+  }
+}
+
+func TestWordParts(t *testing.T) {
+  tests := []struct {
+    name     string
+    input    string
+    expected []WordPart
+    hasError bool
+  }{
+    {
+      name:  "Adjacent quoting styles",
+      input: "'foo'bar\"baz\"",
+      expected: []WordPart{
+        {Kind: SingleQuotedPart, Text: "foo"},
+        {Kind: LiteralPart, Text: "bar"},
+        {Kind: DoubleQuotedPart, Text: "baz"},
+      },
+    },
+    {
+      name:  "Expansions",
+      input: "a$HOME${USER}$(echo x)`pwd`$?",
+      expected: []WordPart{
+        {Kind: LiteralPart, Text: "a"},
+        {Kind: ExpansionPart, Text: "$HOME"},
+        {Kind: ExpansionPart, Text: "${USER}"},
+        {Kind: ExpansionPart, Text: "$(echo x)"},
+        {Kind: ExpansionPart, Text: "`pwd`"},
+        {Kind: ExpansionPart, Text: "$?"},
+      },
+    },
+    {
+      name:  "Expansion inside double quotes",
+      input: "\"dir: $PWD!\"",
+      expected: []WordPart{
+        {Kind: DoubleQuotedPart, Text: "dir: "},
+        {Kind: ExpansionPart, Text: "$PWD", Quoted: true},
+        {Kind: DoubleQuotedPart, Text: "!"},
+      },
+    },
+    {
+      name:  "Escaped and single-quoted dollars stay literal",
+      input: "\\$HOME'$HOME'\"\\$HOME\"",
+      expected: []WordPart{
+        {Kind: SingleQuotedPart, Text: "$"},
+        {Kind: LiteralPart, Text: "HOME"},
+        {Kind: SingleQuotedPart, Text: "$HOME"},
+        {Kind: DoubleQuotedPart, Text: "$HOME"},
+      },
+    },
+    {
+      name:  "Lone dollar",
+      input: "5$",
+      expected: []WordPart{
+        {Kind: LiteralPart, Text: "5$"},
+      },
+    },
+    {
+      name:  "Command substitution with spaces and parentheses",
+      input: "$(echo (a) ')')",
+      expected: []WordPart{
+        {Kind: ExpansionPart, Text: "$(echo (a) ')')"},
+      },
+    },
+    {
+      name:     "Unterminated command substitution",
+      input:    "$(echo",
+      hasError: true,
+    },
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      tokens, err := NewLexer(test.input).Lex()
+      if (err != nil) != test.hasError {
+        t.Fatalf("Error expectation mismatch - got error: %v, expected error: %v", err, test.hasError)
+      }
+      if test.hasError {
+        return
+      }
+      if len(tokens) != 1 {
+        t.Fatalf("Expected a single word, got %+v", tokens)
+      }
+
+      parts := tokens[0].Parts
+      if len(parts) != len(test.expected) {
+        t.Fatalf("Expected parts %+v, got %+v", test.expected, parts)
+      }
+      for i := range parts {
+        if parts[i] != test.expected[i] {
+          t.Errorf("Part %d - Expected %+v, got %+v", i, test.expected[i], parts[i])
+        }
+      }
+    })
+  }
+}
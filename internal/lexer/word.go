@@ -0,0 +1,234 @@
+package lexer
+
+import (
+	"strings"
+)
+
+type PartKind int
+
+const (
+	// LiteralPart is unquoted text. A character escaped with a backslash is
+	// quoted, so it comes as a SingleQuotedPart of its own.
+	LiteralPart PartKind = iota
+	SingleQuotedPart
+	// DoubleQuotedPart is the text between double quotes, minus any
+	// expansions which get their own parts
+	DoubleQuotedPart
+	// ExpansionPart is a $name, ${...}, $(...) or `...` construct kept as
+	// written, to be expanded when the command runs
+	ExpansionPart
+)
+
+// WordPart is one piece of a word. `'foo'bar"$baz"` is a single word made
+// of a single-quoted part, a literal part and a quoted expansion.
+type WordPart struct {
+	Kind PartKind
+	Text string
+	// Quoted marks an expansion inside double quotes, whose result must not
+	// be split into fields
+	Quoted bool
+}
+
+// WordText is the word as a plain string with quotes removed and expansions
+// left unexpanded
+func WordText(parts []WordPart) string {
+	var text strings.Builder
+	for _, part := range parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
+
+// lexWord reads one word starting at the current position, up to the next
+// blank or operator outside quotes, or parenthesis inside [[ ]]
+func (l *Lexer) lexWord() ([]WordPart, error) {
+	parts := []WordPart{}
+	literal := strings.Builder{}
+	flush := func() {
+		if literal.Len() > 0 {
+			parts = append(parts, WordPart{Kind: LiteralPart, Text: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for l.position < len(l.input) {
+		c := l.input[l.position]
+		switch {
+		case isBlank(c) || c == '|' || c == '>' || c == '<' || (l.cond && (c == '(' || c == ')')):
+			flush()
+			return parts, nil
+		case c == '\'':
+			flush()
+			start := l.position
+			end := strings.IndexByte(l.input[start+1:], '\'')
+			if end < 0 {
+				return nil, &SyntaxError{Msg: "unexpected end of file while looking for matching \"'\"", Span: l.span(start, start+1)}
+			}
+			parts = append(parts, WordPart{Kind: SingleQuotedPart, Text: l.input[start+1 : start+1+end]})
+			l.position = start + end + 2
+		case c == '"':
+			flush()
+			quoted, err := l.lexDoubleQuoted()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, quoted...)
+		case c == '\\':
+			if l.position+1 < len(l.input) {
+				flush()
+				parts = append(parts, WordPart{Kind: SingleQuotedPart, Text: l.input[l.position+1 : l.position+2]})
+				l.position++
+			}
+			l.position++
+		case c == '$' || c == '`':
+			text, err := l.lexExpansion()
+			if err != nil {
+				return nil, err
+			}
+			if text == "" {
+				literal.WriteByte(c)
+				l.position++
+				continue
+			}
+			flush()
+			parts = append(parts, WordPart{Kind: ExpansionPart, Text: text})
+		default:
+			literal.WriteByte(c)
+			l.position++
+		}
+	}
+
+	flush()
+	return parts, nil
+}
+
+// lexDoubleQuoted reads a "..." string at the current position. Inside, a
+// backslash only escapes $, `, ", \ and newline, and expansions still apply.
+func (l *Lexer) lexDoubleQuoted() ([]WordPart, error) {
+	start := l.position
+	l.position++
+
+	parts := []WordPart{}
+	text := strings.Builder{}
+	for l.position < len(l.input) && l.input[l.position] != '"' {
+		c := l.input[l.position]
+		switch {
+		case c == '\\' && l.position+1 < len(l.input) && strings.IndexByte("$`\"\\\n", l.input[l.position+1]) >= 0:
+			if l.input[l.position+1] != '\n' {
+				text.WriteByte(l.input[l.position+1])
+			}
+			l.position += 2
+		case c == '$' || c == '`':
+			expansion, err := l.lexExpansion()
+			if err != nil {
+				return nil, err
+			}
+			if expansion == "" {
+				text.WriteByte(c)
+				l.position++
+				continue
+			}
+			if text.Len() > 0 {
+				parts = append(parts, WordPart{Kind: DoubleQuotedPart, Text: text.String()})
+				text.Reset()
+			}
+			parts = append(parts, WordPart{Kind: ExpansionPart, Text: expansion, Quoted: true})
+		default:
+			text.WriteByte(c)
+			l.position++
+		}
+	}
+	if l.position == len(l.input) {
+		return nil, &SyntaxError{Msg: "unexpected end of file while looking for matching '\"'", Span: l.span(start, start+1)}
+	}
+	l.position++
+
+	// Keep "" as an (empty) part so the word isn't dropped
+	if text.Len() > 0 || len(parts) == 0 {
+		parts = append(parts, WordPart{Kind: DoubleQuotedPart, Text: text.String()})
+	}
+	return parts, nil
+}
+
+// lexExpansion reads the $-construct or `command` at the current position
+// and returns it as written. An empty result means the '$' is literal.
+func (l *Lexer) lexExpansion() (string, error) {
+	start := l.position
+	rest := l.input[start:]
+
+	if rest[0] == '`' {
+		end := 1
+		for end < len(rest) && rest[end] != '`' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return "", &SyntaxError{Msg: "unexpected end of file while looking for matching '`'", Span: l.span(start, start+1)}
+		}
+		l.position += end + 1
+		return rest[:end+1], nil
+	}
+
+	if len(rest) < 2 {
+		return "", nil
+	}
+	end := 0
+	switch c := rest[1]; {
+	case c == '(':
+		end = MatchingParen(rest, 1)
+		if end < 0 {
+			return "", &SyntaxError{Msg: "unexpected end of file while looking for matching ')'", Span: l.span(start, start+2)}
+		}
+		end++
+	case c == '{':
+		end = strings.IndexByte(rest, '}')
+		if end < 0 {
+			return "", &SyntaxError{Msg: "unexpected end of file while looking for matching '}'", Span: l.span(start, start+2)}
+		}
+		end++
+	case strings.IndexByte("?$#@*!-", c) >= 0 || (c >= '0' && c <= '9'):
+		end = 2
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		end = 2
+		for end < len(rest) && (rest[end] == '_' || (rest[end] >= 'a' && rest[end] <= 'z') || (rest[end] >= 'A' && rest[end] <= 'Z') || (rest[end] >= '0' && rest[end] <= '9')) {
+			end++
+		}
+	default:
+		return "", nil
+	}
+
+	l.position += end
+	return rest[:end], nil
+}
+
+// MatchingParen returns the index of the ')' closing the '(' at open in s,
+// skipping over nested parentheses and quoted text, or -1 if there is none
+func MatchingParen(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '\\':
+			i++
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
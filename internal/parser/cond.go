@@ -0,0 +1,296 @@
+package parser
+
+import (
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+)
+
+// CondExpr is a node of a [[ ... ]] conditional expression
+type CondExpr struct {
+  // Op is "&&", "||" or "!" combining Left and Right (just Left for "!"),
+  // a unary test like "-f" or binary one like "==" on Args, or "" for a
+  // single word that is true when not empty
+  Op string
+  Left, Right *CondExpr
+  Args [][]lexer.WordPart
+}
+
+// UnaryCondOps are the tests that take one operand, shared by [[ and test
+var UnaryCondOps = map[string]bool{
+  "-a": true, "-b": true, "-c": true, "-d": true, "-e": true, "-f": true,
+  "-g": true, "-h": true, "-k": true, "-p": true, "-r": true, "-s": true,
+  "-t": true, "-u": true, "-w": true, "-x": true, "-G": true, "-L": true,
+  "-N": true, "-O": true, "-S": true, "-z": true, "-n": true, "-o": true,
+  "-v": true, "-R": true,
+}
+
+// BinaryCondOps are the tests that take two operands
+var BinaryCondOps = map[string]bool{
+  "=": true, "==": true, "!=": true, "<": true, ">": true, "=~": true,
+  "-eq": true, "-ne": true, "-lt": true, "-le": true, "-gt": true, "-ge": true,
+  "-nt": true, "-ot": true, "-ef": true,
+}
+
+// condToken is a word or operator inside [[ ]]. Inside, | < > are not pipes
+// and redirections but parts of || and the string comparisons.
+type condToken struct {
+  op    string
+  parts []lexer.WordPart
+  span  lexer.Span
+  // joined marks a token written right after the previous one, no blank
+  // in between
+  joined bool
+}
+
+// parseCond parses the [[ ... ]] starting with the [[ word at start and
+// returns the command it makes and where parsing should continue
+func parseCond(tokens []lexer.Token, start int) (*Command, int, error) {
+  condTokens := []condToken{}
+  end := -1
+  joined := false
+  for i := start + 1; i < len(tokens); i++ {
+    token := tokens[i]
+    switch token.Typ {
+    case lexer.Space:
+      joined = false
+      continue
+    case lexer.Pipe:
+      condTokens = append(condTokens, condToken{op: "|", span: token.Span, joined: joined})
+    case lexer.Redirect:
+      condTokens = append(condTokens, condToken{op: token.Text(), span: token.Span, joined: joined})
+    case lexer.LiteralStr:
+      if isOperatorWord(token.Parts, "]]") {
+        end = i
+        break
+      }
+      condTokens = append(condTokens, condToken{op: operatorText(token.Parts), parts: token.Parts, span: token.Span, joined: joined})
+    default:
+      return nil, 0, lexer.UnexpectedToken(token)
+    }
+    if end >= 0 {
+      break
+    }
+    joined = true
+  }
+  if end < 0 {
+    last := tokens[len(tokens)-1].Span.End
+    return nil, 0, &lexer.SyntaxError{Msg: "syntax error: unexpected end of file, expected ']]'", Span: lexer.Span{Start: last, End: last}}
+  }
+
+  p := &condParser{tokens: mergeOrOperators(condTokens), end: tokens[end]}
+  if len(p.tokens) == 0 {
+    return nil, 0, lexer.UnexpectedToken(tokens[end])
+  }
+  expr, err := p.or()
+  if err != nil {
+    return nil, 0, err
+  }
+  if p.pos < len(p.tokens) {
+    return nil, 0, p.unexpected()
+  }
+
+  command := &Command{
+    Name: "[[",
+    Args: []string{},
+    Redirs: []Redirection{},
+    Cond: expr,
+    Span: lexer.Span{Start: tokens[start].Span.Start, End: tokens[end].Span.End},
+  }
+
+  // Only a pipe may follow, arguments after ]] make no sense
+  next := end + 1
+  for next < len(tokens) && tokens[next].Typ == lexer.Space {
+    next++
+  }
+  if next == len(tokens) {
+    return command, next, nil
+  }
+  if tokens[next].Typ != lexer.Pipe {
+    return nil, 0, lexer.UnexpectedToken(tokens[next])
+  }
+  if !hasCommandAfter(tokens[next+1:]) {
+    return nil, 0, &lexer.SyntaxError{Msg: "syntax error: unexpected end of file", Span: tokens[next].Span}
+  }
+  return command, next + 1, nil
+}
+
+// mergeOrOperators turns two adjacent | into ||
+func mergeOrOperators(tokens []condToken) []condToken {
+  merged := make([]condToken, 0, len(tokens))
+  for _, token := range tokens {
+    if n := len(merged); n > 0 && token.op == "|" && token.joined && merged[n-1].op == "|" {
+      merged[n-1].op = "||"
+      merged[n-1].span.End = token.span.End
+      continue
+    }
+    merged = append(merged, token)
+  }
+  return merged
+}
+
+// isOperatorWord reports whether a word is exactly op, unquoted
+func isOperatorWord(parts []lexer.WordPart, op string) bool {
+  return len(parts) == 1 && parts[0].Kind == lexer.LiteralPart && parts[0].Text == op
+}
+
+// operatorText is the word's text if it could be an operator, i.e. it is
+// unquoted, and "" otherwise
+func operatorText(parts []lexer.WordPart) string {
+  if len(parts) == 1 && parts[0].Kind == lexer.LiteralPart {
+    return parts[0].Text
+  }
+  return ""
+}
+
+type condParser struct {
+  tokens []condToken
+  pos int
+  // end is the ]] token, for errors at the end of the expression
+  end lexer.Token
+}
+
+func (p *condParser) peek() string {
+  if p.pos < len(p.tokens) {
+    return p.tokens[p.pos].op
+  }
+  return ""
+}
+
+func (p *condParser) unexpected() error {
+  if p.pos >= len(p.tokens) {
+    return lexer.UnexpectedToken(p.end)
+  }
+  token := p.tokens[p.pos]
+  text := token.op
+  if token.parts != nil {
+    text = lexer.WordText(token.parts)
+  }
+  return lexer.UnexpectedToken(lexer.Token{Typ: lexer.LiteralStr, Literal: text, Span: token.span})
+}
+
+func (p *condParser) or() (*CondExpr, error) {
+  left, err := p.and()
+  if err != nil {
+    return nil, err
+  }
+  for p.peek() == "||" {
+    p.pos++
+    right, err := p.and()
+    if err != nil {
+      return nil, err
+    }
+    left = &CondExpr{Op: "||", Left: left, Right: right}
+  }
+  return left, nil
+}
+
+func (p *condParser) and() (*CondExpr, error) {
+  left, err := p.not()
+  if err != nil {
+    return nil, err
+  }
+  for p.peek() == "&&" {
+    p.pos++
+    right, err := p.not()
+    if err != nil {
+      return nil, err
+    }
+    left = &CondExpr{Op: "&&", Left: left, Right: right}
+  }
+  return left, nil
+}
+
+func (p *condParser) not() (*CondExpr, error) {
+  if p.peek() == "!" {
+    p.pos++
+    operand, err := p.not()
+    if err != nil {
+      return nil, err
+    }
+    return &CondExpr{Op: "!", Left: operand}, nil
+  }
+  return p.primary()
+}
+
+func (p *condParser) primary() (*CondExpr, error) {
+  if p.pos >= len(p.tokens) {
+    return nil, p.unexpected()
+  }
+
+  if p.peek() == "(" {
+    p.pos++
+    inner, err := p.or()
+    if err != nil {
+      return nil, err
+    }
+    if p.peek() != ")" {
+      return nil, p.unexpected()
+    }
+    p.pos++
+    return inner, nil
+  }
+
+  if op := p.peek(); UnaryCondOps[op] && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].parts != nil && !BinaryCondOps[p.tokenOp(p.pos+1)] {
+    p.pos += 2
+    return &CondExpr{Op: op, Args: [][]lexer.WordPart{p.tokens[p.pos-1].parts}}, nil
+  }
+
+  left, err := p.word()
+  if err != nil {
+    return nil, err
+  }
+  op := p.peek()
+  if !BinaryCondOps[op] {
+    return &CondExpr{Args: [][]lexer.WordPart{left}}, nil
+  }
+  p.pos++
+
+  var right []lexer.WordPart
+  if op == "=~" {
+    right, err = p.regex()
+  } else {
+    right, err = p.word()
+  }
+  if err != nil {
+    return nil, err
+  }
+  return &CondExpr{Op: op, Args: [][]lexer.WordPart{left, right}}, nil
+}
+
+func (p *condParser) tokenOp(i int) string {
+  if i < len(p.tokens) {
+    return p.tokens[i].op
+  }
+  return ""
+}
+
+// word takes an operand, which must be a word and not a lone operator
+func (p *condParser) word() ([]lexer.WordPart, error) {
+  if p.pos >= len(p.tokens) || p.tokens[p.pos].parts == nil {
+    return nil, p.unexpected()
+  }
+  switch p.peek() {
+  case "&&", "||", "(", ")":
+    return nil, p.unexpected()
+  }
+  p.pos++
+  return p.tokens[p.pos-1].parts, nil
+}
+
+// regex takes the right side of =~. A regex like a(b|c) is lexed as several
+// tokens, so everything up to the next blank is joined back together.
+func (p *condParser) regex() ([]lexer.WordPart, error) {
+  if p.pos >= len(p.tokens) {
+    return nil, p.unexpected()
+  }
+  parts := []lexer.WordPart{}
+  for first := true; p.pos < len(p.tokens) && (first || p.tokens[p.pos].joined); first = false {
+    token := p.tokens[p.pos]
+    if token.parts != nil {
+      parts = append(parts, token.parts...)
+    } else {
+      parts = append(parts, lexer.WordPart{Kind: lexer.LiteralPart, Text: token.op})
+    }
+    p.pos++
+  }
+  return parts, nil
+}
@@ -0,0 +1,110 @@
+package parser
+
+import (
+  "fmt"
+  "strings"
+  "testing"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+)
+
+// condString renders an expression as an s-expression for comparison
+func condString(expr *CondExpr) string {
+  switch expr.Op {
+  case "&&", "||":
+    return fmt.Sprintf("(%s %s %s)", expr.Op, condString(expr.Left), condString(expr.Right))
+  case "!":
+    return fmt.Sprintf("(! %s)", condString(expr.Left))
+  }
+  words := make([]string, 0, len(expr.Args))
+  for _, arg := range expr.Args {
+    words = append(words, lexer.WordText(arg))
+  }
+  if expr.Op == "" {
+    return strings.Join(words, " ")
+  }
+  return fmt.Sprintf("(%s %s)", expr.Op, strings.Join(words, " "))
+}
+
+func TestParseCond(t *testing.T) {
+  tests := []struct {
+    name     string
+    input    string
+    expected string
+  }{
+    {"Single word", "[[ $x ]]", "$x"},
+    {"Unary", "[[ -f file ]]", "(-f file)"},
+    {"Binary", "[[ a == b* ]]", "(== a b*)"},
+    {"Operator as operand", "[[ -f == x ]]", "(== -f x)"},
+    {"Quoted operator is a word", "[[ '-f' ]]", "-f"},
+    {"String ordering", "[[ a < b ]]", "(< a b)"},
+    {"And before or", "[[ a || b && c ]]", "(|| a (&& b c))"},
+    {"Negation", "[[ ! -z a && b ]]", "(&& (! (-z a)) b)"},
+    {"Parentheses", "[[ ( a || b ) && c ]]", "(&& (|| a b) c)"},
+    {"Unspaced parentheses", "[[ (a == a) ]]", "(== a a)"},
+    {"Negated group", "[[ !(a||b)&&(c) ]]", "(&& (! (|| a b)) c)"},
+    {"Quoted parenthesis is a word", "[[ '(' == \"(\" ]]", "(== ( ()"},
+    {"Regex with specials", "[[ $x =~ ^(a|b)$ ]]", "(=~ $x ^(a|b)$)"},
+    {"Regex ends at blank", "[[ x =~ a|b || y ]]", "(|| (=~ x a|b) y)"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      tokens, err := lexer.NewLexer(test.input).Lex()
+      if err != nil {
+        t.Fatalf("Unexpected lexer error: %v", err)
+      }
+      commands, err := ParseTokens(tokens)
+      if err != nil {
+        t.Fatalf("Unexpected parser error: %v", err)
+      }
+      if len(commands) != 1 || commands[0].Cond == nil {
+        t.Fatalf("Expected a single [[ command, got %+v", commands)
+      }
+      if result := condString(commands[0].Cond); result != test.expected {
+        t.Errorf("Parsed %q as %s, expected %s", test.input, result, test.expected)
+      }
+    })
+  }
+}
+
+func TestParseCondPipeline(t *testing.T) {
+  tokens, _ := lexer.NewLexer("[[ -n a ]] | cat").Lex()
+  commands, err := ParseTokens(tokens)
+  if err != nil {
+    t.Fatalf("Unexpected parser error: %v", err)
+  }
+  if len(commands) != 2 || commands[0].Cond == nil || commands[1].Name != "cat" {
+    t.Errorf("Expected [[ piped into cat, got %+v", commands)
+  }
+}
+
+func TestParseCondErrors(t *testing.T) {
+  tests := []struct {
+    name    string
+    input   string
+    message string
+  }{
+    {"Unterminated", "[[ a == b", "syntax error: unexpected end of file, expected ']]'"},
+    {"Empty", "[[ ]]", "syntax error near unexpected token ']]'"},
+    {"Missing operand", "[[ a == ]]", "syntax error near unexpected token ']]'"},
+    {"Dangling and", "[[ a && ]]", "syntax error near unexpected token ']]'"},
+    {"Single pipe", "[[ a | b ]]", "syntax error near unexpected token '|'"},
+    {"Unclosed parenthesis", "[[ ( a ]]", "syntax error near unexpected token ']]'"},
+    {"Two words", "[[ a b ]]", "syntax error near unexpected token 'b'"},
+    {"Argument after", "[[ a ]] b", "syntax error near unexpected token 'b'"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      tokens, err := lexer.NewLexer(test.input).Lex()
+      if err != nil {
+        t.Fatalf("Unexpected lexer error: %v", err)
+      }
+      _, err = ParseTokens(tokens)
+      if err == nil || err.Error() != test.message {
+        t.Errorf("ParseTokens(%q) error = %v, expected %q", test.input, err, test.message)
+      }
+    })
+  }
+}
@@ -0,0 +1,225 @@
+package parser
+
+import (
+  "fmt"
+  "strings"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+)
+
+// closers maps the constructs that span lines until a closing word to that
+// word. The shell can't run any of them, so a command left with one open
+// isn't continued but reported.
+var closers = map[string]string{
+  "if": "fi",
+  "while": "done",
+  "until": "done",
+  "for": "done",
+  "select": "done",
+  "case": "esac",
+  "{": "}",
+  "(": ")",
+}
+
+// opening is a construct that needs more lines, and where it starts
+type opening struct {
+  text string
+  offset int
+}
+
+// Continuation is the result of scanning a possibly partial command to see
+// whether the user still has to type more before it can run
+type Continuation struct {
+  quote byte
+  pipe bool
+  escapedNewline bool
+  // unsupported is a construct left open that the shell can't run, so no
+  // more lines are read for it
+  unsupported *lexer.SyntaxError
+}
+
+// Incomplete reports whether the command goes on in the next line: a quote
+// is open, the line ends in a backslash or it ends in a pipe
+func (c Continuation) Incomplete() bool {
+  return c.unsupported == nil && (c.quote != 0 || c.pipe || c.escapedNewline)
+}
+
+// Err is the syntax error for a construct left open, like if, { or a
+// here-document, that the shell doesn't support
+func (c Continuation) Err() error {
+  if c.unsupported == nil {
+    return nil
+  }
+  return c.unsupported
+}
+
+// ScanContinuation walks input the way the parser eventually will, tracking
+// open quotes and a trailing pipe or backslash that need another line. It
+// also notes compound commands (if/fi, while/done, case/esac, { }, ( )),
+// here-documents and a trailing && or || left open, which are unsupported.
+func ScanContinuation(input string) Continuation {
+  c := Continuation{}
+  cmdStart := true
+  word := strings.Builder{}
+  wordQuoted, wordStart := false, 0
+  open := []opening{}
+  var heredoc, andOr *opening
+
+  flush := func() {
+    if word.Len() == 0 && !wordQuoted {
+      return
+    }
+    w := word.String()
+    word.Reset()
+    quoted := wordQuoted
+    wordQuoted = false
+    c.pipe, andOr = false, nil
+
+    if !cmdStart || quoted {
+      cmdStart = false
+      return
+    }
+    switch w {
+    case "if", "{":
+      open = append(open, opening{w, wordStart})
+    case "while", "until", "for", "select", "case":
+      open = append(open, opening{w, wordStart})
+      cmdStart = false
+      return
+    case "fi", "done", "esac", "}":
+      if n := len(open); n > 0 && closers[open[n-1].text] == w {
+        open = open[:n-1]
+      }
+      cmdStart = false
+      return
+    case "then", "else", "elif", "do", "!":
+    default:
+      cmdStart = false
+      return
+    }
+    cmdStart = true
+  }
+
+  offset := 0
+  for _, line := range strings.Split(input, "\n") {
+    c.escapedNewline = false
+
+    for i := 0; i < len(line); i++ {
+      ch := line[i]
+      switch c.quote {
+      case '\'':
+        if ch == '\'' {
+          c.quote = 0
+        }
+        continue
+      case '"', '`':
+        if ch == '\\' {
+          c.escapedNewline = i == len(line)-1
+          i++
+        } else if ch == c.quote {
+          c.quote = 0
+        }
+        continue
+      }
+
+      if word.Len() == 0 && !wordQuoted {
+        wordStart = offset + i
+      }
+      switch {
+      case ch == '\\':
+        if i == len(line)-1 {
+          c.escapedNewline = true
+        } else {
+          word.WriteByte(line[i+1])
+          i++
+        }
+      case ch == '\'' || ch == '"' || ch == '`':
+        c.quote = ch
+        wordQuoted = true
+      case ch == ' ' || ch == '\t':
+        flush()
+      case ch == '#' && word.Len() == 0 && !wordQuoted:
+        i = len(line)
+      case ch == '|':
+        flush()
+        if i+1 < len(line) && line[i+1] == '|' {
+          andOr = &opening{"||", offset + i}
+          i++
+        } else {
+          c.pipe = true
+        }
+        cmdStart = true
+      case ch == '&':
+        flush()
+        if i+1 < len(line) && line[i+1] == '&' {
+          andOr = &opening{"&&", offset + i}
+          i++
+        }
+        cmdStart = true
+      case ch == ';':
+        flush()
+        cmdStart = true
+      case ch == '(':
+        flush()
+        open = append(open, opening{"(", offset + i})
+        cmdStart = true
+      case ch == ')':
+        flush()
+        // A ')' also ends case patterns, only treat it as closing a subshell
+        // when one is open
+        if n := len(open); n > 0 && open[n-1].text == "(" {
+          open = open[:n-1]
+        }
+        cmdStart = false
+      case ch == '<' && strings.HasPrefix(line[i:], "<<<"):
+        // A here-string carries its text on the same line
+        flush()
+        i += 2
+      case ch == '<' && strings.HasPrefix(line[i:], "<<"):
+        flush()
+        if heredoc == nil {
+          heredoc = &opening{"<<", offset + i}
+        }
+        i++
+      default:
+        word.WriteByte(ch)
+      }
+    }
+
+    // An unquoted newline ends the current command, just like ';'
+    if c.quote == 0 && !c.escapedNewline {
+      flush()
+      cmdStart = true
+    }
+    offset += len(line) + 1
+  }
+
+  // The outermost construct is the one reported
+  var unsupported *opening
+  switch {
+  case len(open) > 0:
+    unsupported = &open[0]
+  case heredoc != nil:
+    unsupported = heredoc
+  case andOr != nil:
+    unsupported = andOr
+  }
+  if unsupported != nil {
+    l := lexer.NewLexer(input)
+    c.unsupported = &lexer.SyntaxError{
+      Msg: fmt.Sprintf("syntax error: '%s' is not supported", unsupported.text),
+      Span: lexer.Span{Start: l.PositionAt(unsupported.offset), End: l.PositionAt(unsupported.offset + len(unsupported.text))},
+    }
+  }
+  return c
+}
+
+// JoinContinuation appends the next physical line to a logical command. A
+// trailing backslash-newline disappears entirely, anything else keeps the
+// newline so the history entry looks like what was typed.
+func JoinContinuation(input, next string, c Continuation) string {
+  if c.escapedNewline {
+    return input[:len(input)-1] + next
+  }
+  return input + "\n" + next
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+  "testing"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+)
+
+func TestScanContinuation(t *testing.T) {
+  tests := []struct {
+    name       string
+    input      string
+    incomplete bool
+    err        string
+  }{
+    {"Simple command", "echo hello", false, ""},
+    {"Open single quote", "echo 'hello", true, ""},
+    {"Closed single quote over lines", "echo 'hello\nworld'", false, ""},
+    {"Open double quote", "echo \"hello", true, ""},
+    {"Escaped quote", "echo \\'hello", false, ""},
+    {"Trailing backslash", "echo hello \\", true, ""},
+    {"Trailing pipe", "cat file |", true, ""},
+    {"Trailing pipe with blank line", "cat file |\n", true, ""},
+    {"Pipe continued", "cat file |\ngrep a", false, ""},
+    {"Trailing and", "true &&", false, "syntax error: '&&' is not supported"},
+    {"Trailing or", "false ||", false, "syntax error: '||' is not supported"},
+    {"Background job", "sleep 1 &", false, ""},
+    {"Quoted pipe", "echo '|'", false, ""},
+    {"Comment with pipe", "echo a # |", false, ""},
+    {"Conditional with or", "[[ -z a || -n a ]]", false, ""},
+    {"Regex alternation", "[[ ab =~ a(b|c) ]]", false, ""},
+    {"Open if", "if true; then", false, "syntax error: 'if' is not supported"},
+    {"Open if and quote", "if 'true", false, "syntax error: 'if' is not supported"},
+    {"Open while", "while true", false, "syntax error: 'while' is not supported"},
+    {"Keyword as argument", "echo if", false, ""},
+    {"Quoted keyword", "'if' true", false, ""},
+    {"Open brace group", "{ echo a", false, "syntax error: '{' is not supported"},
+    {"Open subshell", "(cd /tmp", false, "syntax error: '(' is not supported"},
+    {"Open case", "case a in", false, "syntax error: 'case' is not supported"},
+    {"Here-document", "cat <<EOF", false, "syntax error: '<<' is not supported"},
+    {"Here-string", "cat <<< hello", false, ""},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      state := ScanContinuation(test.input)
+      if result := state.Incomplete(); result != test.incomplete {
+        t.Errorf("ScanContinuation(%q).Incomplete() = %v, expected %v", test.input, result, test.incomplete)
+      }
+      err := ""
+      if state.Err() != nil {
+        err = state.Err().Error()
+      }
+      if err != test.err {
+        t.Errorf("ScanContinuation(%q).Err() = %q, expected %q", test.input, err, test.err)
+      }
+    })
+  }
+}
+
+func TestScanContinuationSpan(t *testing.T) {
+  err, ok := ScanContinuation("echo 'a\nb' &&").Err().(*lexer.SyntaxError)
+  if !ok {
+    t.Fatal("Expected a syntax error for the trailing &&")
+  }
+  expected := lexer.Span{
+    Start: lexer.Position{Offset: 11, Line: 2, Col: 4},
+    End:   lexer.Position{Offset: 13, Line: 2, Col: 6},
+  }
+  if err.Span != expected {
+    t.Errorf("Expected span %+v, got %+v", expected, err.Span)
+  }
+}
+
+func TestJoinContinuation(t *testing.T) {
+  tests := []struct {
+    name     string
+    input    string
+    next     string
+    expected string
+  }{
+    {"Backslash newline", "echo a \\", "b", "echo a b"},
+    {"Backslash newline in double quotes", "echo \"a\\", "b\"", "echo \"ab\""},
+    {"Open quote keeps newline", "echo 'a", "b'", "echo 'a\nb'"},
+    {"Pipe keeps newline", "cat |", "wc", "cat |\nwc"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      result := JoinContinuation(test.input, test.next, ScanContinuation(test.input))
+      if result != test.expected {
+        t.Errorf("Expected %q, got %q", test.expected, result)
+      }
+    })
+  }
+}
@@ -2,6 +2,9 @@ package parser
 
 import (
   "fmt"
+  "strconv"
+  "strings"
+
   "github.com/cheesyhypocrisy/harsh/internal/lexer"
 )
 
@@ -9,12 +12,34 @@ type Redirection struct {
   Type string
   Fd int
   FilePath string
+  // Target is the file name as a word, expanded when the command runs
+  Target []lexer.WordPart
+  // Span runs from the operator to the end of the file name
+  Span lexer.Span
+}
+
+// Assignment is a NAME=value word before the command name. Value is the
+// part after the =, expanded when the command runs.
+type Assignment struct {
+  Name string
+  Value []lexer.WordPart
 }
 
 type Command struct {
   Name string
   Args []string
+  // Words holds the name and arguments as lexed, quoting included, so the
+  // executor can expand them; Name and Args are their unexpanded text
+  Words [][]lexer.WordPart
   Redirs []Redirection
+  // Assigns are the variable assignments the command starts with. Alone
+  // they set shell variables, before a name only its environment.
+  Assigns []Assignment
+  // Cond is set for a [[ ... ]] command, which is evaluated by the shell
+  // itself rather than run with arguments
+  Cond *CondExpr
+  // Span runs from the command name to its last argument or redirection
+  Span lexer.Span
 }
 
 func ParseTokens(tokens []lexer.Token) ([]*Command, error) {
@@ -47,64 +72,183 @@ func ParseCommand(tokens []lexer.Token, start int) (*Command, int, error) {
     return nil, len(tokens), nil
   }
   if tokens[i].Typ != lexer.LiteralStr {
-    return nil, len(tokens), fmt.Errorf("No command provided!")
+    return nil, len(tokens), lexer.UnexpectedToken(tokens[i])
+  }
+  if isOperatorWord(tokens[i].Parts, "[[") {
+    return parseCond(tokens, i)
   }
   name := tokens[i].Literal
+  words := [][]lexer.WordPart{tokens[i].Parts}
+  span := tokens[i].Span
   i++
   tokens = tokens[i:]
   args := make([]string, 0)
   redirs := make([]Redirection, 0)
   for j := 0; j < len(tokens); j++ {
-    if tokens[j].Typ == lexer.LiteralStr || (name == "echo" && tokens[j].Typ == lexer.Space && j != 0) {
+    if tokens[j].Typ == lexer.LiteralStr {
       args = append(args, tokens[j].Literal)
-    } else if tokens[j].Typ == lexer.Redirect {
-      redirFd := 1
-      redirType := ">"
-      switch tokens[j].Literal {
-      case "stdout":
-        redirType = ">"
-        redirFd = 1
-      case "stderr":
-        redirType = ">"
-        redirFd = 2
-      }
-      j++
-      for j < len(tokens) && tokens[j].Typ == lexer.Space {
-        j++
-      }
-      if j >= len(tokens) || tokens[j].Typ != lexer.LiteralStr {
-        return nil, 0, fmt.Errorf("Expected file path for redirect!\n")
-      }
-      redirs = append(redirs, Redirection{Type: redirType, Fd: redirFd, FilePath: tokens[j].Literal})
-    } else if tokens[j].Typ == lexer.Append {
-      redirFd := 1
-      redirType := ">>"
-      switch tokens[j].Literal {
-      case "stdout":
-        redirType = ">>"
-        redirFd = 1
-      case "stderr":
-        redirType = ">>"
-        redirFd = 2
+      words = append(words, tokens[j].Parts)
+      span.End = tokens[j].Span.End
+    } else if tokens[j].Typ == lexer.Redirect || tokens[j].Typ == lexer.Append || tokens[j].Typ == lexer.Duplicate {
+      redirType, redirFd := redirectOp(tokens[j])
+      if err := expectRedirectTarget(tokens, j); err != nil {
+        return nil, 0, err
       }
+      op := tokens[j]
       j++
       for j < len(tokens) && tokens[j].Typ == lexer.Space {
         j++
       }
-      if j >= len(tokens) || tokens[j].Typ != lexer.LiteralStr {
-        return nil, 0, fmt.Errorf("Expected file path for redirect!\n")
-      }
-      redirs = append(redirs, Redirection{Type: redirType, Fd: redirFd, FilePath: tokens[j].Literal})
+      redirSpan := lexer.Span{Start: op.Span.Start, End: tokens[j].Span.End}
+      redirs = append(redirs, Redirection{Type: redirType, Fd: redirFd, FilePath: tokens[j].Literal, Target: tokens[j].Parts, Span: redirSpan})
+      span.End = redirSpan.End
     } else if tokens[j].Typ == lexer.Pipe {
-      if name == "echo" {
-        end := len(args)-1
-        for ; end >= 0 && args[end] == " "; end-- {}
-        args = args[:end+1]
+      if !hasCommandAfter(tokens[j+1:]) {
+        return nil, 0, &lexer.SyntaxError{Msg: "syntax error: unexpected end of file", Span: tokens[j].Span}
       }
-      return &Command{Name: name, Args: args, Redirs: redirs}, j+i+2, nil
+      return splitAssignments(&Command{Name: name, Args: args, Words: words, Redirs: redirs, Span: span}), j+i+1, nil
+    }
+  }
+
+  return splitAssignments(&Command{Name: name, Args: args, Words: words, Redirs: redirs, Span: span}), len(tokens)+i, nil
+}
+
+// splitAssignments moves the NAME=value words at the start of command to
+// Assigns. If nothing else is left Name is empty.
+func splitAssignments(command *Command) *Command {
+  for len(command.Words) > 0 {
+    assign, ok := assignmentWord(command.Words[0])
+    if !ok {
+      break
+    }
+    command.Assigns = append(command.Assigns, assign)
+    command.Words = command.Words[1:]
+    command.Name = ""
+    if len(command.Args) > 0 {
+      command.Name, command.Args = command.Args[0], command.Args[1:]
     }
   }
+  return command
+}
+
+// assignmentWord recognizes NAME=value, where NAME and the = are unquoted
+func assignmentWord(parts []lexer.WordPart) (Assignment, bool) {
+  if len(parts) == 0 || parts[0].Kind != lexer.LiteralPart {
+    return Assignment{}, false
+  }
+  text := parts[0].Text
+  eq := strings.IndexByte(text, '=')
+  if eq <= 0 || !isName(text[:eq]) {
+    return Assignment{}, false
+  }
 
-  return &Command{Name: name, Args: args, Redirs: redirs}, len(tokens)+start+1, nil
+  value := []lexer.WordPart{}
+  if eq+1 < len(text) {
+    value = append(value, lexer.WordPart{Kind: lexer.LiteralPart, Text: text[eq+1:]})
+  }
+  return Assignment{Name: text[:eq], Value: append(value, parts[1:]...)}, true
 }
 
+// isName reports whether s can name a variable: letters, digits and
+// underscores, not starting with a digit
+func isName(s string) bool {
+  for i := 0; i < len(s); i++ {
+    c := s[i]
+    letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+    if !letter && !(i > 0 && c >= '0' && c <= '9') {
+      return false
+    }
+  }
+  return s != ""
+}
+
+// CheckTokens parses tokens like ParseTokens but doesn't stop at the first
+// syntax error: parsing resumes with the next command of the pipeline so
+// every problem in the input gets reported
+func CheckTokens(tokens []lexer.Token) []*lexer.SyntaxError {
+  errs := make([]*lexer.SyntaxError, 0)
+  i := 0
+  for i < len(tokens) {
+    _, next, err := ParseCommand(tokens, i)
+    if err == nil {
+      i = next
+      continue
+    }
+
+    syntaxErr, ok := err.(*lexer.SyntaxError)
+    if !ok {
+      syntaxErr = &lexer.SyntaxError{Msg: err.Error(), Span: tokens[i].Span}
+    }
+    errs = append(errs, syntaxErr)
+
+    resume := len(tokens)
+    for k := i; k < len(tokens); k++ {
+      if tokens[k].Typ == lexer.Pipe && tokens[k].Span.Start.Offset >= syntaxErr.Span.Start.Offset {
+        resume = k + 1
+        break
+      }
+    }
+    i = resume
+  }
+  return errs
+}
+
+// redirectOp is the operator (<, >, >>, <& or >&) and descriptor of a
+// redirection token
+func redirectOp(token lexer.Token) (string, int) {
+  switch token.Literal {
+  case "stdin":
+    return "<", 0
+  case "stdout":
+    if token.Typ == lexer.Append {
+      return ">>", 1
+    }
+    return ">", 1
+  case "stderr":
+    if token.Typ == lexer.Append {
+      return ">>", 2
+    }
+    return ">", 2
+  }
+
+  // Anything else is spelled out, a descriptor number and the operator
+  digits := 0
+  for digits < len(token.Literal) && token.Literal[digits] >= '0' && token.Literal[digits] <= '9' {
+    digits++
+  }
+  op := token.Literal[digits:]
+  fd, err := strconv.Atoi(token.Literal[:digits])
+  if err != nil {
+    fd = 1
+    if op[0] == '<' {
+      fd = 0
+    }
+  }
+  return op, fd
+}
+
+// expectRedirectTarget checks that the redirection operator at i is followed
+// by a file name
+func expectRedirectTarget(tokens []lexer.Token, i int) error {
+  j := i + 1
+  for j < len(tokens) && tokens[j].Typ == lexer.Space {
+    j++
+  }
+  if j >= len(tokens) {
+    end := tokens[i].Span.End
+    return &lexer.SyntaxError{Msg: "syntax error near unexpected token 'newline'", Span: lexer.Span{Start: end, End: end}}
+  }
+  if tokens[j].Typ != lexer.LiteralStr {
+    return lexer.UnexpectedToken(tokens[j])
+  }
+  return nil
+}
+
+func hasCommandAfter(tokens []lexer.Token) bool {
+  for _, token := range tokens {
+    if token.Typ != lexer.Space {
+      return true
+    }
+  }
+  return false
+}
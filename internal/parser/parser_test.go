@@ -43,7 +43,7 @@ func TestParseTokens(t *testing.T) {
       expected: []*Command{
         {
           Name: "echo",
-          Args: []string{"hello", " "},
+          Args: []string{"hello"},
           Redirs: []Redirection{
             {Type: ">", Fd: 1, FilePath: "output.txt"},
           },
@@ -51,6 +51,27 @@ func TestParseTokens(t *testing.T) {
       },
       hasError: false,
     },
+    {
+      name: "Command with input redirection",
+      tokens: []lexer.Token{
+        {Typ: lexer.LiteralStr, Literal: "read"},
+        {Typ: lexer.Space, Literal: " "},
+        {Typ: lexer.LiteralStr, Literal: "line"},
+        {Typ: lexer.Space, Literal: " "},
+        {Typ: lexer.Redirect, Literal: "stdin"},
+        {Typ: lexer.LiteralStr, Literal: "input.txt"},
+      },
+      expected: []*Command{
+        {
+          Name: "read",
+          Args: []string{"line"},
+          Redirs: []Redirection{
+            {Type: "<", Fd: 0, FilePath: "input.txt"},
+          },
+        },
+      },
+      hasError: false,
+    },
     {
       name: "Command with append redirection",
       tokens: []lexer.Token{
@@ -65,7 +86,7 @@ func TestParseTokens(t *testing.T) {
       expected: []*Command{
         {
           Name: "echo",
-          Args: []string{"hello", " "},
+          Args: []string{"hello"},
           Redirs: []Redirection{
             {Type: ">>", Fd: 1, FilePath: "output.txt"},
           },
@@ -109,6 +130,59 @@ func TestParseTokens(t *testing.T) {
       },
       hasError: false,
     },
+    {
+      name: "Pipe without space before command",
+      tokens: []lexer.Token{
+        {Typ: lexer.LiteralStr, Literal: "ls"},
+        {Typ: lexer.Space, Literal: " "},
+        {Typ: lexer.Pipe, Literal: "pipe"},
+        {Typ: lexer.LiteralStr, Literal: "wc"},
+      },
+      expected: []*Command{
+        {
+          Name:   "ls",
+          Args:   []string{},
+          Redirs: []Redirection{},
+        },
+        {
+          Name:   "wc",
+          Args:   []string{},
+          Redirs: []Redirection{},
+        },
+      },
+      hasError: false,
+    },
+    {
+      name: "Leading pipe",
+      tokens: []lexer.Token{
+        {Typ: lexer.Pipe, Literal: "pipe"},
+        {Typ: lexer.Space, Literal: " "},
+        {Typ: lexer.LiteralStr, Literal: "wc"},
+      },
+      expected: []*Command{},
+      hasError: true,
+    },
+    {
+      name: "Trailing pipe",
+      tokens: []lexer.Token{
+        {Typ: lexer.LiteralStr, Literal: "ls"},
+        {Typ: lexer.Space, Literal: " "},
+        {Typ: lexer.Pipe, Literal: "pipe"},
+        {Typ: lexer.Space, Literal: " "},
+      },
+      expected: []*Command{},
+      hasError: true,
+    },
+    {
+      name: "Redirection without target",
+      tokens: []lexer.Token{
+        {Typ: lexer.LiteralStr, Literal: "ls"},
+        {Typ: lexer.Space, Literal: " "},
+        {Typ: lexer.Redirect, Literal: "stdout"},
+      },
+      expected: []*Command{},
+      hasError: true,
+    },
   }
 
   for _, test := range tests {
@@ -162,3 +236,162 @@ func TestParseTokens(t *testing.T) {
     })
   }
 }
+
+func TestSyntaxErrorPosition(t *testing.T) {
+  tests := []struct {
+    name     string
+    input    string
+    message  string
+    pos      int
+  }{
+    {"Leading pipe", "| wc", "syntax error near unexpected token '|'", 0},
+    {"Double pipe", "ls | | wc", "syntax error near unexpected token '|'", 5},
+    {"Redirect into pipe", "ls > | wc", "syntax error near unexpected token '|'", 5},
+    {"Redirect at end", "ls 2>", "syntax error near unexpected token 'newline'", 5},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      tokens, err := lexer.NewLexer(test.input).Lex()
+      if err != nil {
+        t.Fatalf("Unexpected lexer error: %v", err)
+      }
+      _, err = ParseTokens(tokens)
+      syntaxErr, ok := err.(*lexer.SyntaxError)
+      if !ok {
+        t.Fatalf("Expected *lexer.SyntaxError, got %T (%v)", err, err)
+      }
+      if syntaxErr.Msg != test.message || syntaxErr.Span.Start.Offset != test.pos {
+        t.Errorf("Expected %q at %d, got %q at %d", test.message, test.pos, syntaxErr.Msg, syntaxErr.Span.Start.Offset)
+      }
+    })
+  }
+}
+
+func TestCommandSpans(t *testing.T) {
+  tokens, err := lexer.NewLexer("ls -l > out | wc").Lex()
+  if err != nil {
+    t.Fatalf("Unexpected lexer error: %v", err)
+  }
+  commands, err := ParseTokens(tokens)
+  if err != nil {
+    t.Fatalf("Unexpected parser error: %v", err)
+  }
+
+  spans := [][2]int{}
+  for _, command := range commands {
+    spans = append(spans, [2]int{command.Span.Start.Offset, command.Span.End.Offset})
+  }
+  if len(spans) != 2 || spans[0] != [2]int{0, 11} || spans[1] != [2]int{14, 16} {
+    t.Errorf("Unexpected command spans %v", spans)
+  }
+
+  redir := commands[0].Redirs[0].Span
+  if redir.Start.Offset != 6 || redir.End.Offset != 11 {
+    t.Errorf("Unexpected redirection span %+v", redir)
+  }
+}
+
+func TestCheckTokens(t *testing.T) {
+  tokens, err := lexer.NewLexer("| ls | | wc > | cat").Lex()
+  if err != nil {
+    t.Fatalf("Unexpected lexer error: %v", err)
+  }
+
+  errs := CheckTokens(tokens)
+  offsets := []int{}
+  for _, err := range errs {
+    offsets = append(offsets, err.Span.Start.Offset)
+  }
+  expected := []int{0, 7, 14}
+  if len(offsets) != len(expected) {
+    t.Fatalf("Expected errors at %v, got %v", expected, offsets)
+  }
+  for i := range expected {
+    if offsets[i] != expected[i] {
+      t.Errorf("Expected errors at %v, got %v", expected, offsets)
+    }
+  }
+}
+
+func TestParseAssignments(t *testing.T) {
+  tests := []struct {
+    name    string
+    line    string
+    assigns []string
+    command string
+    args    []string
+  }{
+    {"Assignment alone", "a=1", []string{"a=1"}, "", []string{}},
+    {"Several", "a=1 b=2", []string{"a=1", "b=2"}, "", []string{}},
+    {"Before a command", "IFS=: read x", []string{"IFS=:"}, "read", []string{"x"}},
+    {"Empty value", "a= env", []string{"a="}, "env", []string{}},
+    {"Quoted value", `a="x y" env`, []string{"a=x y"}, "env", []string{}},
+    {"Only leading words", "echo a=1", []string{}, "echo", []string{"a=1"}},
+    {"Stops at the name", "a=1 echo b=2", []string{"a=1"}, "echo", []string{"b=2"}},
+    {"Invalid name", "1a=1", []string{}, "1a=1", []string{}},
+    {"Quoted name", `"a"=1`, []string{}, "a=1", []string{}},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      tokens, err := lexer.NewLexer(test.line).Lex()
+      if err != nil {
+        t.Fatalf("Lex(%q) failed: %v", test.line, err)
+      }
+      commands, err := ParseTokens(tokens)
+      if err != nil {
+        t.Fatalf("ParseTokens(%q) failed: %v", test.line, err)
+      }
+
+      command := commands[0]
+      assigns := make([]string, 0)
+      for _, assign := range command.Assigns {
+        assigns = append(assigns, assign.Name+"="+lexer.WordText(assign.Value))
+      }
+      if len(assigns) != len(test.assigns) {
+        t.Fatalf("%q assigns %q, expected %q", test.line, assigns, test.assigns)
+      }
+      for i := range assigns {
+        if assigns[i] != test.assigns[i] {
+          t.Errorf("%q assigns %q, expected %q", test.line, assigns, test.assigns)
+        }
+      }
+      if command.Name != test.command || len(command.Args) != len(test.args) || len(command.Words) != len(test.args)+min(len(test.command), 1) {
+        t.Errorf("%q runs %q %q (%d words), expected %q %q", test.line, command.Name, command.Args, len(command.Words), test.command, test.args)
+      }
+      for i := range test.args {
+        if command.Args[i] != test.args[i] {
+          t.Errorf("%q runs %q %q, expected %q %q", test.line, command.Name, command.Args, test.command, test.args)
+        }
+      }
+    })
+  }
+}
+
+func TestRedirectOp(t *testing.T) {
+  tests := []struct {
+    token  lexer.Token
+    op     string
+    fd     int
+  }{
+    {lexer.Token{Typ: lexer.Redirect, Literal: "stdin"}, "<", 0},
+    {lexer.Token{Typ: lexer.Redirect, Literal: "stdout"}, ">", 1},
+    {lexer.Token{Typ: lexer.Append, Literal: "stderr"}, ">>", 2},
+    {lexer.Token{Typ: lexer.Redirect, Literal: "3>"}, ">", 3},
+    {lexer.Token{Typ: lexer.Redirect, Literal: "2<"}, "<", 2},
+    {lexer.Token{Typ: lexer.Append, Literal: "10>>"}, ">>", 10},
+    {lexer.Token{Typ: lexer.Duplicate, Literal: "2>&"}, ">&", 2},
+    {lexer.Token{Typ: lexer.Duplicate, Literal: ">&"}, ">&", 1},
+    {lexer.Token{Typ: lexer.Duplicate, Literal: "<&"}, "<&", 0},
+  }
+
+  for _, test := range tests {
+    t.Run(test.token.Literal, func(t *testing.T) {
+      op, fd := redirectOp(test.token)
+      if op != test.op || fd != test.fd {
+        t.Errorf("redirectOp(%q) = %s, %d, expected %s, %d", test.token.Literal, op, fd, test.op, test.fd)
+      }
+    })
+  }
+}
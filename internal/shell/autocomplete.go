@@ -3,100 +3,155 @@ package shell
 import (
   "fmt"
   "strings"
-  "unicode"
+  "unicode/utf8"
   "os"
   "sort"
+  "sync"
+  "time"
 
   "github.com/cheesyhypocrisy/harsh/internal/executor"
 )
 
 type Autocomplete struct {
+  // mu is held while completing, which reads the shell's state, so the
+  // shell can render a prompt while a line is being read
+  mu sync.Mutex
   lastPos int
   tabCount int
   lastLine string
+  // prompt is redrawn after listing ambiguous completions
+  prompt string
+  // listings caches the files in each PATH directory
+  listings map[string]dirListing
 }
 
-func (a *Autocomplete) Do(line []rune, pos int) (newLine [][]rune, length int) {
-  if a.lastLine == string(line) && a.lastPos == pos {
-    a.tabCount = 1
-  } else {
-    a.tabCount = 0
-  }
+// dirListing is the names of the files in a directory as of its
+// modification time, which changes whenever one is added or removed
+type dirListing struct {
+  modTime time.Time
+  names []string
+}
 
-  a.lastLine = string(line)
-  a.lastPos = pos
-  start := pos
-  for start > 0 && !unicode.IsSpace(line[start-1]) {
-    start--
+// commandNames lists the files in a PATH directory, reading it again only
+// if it has been modified since the last time
+func (a *Autocomplete) commandNames(dir string) []string {
+  info, err := os.Stat(dir)
+  if err != nil {
+    return nil
+  }
+  if listing, ok := a.listings[dir]; ok && listing.modTime.Equal(info.ModTime()) {
+    return listing.names
   }
 
-  input := string(line[start:pos])
+  files, err := os.ReadDir(dir)
+  if err != nil {
+    return nil
+  }
+  names := make([]string, 0, len(files))
+  for _, file := range files {
+    if !file.IsDir() {
+      names = append(names, file.Name())
+    }
+  }
+  if a.listings == nil {
+    a.listings = make(map[string]dirListing)
+  }
+  a.listings[dir] = dirListing{modTime: info.ModTime(), names: names}
+  return names
+}
 
-  suggestions := [][]rune{}
-  builtins := []string{"exit", "echo", "type", "pwd", "cd"}
+// commandCompletions lists the builtins and the commands in PATH starting
+// with prefix
+func (a *Autocomplete) commandCompletions(prefix string) []completion {
+  builtins := []string{"exit", "echo", "type", "pwd", "cd", "history", "source", "eval", "printf", "read", "test", "pushd", "popd", "dirs", "command", "builtin", "hash", "exec"}
 
   commandsSet := make(map[string]bool)
   for _, builtin := range builtins {
     commandsSet[builtin] = true
   }
-  for _, dir := range executor.PathDirs { 
-    files, err := os.ReadDir(dir)
-    if err != nil {
-      continue
+  for _, dir := range executor.PathDirs {
+    for _, name := range a.commandNames(dir) {
+      commandsSet[name] = true
     }
-    for _, file := range files {
-      if !file.IsDir() {
-        commandsSet[file.Name()] = true
-      }
-    } 
   }
 
+  var completions []completion
   for command := range commandsSet {
-    if strings.HasPrefix(command, input) {
-      suggestions = append(suggestions, []rune(command[len(input):]+" "))
+    if strings.HasPrefix(command, prefix) {
+      completions = append(completions, completion{text: command, display: command})
     }
   }
+  return completions
+}
+
+// Do completes the word before the cursor as a command, a file or a
+// directory depending on where it is in the line. What it returns is added
+// after the cursor, escaped the way the word is quoted so far.
+func (a *Autocomplete) Do(line []rune, pos int) (newLine [][]rune, length int) {
+  a.mu.Lock()
+  defer a.mu.Unlock()
+  if a.lastLine == string(line) && a.lastPos == pos {
+    a.tabCount = 1
+  } else {
+    a.tabCount = 0
+  }
 
-  if len(suggestions) == 0 {
+  a.lastLine = string(line)
+  a.lastPos = pos
+  text := string(line[:pos])
+  word, ok := completionContext(text)
+  if !ok {
     fmt.Fprintf(os.Stdout, "\x07")
+    return [][]rune{}, 0
+  }
+  length = utf8.RuneCountInString(text[min(word.start, len(text)):])
+
+  var candidates []completion
+  switch word.kind {
+  case completeCommand:
+    candidates = a.commandCompletions(word.value)
+  case completeFile:
+    candidates = fileCompletions(word.value, false)
+  case completeDir:
+    candidates = fileCompletions(word.value, true)
   }
 
-  if len(suggestions) > 1 {
-    sort.Slice(suggestions, func(i, j int) bool {
-      return string(suggestions[i]) < string(suggestions[j])
-    })
+  if len(candidates) == 0 {
+    fmt.Fprintf(os.Stdout, "\x07")
+    return [][]rune{}, length
+  }
+  if len(candidates) == 1 {
+    rest := candidates[0].text[len(word.value):]
+    return [][]rune{[]rune(quoteCompletion(rest, word.quote) + completionEnd(candidates[0], word.quote))}, length
+  }
 
-    smallest := suggestions[0][:len(suggestions[0])-1]
-    isCommonPrefix := true
-    for i := 1; i < len(suggestions); i++ {
-      if !strings.HasPrefix(string(suggestions[i][:len(suggestions[i])-1]),string(smallest)) {
-        isCommonPrefix = false
-      }
-    }
-    if isCommonPrefix {
-      return [][]rune{smallest}, pos-start
-    }
+  sort.Slice(candidates, func(i, j int) bool {
+    return candidates[i].text < candidates[j].text
+  })
+  texts := make([]string, len(candidates))
+  for i, candidate := range candidates {
+    texts[i] = candidate.text
+  }
+  if prefix := commonPrefix(texts); len(prefix) > len(word.value) {
+    return [][]rune{[]rune(quoteCompletion(prefix[len(word.value):], word.quote))}, length
+  }
 
-    if a.tabCount == 0 {
-      a.tabCount++
-      fmt.Fprintf(os.Stdout, "\a")
-      return [][]rune{}, 0
-    } else if a.tabCount == 1 {
-      a.tabCount = 0
-    }
+  if a.tabCount == 0 {
+    a.tabCount++
+    fmt.Fprintf(os.Stdout, "\a")
+    return [][]rune{}, 0
+  } else if a.tabCount == 1 {
+    a.tabCount = 0
+  }
 
-    fmt.Fprintf(os.Stdout,"\r\n")
-    for i, suggestion := range suggestions {
-      fmt.Fprintf(os.Stdout, "%s", input + string(suggestion))
-      if i != len(suggestions)-1 {
-        fmt.Fprintf(os.Stdout, " ")
-      }
+  fmt.Fprintf(os.Stdout,"\r\n")
+  for i, candidate := range candidates {
+    fmt.Fprintf(os.Stdout, "%s", candidate.display)
+    if i != len(candidates)-1 {
+      fmt.Fprintf(os.Stdout, " ")
     }
-    fmt.Printf("\n")
-    fmt.Printf("$ %s", string(line))
-    return [][]rune{}, 0 // Don't want suggestions to be tabbable hence handled above
   }
-
-  return suggestions, pos-start
+  fmt.Printf("\n")
+  fmt.Printf("%s%s", a.prompt, string(line))
+  return [][]rune{}, 0 // Don't want suggestions to be tabbable hence handled above
 }
-
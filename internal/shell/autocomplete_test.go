@@ -1,7 +1,11 @@
 package shell
 
 import (
+  "os"
+  "path/filepath"
+  "strings"
   "testing"
+  "time"
 
   "github.com/cheesyhypocrisy/harsh/internal/executor"
 )
@@ -70,3 +74,94 @@ func TestAutocomplete(t *testing.T) {
     })
   }
 }
+
+func TestAutocompleteCachesPathListing(t *testing.T) {
+  originalPathDirs := executor.PathDirs
+  defer func() { executor.PathDirs = originalPathDirs }()
+
+  dir := t.TempDir()
+  executor.PathDirs = []string{dir}
+  os.WriteFile(filepath.Join(dir, "harshcachefirst"), []byte{}, 0755)
+  modTime := time.Now().Add(-time.Hour)
+  os.Chtimes(dir, modTime, modTime)
+
+  autocomplete := &Autocomplete{}
+  complete := func() []string {
+    suggestions, _ := autocomplete.Do([]rune("harshcache"), len("harshcache"))
+    names := []string{}
+    for _, suggestion := range suggestions {
+      names = append(names, string(suggestion))
+    }
+    return names
+  }
+
+  if got := complete(); len(got) != 1 || got[0] != "first " {
+    t.Fatalf("Expected only harshcachefirst, got %q", got)
+  }
+
+  // A directory that looks unmodified isn't read again
+  os.WriteFile(filepath.Join(dir, "harshcachesecond"), []byte{}, 0755)
+  os.Chtimes(dir, modTime, modTime)
+  if got := complete(); len(got) != 1 {
+    t.Errorf("Expected the cached listing, got %q", got)
+  }
+
+  // Once its modification time changes it is
+  os.Chtimes(dir, time.Now(), time.Now())
+  autocomplete.lastLine = ""
+  if got := complete(); len(got) != 0 {
+    t.Errorf("Expected the two commands to be ambiguous, got %q", got)
+  }
+  if names := autocomplete.listings[dir].names; len(names) != 2 {
+    t.Errorf("Expected both commands in the listing, got %q", names)
+  }
+}
+
+func TestAutocompleteFiles(t *testing.T) {
+  cwd, _ := os.Getwd()
+  defer os.Chdir(cwd)
+  dir := t.TempDir()
+  os.Chdir(dir)
+  for _, name := range []string{"README.md", "My File.txt", ".hidden", "notes.txt", "notes.md"} {
+    os.WriteFile(filepath.Join(dir, name), []byte{}, 0644)
+  }
+  os.Mkdir(filepath.Join(dir, "src"), 0755)
+  os.Mkdir(filepath.Join(dir, ".git"), 0755)
+  os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte{}, 0644)
+  t.Setenv("HOME", dir)
+
+  tests := []struct {
+    name     string
+    line     string
+    expected []string
+  }{
+    {"File argument", "cat READ", []string{"ME.md "}},
+    {"Directory gets a slash", "ls s", []string{"rc/"}},
+    {"Inside a directory", "cat src/m", []string{"ain.go "}},
+    {"Escapes spaces", "cat My", []string{`\ File.txt `}},
+    {"Continues an escaped word", `cat My\ F`, []string{"ile.txt "}},
+    {"Closes an open quote", `cat "My`, []string{` File.txt" `}},
+    {"Common prefix", "cat no", []string{"tes."}},
+    {"Ambiguous", "cat notes.", []string{}},
+    {"Hidden only with a dot", "cat .h", []string{"idden "}},
+    {"No hidden files otherwise", "cat h", []string{}},
+    {"After a redirection", "echo hi > REA", []string{"DME.md "}},
+    {"cd takes directories only", "cd ", []string{"src/"}},
+    {"cd with a hidden prefix", "cd .g", []string{"it/"}},
+    {"Home directory", "cat ~/RE", []string{"ADME.md "}},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      autocomplete := &Autocomplete{}
+      suggestions, _ := autocomplete.Do([]rune(test.line), len([]rune(test.line)))
+      got := []string{}
+      for _, suggestion := range suggestions {
+        got = append(got, string(suggestion))
+      }
+      if strings.Join(got, "|") != strings.Join(test.expected, "|") {
+        t.Errorf("Do(%q) = %q, expected %q", test.line, got, test.expected)
+      }
+    })
+  }
+}
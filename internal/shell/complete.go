@@ -0,0 +1,214 @@
+package shell
+
+import (
+  "os"
+  "path/filepath"
+  "strings"
+  "unicode/utf8"
+
+  "github.com/cheesyhypocrisy/harsh/internal/lexer"
+)
+
+type completionKind int
+
+const (
+  completeCommand completionKind = iota
+  completeFile
+  // completeDir is for cd and pushd, which only take directories
+  completeDir
+)
+
+// completionWord is the word the cursor is at the end of: what it says
+// with quotes removed, where it starts in the line, the quote it leaves
+// open if any, and what kind of word goes there
+type completionWord struct {
+  value string
+  start int
+  quote byte
+  kind completionKind
+}
+
+// completion is a candidate for the word being completed, text being the
+// whole word unquoted and display what a listing shows of it
+type completion struct {
+  text, display string
+  dir bool
+}
+
+// completionContext lexes text, the line up to the cursor, to find the word
+// being completed. It's a command at the start of the line or after a pipe,
+// a file after a redirection or as an argument, and a directory as an
+// argument to cd or pushd. A quote still open at the cursor is closed for
+// the lexer's sake and remembered, so the completion stays inside it.
+func completionContext(text string) (completionWord, bool) {
+  var tokens []lexer.Token
+  word := completionWord{start: len(text)}
+  lexed := false
+  for _, quote := range []string{"", "\"", "'"} {
+    var err error
+    if tokens, err = lexer.NewLexer(text + quote).Lex(); err == nil {
+      if quote != "" {
+        word.quote = quote[0]
+      }
+      lexed = true
+      break
+    }
+  }
+  if !lexed {
+    return word, false
+  }
+
+  if n := len(tokens); n > 0 && tokens[n-1].Typ == lexer.LiteralStr {
+    word.value = tokens[n-1].Literal
+    word.start = tokens[n-1].Span.Start.Offset
+    tokens = tokens[:n-1]
+  }
+
+  previous := -1
+  for i := len(tokens) - 1; i >= 0 && previous < 0; i-- {
+    if tokens[i].Typ != lexer.Space {
+      previous = i
+    }
+  }
+  if previous >= 0 && isRedirection(tokens[previous]) {
+    word.kind = completeFile
+    return word, true
+  }
+
+  // The command is the first word since the last pipe that isn't an
+  // assignment or the target of a redirection
+  command := ""
+  for i := 0; i < len(tokens); i++ {
+    switch {
+    case tokens[i].Typ == lexer.Pipe:
+      command = ""
+    case isRedirection(tokens[i]):
+      for i+1 < len(tokens) && tokens[i+1].Typ == lexer.Space {
+        i++
+      }
+      i++
+    case tokens[i].Typ == lexer.LiteralStr && command == "" && !isAssignment(tokens[i].Literal):
+      command = tokens[i].Literal
+    }
+  }
+  switch {
+  case command == "" && !strings.Contains(word.value, "/"):
+    word.kind = completeCommand
+  case command == "cd" || command == "pushd":
+    word.kind = completeDir
+  default:
+    word.kind = completeFile
+  }
+  return word, true
+}
+
+func isRedirection(tok lexer.Token) bool {
+  return tok.Typ == lexer.Redirect || tok.Typ == lexer.Append || tok.Typ == lexer.Duplicate
+}
+
+// isAssignment tells whether word is a NAME=value prefix to a command
+func isAssignment(word string) bool {
+  name, _, ok := strings.Cut(word, "=")
+  if !ok || name == "" {
+    return false
+  }
+  for i, c := range name {
+    if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(i > 0 && c >= '0' && c <= '9') {
+      return false
+    }
+  }
+  return true
+}
+
+// fileCompletions lists the files whose path starts with value, only
+// directories if dirsOnly. Hidden files are left out unless the name typed
+// so far starts with a dot, and a leading ~/ stands for $HOME.
+func fileCompletions(value string, dirsOnly bool) []completion {
+  dir, base := "", value
+  if i := strings.LastIndexByte(value, '/'); i >= 0 {
+    dir, base = value[:i+1], value[i+1:]
+  }
+  lookup := dir
+  if lookup == "" {
+    lookup = "."
+  } else if strings.HasPrefix(lookup, "~/") {
+    lookup = filepath.Join(os.Getenv("HOME"), lookup[2:])
+  }
+
+  entries, err := os.ReadDir(lookup)
+  if err != nil {
+    return nil
+  }
+  var completions []completion
+  for _, entry := range entries {
+    name := entry.Name()
+    if !strings.HasPrefix(name, base) || (name[0] == '.' && !strings.HasPrefix(base, ".")) {
+      continue
+    }
+    isDir := entry.IsDir()
+    if entry.Type()&os.ModeSymlink != 0 {
+      info, err := os.Stat(filepath.Join(lookup, name))
+      isDir = err == nil && info.IsDir()
+    }
+    if dirsOnly && !isDir {
+      continue
+    }
+    display := name
+    if isDir {
+      display += "/"
+    }
+    completions = append(completions, completion{text: dir + name, display: display, dir: isDir})
+  }
+  return completions
+}
+
+// quoteCompletion escapes s, the rest of a word being completed, for the
+// lexer to read it back as it is: inside the quote left open, or else with
+// a backslash before every character special to the shell
+func quoteCompletion(s string, quote byte) string {
+  var out strings.Builder
+  for _, r := range s {
+    switch {
+    case quote == '\'' && r == '\'':
+      out.WriteString(`'\''`)
+    case quote == '"' && strings.ContainsRune("\"\\$`", r):
+      out.WriteByte('\\')
+      out.WriteRune(r)
+    case quote == 0 && strings.ContainsRune(" \t\n\\'\"$`|&;<>()*?[]{}!#~", r):
+      out.WriteByte('\\')
+      out.WriteRune(r)
+    default:
+      out.WriteRune(r)
+    }
+  }
+  return out.String()
+}
+
+// completionEnd is what follows a word completed in full: a slash after a
+// directory, to go on into it, otherwise the closing quote if one is open
+// and a space
+func completionEnd(c completion, quote byte) string {
+  if c.dir {
+    return "/"
+  }
+  if quote != 0 {
+    return string(quote) + " "
+  }
+  return " "
+}
+
+// commonPrefix is the longest prefix, in whole runes, of all of texts
+func commonPrefix(texts []string) string {
+  prefix := texts[0]
+  for _, text := range texts[1:] {
+    n := 0
+    for n < len(prefix) && n < len(text) && prefix[n] == text[n] {
+      n++
+    }
+    for n > 0 && n < len(prefix) && !utf8.RuneStart(prefix[n]) {
+      n--
+    }
+    prefix = prefix[:n]
+  }
+  return prefix
+}
@@ -0,0 +1,64 @@
+package shell
+
+import (
+  "testing"
+)
+
+func TestCompletionContext(t *testing.T) {
+  tests := []struct {
+    name  string
+    text  string
+    value string
+    start int
+    quote byte
+    kind  completionKind
+  }{
+    {"Empty line", "", "", 0, 0, completeCommand},
+    {"Command", "ec", "ec", 0, 0, completeCommand},
+    {"Argument", "cat READ", "READ", 4, 0, completeFile},
+    {"New argument", "cat ", "", 4, 0, completeFile},
+    {"After pipe", "cat x | gr", "gr", 8, 0, completeCommand},
+    {"After pipe without space", "cat x |gr", "gr", 7, 0, completeCommand},
+    {"After redirection", "echo hi > ou", "ou", 10, 0, completeFile},
+    {"Attached to redirection", "echo hi 2>>lo", "lo", 11, 0, completeFile},
+    {"Redirection before command", "<in.txt so", "so", 8, 0, completeCommand},
+    {"Command after redirection target", "< in.txt sort RE", "RE", 14, 0, completeFile},
+    {"Assignment before command", "LANG=C ls", "ls", 7, 0, completeCommand},
+    {"Path as command", "./scr", "./scr", 0, 0, completeFile},
+    {"cd takes directories", "cd sr", "sr", 3, 0, completeDir},
+    {"pushd takes directories", "pushd ", "", 6, 0, completeDir},
+    {"Escaped space", `cat My\ Fi`, "My Fi", 4, 0, completeFile},
+    {"Open double quote", `cat "My Fi`, "My Fi", 4, '"', completeFile},
+    {"Open single quote", `cat 'My Fi`, "My Fi", 4, '\'', completeFile},
+    {"Closed quote", `cat "My File" `, "", 14, 0, completeFile},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      word, ok := completionContext(test.text)
+      if !ok || word.value != test.value || word.start != test.start || word.quote != test.quote || word.kind != test.kind {
+        t.Errorf("completionContext(%q) = %+v, %v, expected value %q start %d quote %q kind %d", test.text, word, ok, test.value, test.start, test.quote, test.kind)
+      }
+    })
+  }
+}
+
+func TestQuoteCompletion(t *testing.T) {
+  tests := []struct {
+    s        string
+    quote    byte
+    expected string
+  }{
+    {"plain.txt", 0, "plain.txt"},
+    {"My File (1).txt", 0, `My\ File\ \(1\).txt`},
+    {"a$b&c", 0, `a\$b\&c`},
+    {`say "hi" $x`, '"', `say \"hi\" \$x`},
+    {"it's", '\'', `it'\''s`},
+  }
+
+  for _, test := range tests {
+    if result := quoteCompletion(test.s, test.quote); result != test.expected {
+      t.Errorf("quoteCompletion(%q, %q) = %q, expected %q", test.s, test.quote, result, test.expected)
+    }
+  }
+}
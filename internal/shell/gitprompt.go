@@ -0,0 +1,147 @@
+package shell
+
+import (
+  "context"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+)
+
+// gitStatusTimeout bounds the background `git status` used for the dirty
+// marker. A check that times out or fails leaves the marker as the last one
+// to finish found it, so a huge or wedged repository shows up as clean
+// until one does.
+var gitStatusTimeout = time.Second
+
+// gitDirty caches the dirty state per work tree. The prompt always renders
+// from the cache and schedules a refresh, it never waits for git.
+var gitDirty = struct {
+  sync.Mutex
+  state    map[string]bool
+  inFlight map[string]bool
+}{
+  state:    map[string]bool{},
+  inFlight: map[string]bool{},
+}
+
+// onGitDirtyChange is called from the background check when a work tree
+// flips between clean and dirty so the shell can redraw the prompt. It runs
+// on the check's goroutine, so it only asks for the redraw.
+var onGitDirtyChange func()
+
+// findGitDir walks up from dir looking for a .git directory, or a .git file
+// pointing elsewhere as used by worktrees and submodules. It returns the
+// work tree root and the git directory.
+func findGitDir(dir string) (string, string) {
+  for {
+    candidate := filepath.Join(dir, ".git")
+    if info, err := os.Stat(candidate); err == nil {
+      if info.IsDir() {
+        return dir, candidate
+      }
+      content, err := os.ReadFile(candidate)
+      if err == nil && strings.HasPrefix(string(content), "gitdir:") {
+        gitDir := strings.TrimSpace(strings.TrimPrefix(string(content), "gitdir:"))
+        if !filepath.IsAbs(gitDir) {
+          gitDir = filepath.Join(dir, gitDir)
+        }
+        return dir, gitDir
+      }
+    }
+
+    parent := filepath.Dir(dir)
+    if parent == dir {
+      return "", ""
+    }
+    dir = parent
+  }
+}
+
+// gitBranch reads the current branch straight from HEAD, falling back to the
+// abbreviated commit for a detached HEAD. Outside a repository it is "".
+func gitBranch() string {
+  cwd, err := os.Getwd()
+  if err != nil {
+    return ""
+  }
+  _, gitDir := findGitDir(cwd)
+  if gitDir == "" {
+    return ""
+  }
+
+  head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+  if err != nil {
+    return ""
+  }
+  ref := strings.TrimSpace(string(head))
+  if strings.HasPrefix(ref, "ref: ") {
+    ref = strings.TrimPrefix(ref, "ref: ")
+    return strings.TrimPrefix(ref, "refs/heads/")
+  }
+  if len(ref) > 7 {
+    return ref[:7]
+  }
+  return ref
+}
+
+// gitDirtyMarker returns "*" if the work tree was dirty the last time it was
+// checked and kicks off a new check in the background
+func gitDirtyMarker() string {
+  cwd, err := os.Getwd()
+  if err != nil {
+    return ""
+  }
+  root, _ := findGitDir(cwd)
+  if root == "" {
+    return ""
+  }
+
+  gitDirty.Lock()
+  dirty := gitDirty.state[root]
+  if !gitDirty.inFlight[root] {
+    gitDirty.inFlight[root] = true
+    go refreshGitDirty(root)
+  }
+  gitDirty.Unlock()
+
+  if dirty {
+    return "*"
+  }
+  return ""
+}
+
+func refreshGitDirty(root string) {
+  ctx, cancel := context.WithTimeout(context.Background(), gitStatusTimeout)
+  defer cancel()
+
+  cmd := exec.CommandContext(ctx, "git", "status", "--porcelain", "--untracked-files=no")
+  cmd.Dir = root
+  out, err := cmd.Output()
+
+  gitDirty.Lock()
+  previous := gitDirty.state[root]
+  dirty := previous
+  if err == nil {
+    dirty = len(strings.TrimSpace(string(out))) > 0
+    gitDirty.state[root] = dirty
+  }
+  delete(gitDirty.inFlight, root)
+  gitDirty.Unlock()
+
+  if dirty != previous && onGitDirtyChange != nil {
+    onGitDirtyChange()
+  }
+}
+
+// exitStatusSegment shows $? in green when it is zero and red otherwise
+func exitStatusSegment(status int) string {
+  color := "\033[32m"
+  if status != 0 {
+    color = "\033[31m"
+  }
+  return color + strconv.Itoa(status) + "\033[0m"
+}
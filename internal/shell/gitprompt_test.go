@@ -0,0 +1,109 @@
+package shell
+
+import (
+  "os"
+  "os/exec"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func TestGitBranch(t *testing.T) {
+  cwd, _ := os.Getwd()
+  defer os.Chdir(cwd)
+
+  tests := []struct {
+    name     string
+    head     string
+    expected string
+  }{
+    {"Branch", "ref: refs/heads/main\n", "main"},
+    {"Branch with slash", "ref: refs/heads/feature/prompt\n", "feature/prompt"},
+    {"Detached HEAD", "3a059bb0c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6\n", "3a059bb"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      root := t.TempDir()
+      os.MkdirAll(filepath.Join(root, ".git"), 0755)
+      os.WriteFile(filepath.Join(root, ".git", "HEAD"), []byte(test.head), 0644)
+      sub := filepath.Join(root, "a", "b")
+      os.MkdirAll(sub, 0755)
+      os.Chdir(sub)
+
+      if branch := gitBranch(); branch != test.expected {
+        t.Errorf("Expected branch %q, got %q", test.expected, branch)
+      }
+    })
+  }
+
+  t.Run("Gitdir file", func(t *testing.T) {
+    root := t.TempDir()
+    real := filepath.Join(root, "real")
+    os.MkdirAll(real, 0755)
+    os.WriteFile(filepath.Join(real, "HEAD"), []byte("ref: refs/heads/linked\n"), 0644)
+    tree := filepath.Join(root, "tree")
+    os.MkdirAll(tree, 0755)
+    os.WriteFile(filepath.Join(tree, ".git"), []byte("gitdir: ../real\n"), 0644)
+    os.Chdir(tree)
+
+    if branch := gitBranch(); branch != "linked" {
+      t.Errorf("Expected branch %q, got %q", "linked", branch)
+    }
+  })
+
+  t.Run("Outside a repository", func(t *testing.T) {
+    os.Chdir(t.TempDir())
+    if branch := gitBranch(); branch != "" {
+      t.Errorf("Expected no branch, got %q", branch)
+    }
+  })
+}
+
+func TestGitDirtyMarker(t *testing.T) {
+  if _, err := exec.LookPath("git"); err != nil {
+    t.Skip("git not available")
+  }
+  cwd, _ := os.Getwd()
+  defer os.Chdir(cwd)
+
+  root := t.TempDir()
+  os.Chdir(root)
+  for _, args := range [][]string{
+    {"init", "-q"},
+    {"-c", "user.name=t", "-c", "user.email=t@t", "commit", "-q", "--allow-empty", "-m", "init"},
+  } {
+    if err := exec.Command("git", args...).Run(); err != nil {
+      t.Skipf("git %v failed: %v", args, err)
+    }
+  }
+  os.WriteFile(filepath.Join(root, "file"), []byte("a"), 0644)
+  exec.Command("git", "add", "file").Run()
+
+  changed := make(chan struct{}, 1)
+  onGitDirtyChange = func() { changed <- struct{}{} }
+  defer func() { onGitDirtyChange = nil }()
+
+  if marker := gitDirtyMarker(); marker != "" {
+    t.Errorf("Expected first render to use the empty cache, got %q", marker)
+  }
+
+  select {
+  case <-changed:
+  case <-time.After(5 * time.Second):
+    t.Fatal("Background dirty check never reported")
+  }
+
+  if marker := gitDirtyMarker(); marker != "*" {
+    t.Errorf("Expected dirty marker, got %q", marker)
+  }
+}
+
+func TestExitStatusSegment(t *testing.T) {
+  if segment := exitStatusSegment(0); segment != "\033[32m0\033[0m" {
+    t.Errorf("Unexpected success segment %q", segment)
+  }
+  if segment := exitStatusSegment(127); segment != "\033[31m127\033[0m" {
+    t.Errorf("Unexpected failure segment %q", segment)
+  }
+}
@@ -0,0 +1,276 @@
+package shell
+
+import (
+  "fmt"
+  "io"
+  "math"
+  "os"
+  "sort"
+  "strings"
+  "time"
+  "unicode"
+
+  "github.com/cheesyhypocrisy/harsh/internal/executor"
+  "github.com/chzyer/readline"
+)
+
+// pickerKey, Ctrl-X, opens the history picker
+const pickerKey rune = 24
+
+// dirBoost is how much more a use of a line counts in the picker's ranking
+// when it was in the current directory
+const dirBoost = 4
+
+// historyPicker is a full screen list of the distinct lines in the history,
+// narrowed by fuzzy matching what's typed and ranked by frecency: how often
+// a line was used, each use counting less the longer ago it was and more if
+// it was in the current directory. The best match is at the bottom, next
+// to the query, as in fzf.
+type historyPicker struct {
+  out io.Writer
+  width, height int
+  candidates []historyCandidate
+  matches []pickerMatch
+  query []rune
+  // selected is the index in matches of the highlighted line, and offset
+  // that of the first one on screen
+  selected, offset int
+}
+
+// historyCandidate is a distinct history line and what ranks it
+type historyCandidate struct {
+  line string
+  frecency float64
+  // last is the index in the history of its latest use, to break ties
+  last int
+}
+
+type pickerMatch struct {
+  candidate *historyCandidate
+  score float64
+  // positions are the rune offsets of the matched characters
+  positions []int
+}
+
+func newHistoryPicker(out io.Writer, width, height int) *historyPicker {
+  dir, _ := executor.WorkingDir()
+  p := &historyPicker{
+    out: out,
+    width: width,
+    height: height,
+    candidates: historyCandidates(executor.Hist, dir, time.Now()),
+  }
+  p.filter()
+  return p
+}
+
+// terminalSize is the size the picker fills, with a fallback for when the
+// terminal won't say
+func terminalSize() (int, int) {
+  width, height, err := readline.GetSize(int(os.Stdout.Fd()))
+  if err != nil || width <= 0 || height <= 0 {
+    return 80, 24
+  }
+  return width, height
+}
+
+// historyCandidates gathers the distinct lines of hist with their frecency
+// as of now, uses in dir counting dirBoost times as much
+func historyCandidates(hist []executor.HistEntry, dir string, now time.Time) []historyCandidate {
+  var candidates []historyCandidate
+  index := map[string]int{}
+  for i, entry := range hist {
+    weight := recencyWeight(entry.Time, now)
+    if dir != "" && entry.Dir == dir {
+      weight *= dirBoost
+    }
+    k, ok := index[entry.Line]
+    if !ok {
+      k = len(candidates)
+      index[entry.Line] = k
+      candidates = append(candidates, historyCandidate{line: entry.Line})
+    }
+    candidates[k].frecency += weight
+    candidates[k].last = i
+  }
+  return candidates
+}
+
+// recencyWeight is what one use at t adds to a line's frecency, the most
+// within the hour and the least after a month or when t isn't known
+func recencyWeight(t time.Time, now time.Time) float64 {
+  age := now.Sub(t)
+  switch {
+  case t.IsZero():
+    return 0.25
+  case age < time.Hour:
+    return 4
+  case age < 24*time.Hour:
+    return 2
+  case age < 7*24*time.Hour:
+    return 1
+  case age < 30*24*time.Hour:
+    return 0.5
+  }
+  return 0.25
+}
+
+// filter matches the candidates against the query and ranks the matches.
+// With no query they go by frecency alone; otherwise the quality of the
+// match counts most and frecency adds to it, so a line used a lot wins
+// over an equally good match used once.
+func (p *historyPicker) filter() {
+  p.matches = p.matches[:0]
+  for i := range p.candidates {
+    candidate := &p.candidates[i]
+    score, positions, ok := fuzzyMatch([]rune(candidate.line), p.query)
+    if !ok {
+      continue
+    }
+    rank := candidate.frecency
+    if len(p.query) > 0 {
+      rank = float64(score) + 8*math.Log2(1+candidate.frecency)
+    }
+    p.matches = append(p.matches, pickerMatch{candidate, rank, positions})
+  }
+  sort.SliceStable(p.matches, func(i, j int) bool {
+    if p.matches[i].score != p.matches[j].score {
+      return p.matches[i].score > p.matches[j].score
+    }
+    return p.matches[i].candidate.last > p.matches[j].candidate.last
+  })
+  p.selected, p.offset = 0, 0
+}
+
+// move moves the selection by delta, up being towards worse matches
+func (p *historyPicker) move(delta int) {
+  p.selected = max(0, min(p.selected+delta, len(p.matches)-1))
+}
+
+// choice is the selected line, if anything matches
+func (p *historyPicker) choice() (string, bool) {
+  if len(p.matches) == 0 {
+    return "", false
+  }
+  return p.matches[p.selected].candidate.line, true
+}
+
+// render draws the list with the best match at the bottom, above a line
+// counting the matches, and leaves the cursor on the last line for the
+// line editor to show the query there
+func (p *historyPicker) render() {
+  rows := max(1, p.height-2)
+  if p.selected < p.offset {
+    p.offset = p.selected
+  } else if p.selected >= p.offset+rows {
+    p.offset = p.selected - rows + 1
+  }
+
+  var out strings.Builder
+  out.WriteString("\033[H\033[J")
+  for row := rows - 1; row >= 0; row-- {
+    i := p.offset + row
+    if i < len(p.matches) {
+      p.renderMatch(&out, i)
+    }
+    out.WriteString("\r\n")
+  }
+  fmt.Fprintf(&out, "  %d/%d\r\n", len(p.matches), len(p.candidates))
+  fmt.Fprintf(&out, "\033[%d;1H", p.height)
+  io.WriteString(p.out, out.String())
+}
+
+// renderMatch draws a line of the list, cut to the width of the screen,
+// its matched characters highlighted
+func (p *historyPicker) renderMatch(out *strings.Builder, i int) {
+  match := p.matches[i]
+  if i == p.selected {
+    out.WriteString("\033[1m> ")
+  } else {
+    out.WriteString("  ")
+  }
+  width := 2
+  next := 0
+  for k, r := range []rune(match.candidate.line) {
+    if unicode.IsControl(r) {
+      r = ' '
+    }
+    width += readline.Runes{}.Width(r)
+    if width > p.width-1 {
+      break
+    }
+    if next < len(match.positions) && match.positions[next] == k {
+      fmt.Fprintf(out, "\033[32m%c\033[39m", r)
+      next++
+    } else {
+      out.WriteRune(r)
+    }
+  }
+  out.WriteString("\033[0m")
+}
+
+// fuzzyMatch tells whether the runes of query appear in line in order, and
+// if so scores the tightest such match: every matched character counts,
+// more so at the start of a word or right after the previous one, and
+// each character skipped in between takes a little off. The match ignores
+// case unless the query has capitals, and an empty query matches anything.
+func fuzzyMatch(line, query []rune) (int, []int, bool) {
+  if len(query) == 0 {
+    return 0, nil, true
+  }
+  foldCase := true
+  for _, r := range query {
+    if unicode.IsUpper(r) {
+      foldCase = false
+    }
+  }
+  equal := func(a, b rune) bool {
+    if foldCase {
+      return unicode.ToLower(a) == b
+    }
+    return a == b
+  }
+
+  // Find where the first match ends, then go back from there for the
+  // latest start, which gives the shortest match ending there
+  q, end := 0, -1
+  for i, r := range line {
+    if equal(r, query[q]) {
+      if q++; q == len(query) {
+        end = i
+        break
+      }
+    }
+  }
+  if end < 0 {
+    return 0, nil, false
+  }
+  positions := make([]int, len(query))
+  q = len(query) - 1
+  for i := end; q >= 0; i-- {
+    if equal(line[i], query[q]) {
+      positions[q] = i
+      q--
+    }
+  }
+
+  score := 0
+  for k, i := range positions {
+    score += 16
+    if i == 0 || !isWordRune(line[i-1]) {
+      score += 8
+    }
+    if k > 0 {
+      if gap := i - positions[k-1] - 1; gap == 0 {
+        score += 8
+      } else {
+        score -= min(gap, 8)
+      }
+    }
+  }
+  return score, positions, true
+}
+
+func isWordRune(r rune) bool {
+  return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,118 @@
+package shell
+
+import (
+  "io"
+  "reflect"
+  "testing"
+  "time"
+
+  "github.com/cheesyhypocrisy/harsh/internal/executor"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+  tests := []struct {
+    name      string
+    line      string
+    query     string
+    ok        bool
+    positions []int
+  }{
+    {"Empty query", "ls", "", true, nil},
+    {"Subsequence", "git status", "gst", true, []int{0, 4, 5}},
+    {"Tightest match", "my make", "mk", true, []int{3, 5}},
+    {"Ignores case", "Makefile", "mak", true, []int{0, 1, 2}},
+    {"Capitals match exactly", "makefile", "Mak", false, nil},
+    {"Out of order", "git status", "tsg", false, nil},
+    {"Unicode", "echo héllo", "hé", true, []int{5, 6}},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      _, positions, ok := fuzzyMatch([]rune(test.line), []rune(test.query))
+      if ok != test.ok || !reflect.DeepEqual(positions, test.positions) {
+        t.Errorf("fuzzyMatch(%q, %q) = %v, %v, expected %v, %v", test.line, test.query, positions, ok, test.positions, test.ok)
+      }
+    })
+  }
+}
+
+func TestFuzzyMatchScores(t *testing.T) {
+  score := func(line, query string) int {
+    s, _, _ := fuzzyMatch([]rune(line), []rune(query))
+    return s
+  }
+  if score("git status", "gs") <= score("cargo ls", "gs") {
+    t.Errorf("word starts should score higher than a gap inside words")
+  }
+  if score("git stash", "sta") <= score("set -a", "sta") {
+    t.Errorf("consecutive characters should score higher than scattered ones")
+  }
+}
+
+func TestHistoryCandidates(t *testing.T) {
+  now := time.Now()
+  hist := []executor.HistEntry{
+    {Line: "make", Time: now.Add(-48 * time.Hour), Dir: "/src"},
+    {Line: "ls", Time: now.Add(-time.Minute), Dir: "/tmp"},
+    {Line: "make", Time: now.Add(-time.Minute), Dir: "/tmp"},
+    {Line: "old"},
+  }
+
+  candidates := historyCandidates(hist, "/src", now)
+  expected := []historyCandidate{
+    {line: "make", frecency: 1*dirBoost + 4, last: 2},
+    {line: "ls", frecency: 4, last: 1},
+    {line: "old", frecency: 0.25, last: 3},
+  }
+  if !reflect.DeepEqual(candidates, expected) {
+    t.Errorf("historyCandidates = %+v, expected %+v", candidates, expected)
+  }
+}
+
+func TestHistoryPicker(t *testing.T) {
+  setHistory(t, "git status", "make test", "git stash", "make test", "git status")
+  executor.Hist[0].Time = time.Now()
+
+  tests := []struct {
+    name string
+    keys string
+    line string
+  }{
+    {"Most frecent first", "\r", "git status"},
+    {"Fuzzy query", "gsh\r", "git stash"},
+    {"Matches across words", "mt\r", "make test"},
+    {"Up moves to worse matches", "git\x10\r", "git stash"},
+    {"Up stops at the last match", "git\x10\x10\r", "git stash"},
+    {"Down moves back", "git\x10\x0e\r", "git status"},
+    {"Backspace widens", "gsh\x7f\x7f\x7fmake\r", "make test"},
+    {"No match keeps the line", "zzz\r", "draft"},
+    {"Cancel", "make\x07", "draft"},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      search := &historySearch{
+        setPrompt: func(string) {},
+        out: io.Discard,
+        size: func() (int, int) { return 40, 10 },
+      }
+      search.reset("$ ")
+      search.OnChange([]rune("draft"), 5, 't')
+
+      line := []rune("draft")
+      for _, key := range string(pickerKey) + test.keys {
+        if r, _ := search.filter(key); r == searchKey {
+          if newLine, _, ok := search.OnChange(line, 0, r); ok {
+            line = newLine
+          }
+        }
+      }
+      if search.picker != nil {
+        t.Fatalf("picker still open after %q", test.keys)
+      }
+      if string(line) != test.line {
+        t.Errorf("picking with %q gave %q, expected %q", test.keys, string(line), test.line)
+      }
+    })
+  }
+}
@@ -0,0 +1,348 @@
+package shell
+
+import (
+  "fmt"
+  "io"
+  "slices"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "unicode/utf8"
+
+  "github.com/cheesyhypocrisy/harsh/internal/executor"
+  "github.com/chzyer/readline"
+)
+
+// historyEditor is the part of the line editor that keeps its history
+type historyEditor interface {
+  ResetHistory()
+  SaveHistory(content string) error
+}
+
+// editorHistory is what the line editor has been given of executor.Hist,
+// for Up and Down to recall
+type editorHistory struct {
+  lines []string
+}
+
+// sync brings the editor's history up to date with executor.Hist before a
+// line is read. New entries are just added; any other change, like history
+// -c or -d, reloads the lot.
+func (h *editorHistory) sync(editor historyEditor) {
+  appended := len(executor.Hist) >= len(h.lines)
+  for i := 0; appended && i < len(h.lines); i++ {
+    appended = executor.Hist[i].Line == h.lines[i]
+  }
+  if !appended {
+    editor.ResetHistory()
+    h.lines = nil
+  } else if len(h.lines) > 0 {
+    // An empty line only takes the editor back to the end of its history,
+    // where it would be after a line it saved itself
+    editor.SaveHistory("")
+  }
+  for _, entry := range executor.Hist[len(h.lines):] {
+    editor.SaveHistory(entry.Line)
+    h.lines = append(h.lines, entry.Line)
+  }
+}
+
+// searchKey stands in for the keys the history search consumes. The line
+// editor inserts it like any other character, then the search's listener
+// replaces the whole line with the match.
+const searchKey = '\uE000'
+
+// historySearch is the incremental search through executor.Hist, started
+// backwards by Ctrl-R and forwards by Ctrl-S. Typing narrows it, Ctrl-R and
+// Ctrl-S again move to the next match and Ctrl-G goes back to the line as
+// it was. Any other key ends the search on the match and then does what it
+// usually does, so Enter runs it. Ctrl-X opens the fuzzy history picker
+// instead, which puts the line chosen there on the command line.
+type historySearch struct {
+  mu sync.Mutex
+  active, forward, failing bool
+  query, lastQuery []rune
+  // entry is the index in executor.Hist of the match and at the rune
+  // offset of the query in it
+  entry, at int
+  // line and pos are what the editor shows, saved and savedPos what it
+  // showed when the search started
+  line, saved []rune
+  pos, savedPos int
+  // prompt is the one to show once the search is over
+  prompt string
+  setPrompt func(string)
+  // picker is the history picker while it's open, drawn on out and sized
+  // by size
+  picker *historyPicker
+  out io.Writer
+  size func() (int, int)
+  // match is what Paint highlights. It's kept out of mu's way because the
+  // line editor paints holding its own lock, which setPrompt takes.
+  match atomic.Pointer[searchMatch]
+}
+
+// searchMatch is the query and where it is in the line shown
+type searchMatch struct {
+  at int
+  query []rune
+}
+
+// reset starts tracking a new line being read with prompt
+func (s *historySearch) reset(prompt string) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.active = false
+  s.line, s.pos = nil, 0
+  s.prompt = prompt
+  s.showMatch(prompt)
+}
+
+// changePrompt swaps the prompt in the middle of reading a line, which
+// waits for the end of a search
+func (s *historySearch) changePrompt(prompt string) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.prompt = prompt
+  if !s.active && s.picker == nil {
+    s.showMatch(prompt)
+  }
+}
+
+// filter sees each key before the line editor does, returning the key to
+// process in its place
+func (s *historySearch) filter(r rune) (rune, bool) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+
+  if s.picker != nil {
+    return s.pick(r)
+  }
+  if !s.active && r == pickerKey {
+    s.openPicker()
+    return searchKey, true
+  }
+  if !s.active {
+    if r != readline.CharBckSearch && r != readline.CharFwdSearch {
+      return r, true
+    }
+    s.active, s.failing = true, false
+    s.forward = r == readline.CharFwdSearch
+    s.query = nil
+    s.saved, s.savedPos = s.line, s.pos
+    s.entry, s.at = len(executor.Hist), 0
+    s.showPrompt()
+    return searchKey, true
+  }
+
+  switch {
+  case r == readline.CharBckSearch || r == readline.CharFwdSearch:
+    s.forward = r == readline.CharFwdSearch
+    if len(s.query) == 0 {
+      // Repeating the search key straight away repeats the last search
+      s.query = append(s.query, s.lastQuery...)
+      s.find(s.entry)
+    } else {
+      s.next()
+    }
+  case r == readline.CharBackspace || r == readline.CharCtrlH:
+    if len(s.query) > 0 {
+      s.query = s.query[:len(s.query)-1]
+      s.entry = len(executor.Hist)
+      s.find(len(executor.Hist) - 1)
+    }
+  case r == readline.CharBell:
+    s.line, s.pos = s.saved, s.savedPos
+    s.stop()
+    return searchKey, true
+  case r >= ' ' && r != readline.CharBackspace && r != searchKey:
+    s.query = append(s.query, r)
+    s.find(min(s.entry, len(executor.Hist)-1))
+  default:
+    s.stop()
+    return r, true
+  }
+  s.showPrompt()
+  return searchKey, true
+}
+
+// find moves to the first match from entry start on in the search's
+// direction, or marks the search failing, keeping the last match shown
+func (s *historySearch) find(start int) {
+  if len(s.query) == 0 {
+    s.failing = false
+    return
+  }
+  entry, at := findHistory(executor.Hist, string(s.query), start, s.forward)
+  if entry < 0 {
+    s.failing = true
+    return
+  }
+  s.failing = false
+  s.entry, s.at = entry, at
+  s.line = []rune(executor.Hist[entry].Line)
+  s.pos = at
+  s.lastQuery = append(s.lastQuery[:0], s.query...)
+}
+
+// next moves past the current match to the following one that isn't the
+// same line again
+func (s *historySearch) next() {
+  step := -1
+  if s.forward {
+    step = 1
+  }
+  current := string(s.line)
+  for start := s.entry + step; ; {
+    entry, _ := findHistory(executor.Hist, string(s.query), start, s.forward)
+    if entry < 0 || executor.Hist[entry].Line != current {
+      s.find(start)
+      return
+    }
+    start = entry + step
+  }
+}
+
+// openPicker switches to the alternate screen for the history picker,
+// emptying the command line while it's open
+func (s *historySearch) openPicker() {
+  s.saved, s.savedPos = s.line, s.pos
+  s.line, s.pos = nil, 0
+  io.WriteString(s.out, "\033[?1049h")
+  width, height := s.size()
+  s.picker = newHistoryPicker(s.out, width, height)
+  s.showPicker()
+}
+
+// pick handles a key while the picker is open. Up and Down move the
+// selection, typing narrows it, Enter takes the selected line and Ctrl-G
+// or Ctrl-C leave the command line as it was.
+func (s *historySearch) pick(r rune) (rune, bool) {
+  p := s.picker
+  switch r {
+  case readline.CharEnter, readline.CharCtrlJ:
+    if line, ok := p.choice(); ok {
+      s.line, s.pos = []rune(line), len([]rune(line))
+    } else {
+      s.line, s.pos = s.saved, s.savedPos
+    }
+    s.closePicker()
+    return searchKey, true
+  case readline.CharBell, readline.CharInterrupt:
+    s.line, s.pos = s.saved, s.savedPos
+    s.closePicker()
+    return searchKey, true
+  case readline.CharPrev, readline.CharBckSearch:
+    p.move(1)
+  case readline.CharNext, readline.CharFwdSearch:
+    p.move(-1)
+  case readline.CharBackspace, readline.CharCtrlH:
+    if len(p.query) > 0 {
+      p.query = p.query[:len(p.query)-1]
+      p.filter()
+    }
+  case readline.CharCtrlU:
+    p.query = nil
+    p.filter()
+  default:
+    if r < ' ' || r == readline.CharBackspace || r == searchKey {
+      return r, false
+    }
+    p.query = append(p.query, r)
+    p.filter()
+  }
+  s.showPicker()
+  return r, false
+}
+
+func (s *historySearch) showPicker() {
+  s.picker.render()
+  s.showMatch("> " + string(s.picker.query))
+}
+
+func (s *historySearch) closePicker() {
+  s.picker = nil
+  io.WriteString(s.out, "\033[?1049l")
+  s.showMatch(s.prompt)
+}
+
+func (s *historySearch) stop() {
+  s.active = false
+  s.showMatch(s.prompt)
+}
+
+func (s *historySearch) showPrompt() {
+  direction := "reverse-i-search"
+  if s.forward {
+    direction = "i-search"
+  }
+  if s.failing {
+    direction = "failing " + direction
+  }
+  s.showMatch(fmt.Sprintf("(%s)`%s': ", direction, string(s.query)))
+}
+
+// OnChange is the line editor's listener. It keeps track of the line, and
+// where the search consumed a key, puts the search's line in its place.
+func (s *historySearch) OnChange(line []rune, pos int, key rune) ([]rune, int, bool) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  if key == searchKey {
+    return s.line, s.pos, true
+  }
+  if !s.active {
+    s.line, s.pos = line, pos
+  }
+  return nil, 0, false
+}
+
+// showMatch shows prompt, with the current match published for Paint
+// first since that's when the editor repaints
+func (s *historySearch) showMatch(prompt string) {
+  if !s.active || len(s.query) == 0 {
+    s.match.Store(nil)
+  } else {
+    s.match.Store(&searchMatch{at: s.at, query: slices.Clone(s.query)})
+  }
+  s.setPrompt(prompt)
+}
+
+// Paint highlights the query in the match while searching
+func (s *historySearch) Paint(line []rune, pos int) []rune {
+  match := s.match.Load()
+  if match == nil {
+    return line
+  }
+  end := match.at + len(match.query)
+  if end > len(line) || string(line[match.at:end]) != string(match.query) {
+    return line
+  }
+  painted := make([]rune, 0, len(line)+8)
+  painted = append(painted, line[:match.at]...)
+  painted = append(painted, []rune("\033[7m")...)
+  painted = append(painted, line[match.at:end]...)
+  painted = append(painted, []rune("\033[0m")...)
+  return append(painted, line[end:]...)
+}
+
+// findHistory looks for query in hist from entry start towards older
+// entries, or newer ones if forward. It returns the entry it's in and the
+// rune offset of the match, the last one in the entry when going back, or
+// -1 if there is none.
+func findHistory(hist []executor.HistEntry, query string, start int, forward bool) (int, int) {
+  step := -1
+  if forward {
+    step = 1
+  }
+  for i := start; i >= 0 && i < len(hist); i += step {
+    line := hist[i].Line
+    index := strings.LastIndex(line, query)
+    if forward {
+      index = strings.Index(line, query)
+    }
+    if index >= 0 {
+      return i, utf8.RuneCountInString(line[:index])
+    }
+  }
+  return -1, 0
+}
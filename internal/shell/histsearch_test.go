@@ -0,0 +1,155 @@
+package shell
+
+import (
+  "strings"
+  "testing"
+
+  "github.com/cheesyhypocrisy/harsh/internal/executor"
+  "github.com/chzyer/readline"
+)
+
+func setHistory(t *testing.T, lines ...string) {
+  originalHist := executor.Hist
+  t.Cleanup(func() { executor.Hist = originalHist })
+  executor.Hist = nil
+  for _, line := range lines {
+    executor.Hist = append(executor.Hist, executor.HistEntry{Line: line})
+  }
+}
+
+// fakeEditor records what the line editor's history is told
+type fakeEditor struct {
+  calls []string
+}
+
+func (e *fakeEditor) ResetHistory() {
+  e.calls = append(e.calls, "reset")
+}
+
+func (e *fakeEditor) SaveHistory(content string) error {
+  e.calls = append(e.calls, "save "+content)
+  return nil
+}
+
+func TestEditorHistorySync(t *testing.T) {
+  setHistory(t, "a", "b")
+  var history editorHistory
+  editor := &fakeEditor{}
+
+  history.sync(editor)
+  executor.Hist = append(executor.Hist, executor.HistEntry{Line: "c"})
+  history.sync(editor)
+  history.sync(editor)
+  // Like history -d 1
+  executor.Hist = executor.Hist[1:]
+  history.sync(editor)
+
+  expected := "save a,save b,save ,save c,save ,reset,save b,save c"
+  if calls := strings.Join(editor.calls, ","); calls != expected {
+    t.Errorf("editor history calls = %q, expected %q", calls, expected)
+  }
+}
+
+func TestFindHistory(t *testing.T) {
+  hist := []executor.HistEntry{
+    {Line: "make test"},
+    {Line: "git status"},
+    {Line: "echo héllo héllo"},
+    {Line: "make build"},
+  }
+
+  tests := []struct {
+    name    string
+    query   string
+    start   int
+    forward bool
+    entry   int
+    at      int
+  }{
+    {"Newest first", "make", 3, false, 3, 0},
+    {"From start", "make", 2, false, 0, 0},
+    {"Forward", "make", 1, true, 3, 0},
+    {"Last in line going back", "héllo", 3, false, 2, 11},
+    {"First in line going forward", "héllo", 0, true, 2, 5},
+    {"Not found", "nope", 3, false, -1, 0},
+    {"Start out of range", "make", 4, true, -1, 0},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      entry, at := findHistory(hist, test.query, test.start, test.forward)
+      if entry != test.entry || at != test.at {
+        t.Errorf("findHistory(%q, %d, %v) = %d, %d, expected %d, %d", test.query, test.start, test.forward, entry, at, test.entry, test.at)
+      }
+    })
+  }
+}
+
+func TestHistorySearch(t *testing.T) {
+  setHistory(t, "make test", "git status", "make build", "make build")
+
+  tests := []struct {
+    name   string
+    keys   string
+    line   string
+    prompt string
+  }{
+    {"Narrowing", "\x12mak", "make build", "(reverse-i-search)`mak': "},
+    {"Next skips duplicates", "\x12mak\x12", "make test", "(reverse-i-search)`mak': "},
+    {"Failing keeps match", "\x12mak\x12\x12", "make test", "(failing reverse-i-search)`mak': "},
+    {"Backspace searches again", "\x12git\x7f\x7f\x7fma", "make build", "(reverse-i-search)`ma': "},
+    {"Forward", "\x12mak\x12\x13", "make build", "(i-search)`mak': "},
+    {"Cancel", "\x12git\x07", "draft", "$ "},
+    {"Other key ends search", "\x12git\x05", "git status", "$ "},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      prompt := ""
+      search := &historySearch{setPrompt: func(p string) { prompt = p }}
+      search.reset("$ ")
+      line := []rune(nil)
+      pos := 0
+      for _, r := range "draft" {
+        line = append(line, r)
+        pos++
+        search.OnChange(line, pos, r)
+      }
+
+      for _, key := range test.keys {
+        r, _ := search.filter(key)
+        if r != searchKey {
+          continue
+        }
+        if newLine, newPos, ok := search.OnChange(line, pos, r); ok {
+          line, pos = newLine, newPos
+        }
+      }
+      if string(line) != test.line || prompt != test.prompt {
+        t.Errorf("after %q line is %q with prompt %q, expected %q with %q", test.keys, string(line), prompt, test.line, test.prompt)
+      }
+    })
+  }
+}
+
+func TestHistorySearchPaint(t *testing.T) {
+  setHistory(t, "git status")
+  // The line editor repaints when the prompt is set, holding its own lock
+  var painted string
+  search := &historySearch{}
+  search.setPrompt = func(string) {
+    painted = string(search.Paint([]rune("git status"), 4))
+  }
+  search.reset("$ ")
+  for _, key := range []rune{readline.CharBckSearch, 's', 't'} {
+    search.filter(key)
+  }
+
+  if expected := "git \033[7mst\033[0matus"; painted != expected {
+    t.Errorf("Paint = %q, expected %q", painted, expected)
+  }
+  search.filter(readline.CharEnter)
+  if painted != "git status" {
+    t.Errorf("Paint after the search = %q", painted)
+  }
+}
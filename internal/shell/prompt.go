@@ -0,0 +1,167 @@
+package shell
+
+import (
+  "os"
+  "os/user"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/cheesyhypocrisy/harsh/internal/executor"
+)
+
+// commandNumber backs the \# prompt escape: the number of commands run in
+// this session, plus one for the one about to be typed
+var commandNumber = 1
+
+var defaultPrompts = map[string]string{
+  "PS1": "$ ",
+  "PS2": "> ",
+  "PS4": "+ ",
+}
+
+// Prompt renders the prompt stored in the variable name (PS1, PS2 or PS4),
+// falling back to the POSIX defaults when it isn't set. Rendering it, even
+// when a command substitution runs, leaves $? as the last command set it.
+func Prompt(name string) string {
+  ps, exists := os.LookupEnv(name)
+  if !exists {
+    return defaultPrompts[name]
+  }
+
+  status := executor.LastStatus
+  defer func() { executor.LastStatus = status }()
+  return executor.Expand(expandPromptEscapes(ps))
+}
+
+// runPromptCommand executes $PROMPT_COMMAND before PS1 is displayed without
+// disturbing the $? that the prompt may want to show
+func runPromptCommand() {
+  command := strings.TrimSpace(os.Getenv("PROMPT_COMMAND"))
+  if command == "" {
+    return
+  }
+
+  status := executor.LastStatus
+  executor.Run(command)
+  executor.LastStatus = status
+}
+
+// expandPromptEscapes decodes the bash-style backslash escapes in ps. The
+// result still has to go through parameter expansion, so a literal '$' or
+// '\' produced here is escaped to survive it.
+func expandPromptEscapes(ps string) string {
+  var out strings.Builder
+  for i := 0; i < len(ps); i++ {
+    if ps[i] != '\\' || i+1 == len(ps) {
+      out.WriteByte(ps[i])
+      continue
+    }
+
+    i++
+    switch ps[i] {
+    case 'u':
+      out.WriteString(promptLiteral(promptUser()))
+    case 'h':
+      host, _ := os.Hostname()
+      host, _, _ = strings.Cut(host, ".")
+      out.WriteString(promptLiteral(host))
+    case 'H':
+      host, _ := os.Hostname()
+      out.WriteString(promptLiteral(host))
+    case 'w':
+      out.WriteString(promptLiteral(promptCwd(false)))
+    case 'W':
+      out.WriteString(promptLiteral(promptCwd(true)))
+    case 't':
+      out.WriteString(time.Now().Format("15:04:05"))
+    case 'T':
+      out.WriteString(time.Now().Format("03:04:05"))
+    case 'A':
+      out.WriteString(time.Now().Format("15:04"))
+    case 'd':
+      out.WriteString(time.Now().Format("Mon Jan 02"))
+    case 'g':
+      out.WriteString(promptLiteral(gitBranch()))
+    case 'G':
+      out.WriteString(gitDirtyMarker())
+    case '?':
+      out.WriteString(exitStatusSegment(executor.LastStatus))
+    case '$':
+      if os.Geteuid() == 0 {
+        out.WriteString("#")
+      } else {
+        out.WriteString("\\$")
+      }
+    case '!':
+      out.WriteString(strconv.Itoa(len(executor.Hist) + 1))
+    case '#':
+      out.WriteString(strconv.Itoa(commandNumber))
+    case 's':
+      out.WriteString("harsh")
+    case 'n':
+      out.WriteString("\n")
+    case 'e':
+      out.WriteString("\033")
+    case 'a':
+      out.WriteString("\a")
+    case '\\':
+      out.WriteString("\\\\")
+    case '[', ']':
+      // Non-printing markers only matter to the width calculation, which
+      // readline already does by skipping ANSI sequences
+    case '0', '1', '2', '3', '4', '5', '6', '7':
+      end := i
+      for end < len(ps) && end < i+3 && ps[end] >= '0' && ps[end] <= '7' {
+        end++
+      }
+      code, _ := strconv.ParseUint(ps[i:end], 8, 8)
+      out.WriteByte(byte(code))
+      i = end - 1
+    default:
+      out.WriteByte('\\')
+      out.WriteByte(ps[i])
+    }
+  }
+  return out.String()
+}
+
+// promptLiteral protects text substituted by an escape, such as a directory
+// name, from the parameter expansion pass that follows
+func promptLiteral(s string) string {
+  return strings.NewReplacer("\\", "\\\\", "$", "\\$", "`", "\\`").Replace(s)
+}
+
+func promptUser() string {
+  if name := os.Getenv("USER"); name != "" {
+    return name
+  }
+  if u, err := user.Current(); err == nil {
+    return u.Username
+  }
+  return ""
+}
+
+// promptCwd returns the working directory, as $PWD names it through any
+// symlinks, with $HOME abbreviated to ~, or only its last component when
+// base is set
+func promptCwd(base bool) string {
+  dir, err := executor.WorkingDir()
+  if err != nil {
+    return ""
+  }
+
+  home := os.Getenv("HOME")
+  if home != "" && home != "/" && (dir == home || strings.HasPrefix(dir, home+"/")) {
+    if base && dir == home {
+      return "~"
+    }
+    dir = "~" + dir[len(home):]
+  }
+
+  if base && dir != "/" {
+    return filepath.Base(dir)
+  }
+  return dir
+}
@@ -0,0 +1,86 @@
+package shell
+
+import (
+  "os"
+  "testing"
+
+  "github.com/cheesyhypocrisy/harsh/internal/executor"
+)
+
+func TestPrompt(t *testing.T) {
+  originalHist := executor.Hist
+  defer func() { executor.Hist = originalHist }()
+  executor.Hist = []executor.HistEntry{{Line: "echo one"}, {Line: "echo two"}}
+
+  cwd, _ := os.Getwd()
+  defer os.Chdir(cwd)
+  dir := t.TempDir()
+  os.Chdir(dir)
+  t.Setenv("HOME", dir)
+  t.Setenv("USER", "harsh")
+
+  dollar := "$"
+  if os.Geteuid() == 0 {
+    dollar = "#"
+  }
+
+  tests := []struct {
+    name     string
+    ps1      string
+    expected string
+  }{
+    {"Literal prompt", "> ", "> "},
+    {"User and cwd", "\\u:\\w\\$ ", "harsh:~" + dollar + " "},
+    {"History number", "\\! ", "3 "},
+    {"Non-printing markers", "\\[\\e[1m\\]x\\[\\e[0m\\]", "\033[1mx\033[0m"},
+    {"Octal escape", "\\101", "A"},
+    {"Parameter expansion", "$USER ", "harsh "},
+    {"Command substitution", "$(echo sub) ", "sub "},
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      t.Setenv("PS1", test.ps1)
+      result := Prompt("PS1")
+      if result != test.expected {
+        t.Errorf("Prompt(%q) = %q, expected %q", test.ps1, result, test.expected)
+      }
+    })
+  }
+}
+
+func TestPromptDefaults(t *testing.T) {
+  t.Setenv("PS2", "")
+  os.Unsetenv("PS2")
+  if result := Prompt("PS2"); result != "> " {
+    t.Errorf("Expected default PS2 %q, got %q", "> ", result)
+  }
+}
+
+func TestPromptKeepsStatus(t *testing.T) {
+  originalStatus := executor.LastStatus
+  defer func() { executor.LastStatus = originalStatus }()
+  executor.LastStatus = 5
+
+  t.Setenv("PS1", "$(exit 3)$(echo x) ")
+  Prompt("PS1")
+  if executor.LastStatus != 5 {
+    t.Errorf("Rendering PS1 left $? at %d, expected 5", executor.LastStatus)
+  }
+}
+
+func TestPromptCwdIsLogical(t *testing.T) {
+  home := t.TempDir()
+  os.Mkdir(home+"/real", 0755)
+  os.Symlink(home+"/real", home+"/link")
+  t.Chdir(home + "/link")
+  t.Setenv("PWD", home+"/link")
+  t.Setenv("HOME", home)
+
+  if result := promptCwd(false); result != "~/link" {
+    t.Errorf("promptCwd(false) = %q, expected %q", result, "~/link")
+  }
+  if result := promptCwd(true); result != "link" {
+    t.Errorf("promptCwd(true) = %q, expected %q", result, "link")
+  }
+}
@@ -1,7 +1,13 @@
 package shell
 
 import (
+  "errors"
+  "fmt"
+  "io"
+  "math"
+  "os"
   "strings"
+  "time"
 
   "github.com/cheesyhypocrisy/harsh/internal/executor"
 	"github.com/cheesyhypocrisy/harsh/internal/lexer"
@@ -13,34 +19,175 @@ func Shell() error {
   autocomplete := &Autocomplete{
     tabCount: 0,
   }
+  search := &historySearch{out: os.Stdout, size: terminalSize}
   rl, err := readline.NewEx(&readline.Config{
-    Prompt: "$ ",
+    Prompt: Prompt("PS1"),
     AutoComplete: autocomplete,
     InterruptPrompt: "^C",
     EOFPrompt:       "exit",
+    // Up, Down and the search go through executor.Hist, which HISTSIZE
+    // limits and AddHistory decides what goes in
+    DisableAutoSaveHistory: true,
+    HistoryLimit: math.MaxInt,
+    FuncFilterInputRune: search.filter,
+    Listener: search,
+    Painter: search,
   })
   if err != nil {
     return err
   }
   defer rl.Close()
+  search.setPrompt = rl.SetPrompt
+  var history editorHistory
+
+  // Lines are read on a goroutine of their own so that this one, which
+  // owns the shell's state, can render the prompt again when the
+  // background git check finds the dirty marker changed
+  redraw := make(chan struct{}, 1)
+  onGitDirtyChange = func() {
+    select {
+    case redraw <- struct{}{}:
+    default:
+    }
+  }
+  type readResult struct {
+    line string
+    err error
+  }
+  results := make(chan readResult)
+  readLine := func(name string) (string, error) {
+    // A change found while a command ran shows in the prompt anyway
+    select {
+    case <-redraw:
+    default:
+    }
+    autocomplete.mu.Lock()
+    prompt := Prompt(name)
+    autocomplete.prompt = prompt
+    autocomplete.mu.Unlock()
+    search.reset(prompt)
+
+    go func() {
+      line, err := rl.Readline()
+      results <- readResult{line, err}
+    }()
+    for {
+      select {
+      case result := <-results:
+        return result.line, result.err
+      case <-redraw:
+        autocomplete.mu.Lock()
+        prompt := Prompt(name)
+        autocomplete.prompt = prompt
+        autocomplete.mu.Unlock()
+        search.changePrompt(prompt)
+        rl.Refresh()
+      }
+    }
+  }
 
 	for {
-    line, err := rl.Readline()
-    if err != nil {
+    // The last command's entry goes to $HISTFILE right away, and other
+    // sessions' ones come in if history is shared
+    if err := executor.SyncHistory(); err != nil {
+      fmt.Fprintf(os.Stderr, "harsh: history: %s\n", err.Error())
+    }
+    runPromptCommand()
+    history.sync(rl)
+    line, err := readLine("PS1")
+    if err == readline.ErrInterrupt {
+      continue
+    } else if err == io.EOF {
+      return nil
+    } else if err != nil {
       return err
     }
-    
+
+    // Keep reading with PS2 while the command is syntactically unfinished,
+    // the whole thing then runs and is remembered as one entry
+    abandoned := false
+    state := parser.ScanContinuation(line)
+    for state.Incomplete() {
+      next, err := readLine("PS2")
+      if err != nil {
+        if err != readline.ErrInterrupt {
+          fmt.Fprintln(os.Stderr, "harsh: syntax error: unexpected end of file")
+          executor.LastStatus = 2
+        }
+        abandoned = true
+        break
+      }
+      line = parser.JoinContinuation(line, next, state)
+      state = parser.ScanContinuation(line)
+    }
+    if abandoned {
+      continue
+    }
+    if err := state.Err(); err != nil {
+      fmt.Fprintf(os.Stderr, "harsh: %s\n", err.Error())
+      executor.LastStatus = 2
+      continue
+    }
+
+    // Leading blanks only matter to HISTCONTROL=ignorespace
+    indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
     line = strings.TrimSpace(line)
-    executor.Hist = append(executor.Hist, line)
-    tokens, err := lexer.NewLexer(line).Lex()
+    if line == "" {
+      continue
+    }
+    // History references are expanded before anything else sees the line,
+    // and the expanded line is what's shown and remembered
+    expanded, printOnly, err := executor.ExpandHistory(line)
     if err != nil {
-      return err
+      fmt.Fprintf(os.Stderr, "harsh: %s\n", err.Error())
+      executor.LastStatus = 1
+      continue
+    }
+    if expanded != line || printOnly {
+      fmt.Println(expanded)
+    }
+    line = expanded
+    entry, recorded := executor.AddHistory(indent + line)
+    if printOnly {
+      continue
     }
+    start := time.Now()
+    if recorded {
+      executor.HistCommand = entry
+    }
+    runLine(line)
+    executor.HistCommand = executor.HistEntry{}
+    commandNumber++
+    if recorded {
+      if err := executor.RecordHistory(entry, time.Since(start), executor.LastStatus); err != nil {
+        fmt.Fprintf(os.Stderr, "harsh: history: %s\n", err.Error())
+      }
+    }
+  }
+}
 
-    commands, err := parser.ParseTokens(tokens)
-    if err != nil {
-      return err
+// runLine executes one logical command line. Whatever goes wrong in it, a
+// syntax error or even a panic in a builtin, is reported and the REPL
+// carries on with $? set accordingly.
+func runLine(line string) {
+  defer func() {
+    if r := recover(); r != nil {
+      fmt.Fprintf(os.Stderr, "harsh: %v\n", r)
+      executor.LastStatus = 1
     }
-    executor.Eval(commands)
+  }()
+
+  if _, err := executor.Run(line); err != nil {
+    reportError(os.Stderr, line, err)
+  }
+}
+
+// reportError prints err the way the shell presents failures, pointing at
+// the offending column for syntax errors
+func reportError(w io.Writer, line string, err error) {
+  fmt.Fprintf(w, "harsh: %s\n", err.Error())
+  var syntaxErr *lexer.SyntaxError
+  if errors.As(err, &syntaxErr) {
+    fmt.Fprintln(w, syntaxErr.Caret(line))
   }
 }
@@ -0,0 +1,52 @@
+package shell
+
+import (
+  "bytes"
+  "fmt"
+  "testing"
+
+  "github.com/cheesyhypocrisy/harsh/internal/executor"
+)
+
+func TestReportError(t *testing.T) {
+  tests := []struct {
+    name     string
+    line     string
+    expected string
+  }{
+    {
+      name:     "Syntax error",
+      line:     "echo a | | b",
+      expected: "harsh: syntax error near unexpected token '|'\necho a | | b\n         ^\n",
+    },
+    {
+      name:     "Unmatched quote",
+      line:     "echo \"abc",
+      expected: "harsh: unexpected end of file while looking for matching '\"'\necho \"abc\n     ^\n",
+    },
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      _, err := executor.Run(test.line)
+      if err == nil {
+        t.Fatalf("Expected an error for %q", test.line)
+      }
+      if executor.LastStatus != 2 {
+        t.Errorf("Expected $? to be 2, got %d", executor.LastStatus)
+      }
+
+      out := &bytes.Buffer{}
+      reportError(out, test.line, err)
+      if out.String() != test.expected {
+        t.Errorf("Expected %q, got %q", test.expected, out.String())
+      }
+    })
+  }
+
+  out := &bytes.Buffer{}
+  reportError(out, "ls", fmt.Errorf("something broke"))
+  if out.String() != "harsh: something broke\n" {
+    t.Errorf("Unexpected output for a plain error %q", out.String())
+  }
+}